@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/syntasso/kratix-cli/aspects/helm-promise/lib"
 	"github.com/syntasso/kratix-cli/cmd"
@@ -12,7 +13,9 @@ func main() {
 	version := lib.GetEnvOrDie(cmd.XRD_VERSION_ENV_VAR)
 	kind := lib.GetEnvOrDie(cmd.XRD_KIND_ENV_VAR)
 
-	err := lib.TransformInputToOutput(group, version, kind)
+	err := lib.TransformInputToOutput(group, version, kind, lib.TransformOptions{
+		Scope: os.Getenv(cmd.XRD_SCOPE_ENV_VAR),
+	})
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
@@ -1,7 +1,9 @@
 package run_test
 
 import (
+	"os"
 	"os/exec"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -41,24 +43,87 @@ func runWithEnv(envVars map[string]string) *gexec.Session {
 
 var _ = Describe("From Crossplane to Promise Aspect", func() {
 	var (
-		envVars map[string]string
+		envVars     map[string]string
+		metadataDir string
 	)
 
 	BeforeEach(func() {
+		var err error
+		metadataDir, err = os.MkdirTemp("", "kratix-metadata")
+		Expect(err).NotTo(HaveOccurred())
 		envVars = map[string]string{
-			"KRATIX_INPUT_FILE":  "assets/test-object.yaml",
-			"KRATIX_OUTPUT_FILE": "/dev/stdout",
-			"XRD_GROUP":          "example.com",
-			"XRD_VERSION":        "v1",
-			"XRD_KIND":           "Example",
+			"KRATIX_INPUT_FILE":   "assets/test-object.yaml",
+			"KRATIX_OUTPUT_FILE":  "/dev/stdout",
+			"KRATIX_METADATA_DIR": metadataDir,
+			"XRD_GROUP":           "example.com",
+			"XRD_VERSION":         "v1",
+			"XRD_KIND":            "Example",
 		}
 	})
 
+	AfterEach(func() {
+		os.RemoveAll(metadataDir)
+	})
+
 	It("creates an object file in the output directory", func() {
 		session := runWithEnv(envVars)
 		Expect(session.Out).To(gbytes.Say(expectedOutput))
 	})
 
+	It("writes a reference to the object to the status", func() {
+		Expect(os.WriteFile(filepath.Join(metadataDir, "status.yaml"), []byte("previous: step\n"), 0644)).To(Succeed())
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+
+		status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(MatchYAML(`message: Example test-object requested
+previous: step
+resourceRef:
+  apiVersion: example.com/v1
+  kind: Example
+  name: test-object
+  namespace: default
+`))
+	})
+
+	It("writes the connection secret of the claim to the status", func() {
+		envVars["KRATIX_INPUT_FILE"] = "assets/test-object-with-connection-secret.yaml"
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+
+		status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(status)).To(ContainSubstring("connectionSecretRef:\n  name: test-object-connection\n  namespace: default\n"))
+	})
+
+	It("creates a namespaced object in the namespace of the request", func() {
+		envVars["XRD_SCOPE"] = "Namespaced"
+		session := runWithEnv(envVars)
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("namespace: non-default"))
+	})
+
+	It("creates a cluster-scoped object without a namespace", func() {
+		envVars["XRD_SCOPE"] = "Cluster"
+		envVars["KRATIX_INPUT_FILE"] = "assets/test-object-with-connection-secret-namespace.yaml"
+		session := runWithEnv(envVars)
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).NotTo(gbytes.Say("namespace: non-default"))
+
+		status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(MatchYAML(`message: Example test-object requested
+resourceRef:
+  apiVersion: example.com/v1
+  kind: Example
+  name: test-object
+connectionSecretRef:
+  name: test-object-connection
+  namespace: crossplane-system
+`))
+	})
+
 	It("tries to read from /kratix/input/object.yaml if KRATIX_INPUT_FILE is not set", func() {
 		delete(envVars, "KRATIX_INPUT_FILE")
 		session := runWithEnv(envVars)
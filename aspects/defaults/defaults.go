@@ -0,0 +1,80 @@
+// Package defaults holds the default values set on the spec of the objects
+// the aspects generate, for the fields the Promise API leaves out
+package defaults
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// SpecEnvVar holds the JSON values the spec of the generated object defaults
+// to, set by `kratix init operator-promise --values-file`
+const SpecEnvVar = "OPERATOR_SPEC_DEFAULTS"
+
+// ReadFile reads the values of a YAML or JSON values file, such as the spec
+// defaults of operator objects or the values of a chart fixed by the
+// platform. It returns nil when no file is given.
+func ReadFile(path string) (map[string]any, error) {
+	if path == "" {
+		return nil, nil
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values file %s: %w", path, err)
+	}
+	values := map[string]any{}
+	if err := yaml.Unmarshal(contents, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse values file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// SpecFromEnv reads the spec defaults from the environment. It returns nil
+// when they are not set.
+func SpecFromEnv(getenv func(string) string) (map[string]any, error) {
+	value := getenv(SpecEnvVar)
+	if value == "" {
+		return nil, nil
+	}
+
+	var defaults map[string]any
+	if err := json.Unmarshal([]byte(value), &defaults); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", SpecEnvVar, err)
+	}
+	return defaults, nil
+}
+
+// ApplyToSpec sets the fields of the defaults that the spec of the object
+// does not set, merging nested objects. This supplies the fields left out of
+// the Promise API.
+func ApplyToSpec(obj *unstructured.Unstructured, defaults map[string]any) {
+	if len(defaults) == 0 {
+		return
+	}
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	if spec == nil {
+		spec = map[string]any{}
+	}
+	unstructured.SetNestedMap(obj.Object, merge(spec, defaults), "spec")
+}
+
+func merge(values, defaults map[string]any) map[string]any {
+	for key, defaultValue := range defaults {
+		value, found := values[key]
+		if !found || value == nil {
+			values[key] = runtime.DeepCopyJSONValue(defaultValue)
+			continue
+		}
+		nestedValues, valueIsMap := value.(map[string]any)
+		nestedDefaults, defaultIsMap := defaultValue.(map[string]any)
+		if valueIsMap && defaultIsMap {
+			values[key] = merge(nestedValues, nestedDefaults)
+		}
+	}
+	return values
+}
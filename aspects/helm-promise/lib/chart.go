@@ -0,0 +1,268 @@
+package lib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+const (
+	// Environment variables of the chart the helm-promise aspect renders
+	ChartURLEnvVar     = "CHART_URL"
+	ChartNameEnvVar    = "CHART_NAME"
+	ChartVersionEnvVar = "CHART_VERSION"
+
+	// TargetNamespaceEnvVar overrides the namespace of the release, which
+	// defaults to the namespace of the request
+	TargetNamespaceEnvVar = "TARGET_NAMESPACE"
+
+	// PlatformValuesEnvVar holds the JSON values fixed by the platform, set by
+	// `kratix init helm-promise --platform-values`. They take precedence over
+	// the spec of the request.
+	PlatformValuesEnvVar = "PLATFORM_VALUES"
+
+	// IncludeCRDsEnvVar renders the CRDs of the chart when set to true
+	IncludeCRDsEnvVar = "INCLUDE_CRDS"
+	// APIVersionsEnvVar holds the comma-separated API versions available to
+	// the chart's Capabilities, such as monitoring.coreos.com/v1
+	APIVersionsEnvVar = "API_VERSIONS"
+	// KubeVersionEnvVar sets the Kubernetes version of the chart's
+	// Capabilities
+	KubeVersionEnvVar = "KUBE_VERSION"
+
+	// Environment variables holding the credentials of the chart registry or
+	// repository, set from the Secret of `kratix init helm-promise
+	// --credentials-secret`
+	HelmUsernameEnvVar              = "HELM_USERNAME"
+	HelmPasswordEnvVar              = "HELM_PASSWORD"
+	HelmRegistryConfigEnvVar        = "HELM_REGISTRY_CONFIG_JSON"
+	HelmCABundleEnvVar              = "HELM_CA_BUNDLE"
+	HelmInsecureSkipTLSVerifyEnvVar = "HELM_INSECURE_SKIP_TLS_VERIFY"
+)
+
+// ChartConfig configures the chart the helm-promise aspect renders
+type ChartConfig struct {
+	// URL is the OCI reference, archive URL or local path of the chart, or
+	// the URL of the chart repository when Name is set
+	URL     string
+	Name    string
+	Version string
+
+	TargetNamespace string
+	PlatformValues  map[string]any
+
+	IncludeCRDs bool
+	APIVersions []string
+	KubeVersion string
+
+	// Delivery is one of Deliveries, defaulting to DeliveryRendered
+	Delivery string
+	// CredentialsSecret is the Secret the Flux sources authenticate with
+	CredentialsSecret string
+
+	Auth ChartAuth
+}
+
+// ChartAuth authenticates with the chart registry or repository. The files
+// are paths, such as the ones written by ChartAuthFromEnv.
+type ChartAuth struct {
+	Username string
+	Password string
+	// RegistryConfig is the path to the registry config file. Helm's default
+	// registry config is used when it is not set.
+	RegistryConfig string
+	CAFile         string
+	CertFile       string
+	KeyFile        string
+
+	InsecureSkipTLSVerify bool
+}
+
+// ChartConfigFromEnv reads the chart configuration from the environment. The
+// registry config and CA bundle are written to files in authDir.
+func ChartConfigFromEnv(getenv func(string) string, authDir string) (ChartConfig, error) {
+	config := ChartConfig{
+		URL:             getenv(ChartURLEnvVar),
+		Name:            getenv(ChartNameEnvVar),
+		Version:         getenv(ChartVersionEnvVar),
+		TargetNamespace: getenv(TargetNamespaceEnvVar),
+		IncludeCRDs:     getenv(IncludeCRDsEnvVar) == "true",
+		KubeVersion:     getenv(KubeVersionEnvVar),
+
+		Delivery:          getenv(DeliveryEnvVar),
+		CredentialsSecret: getenv(HelmCredentialsSecretEnvVar),
+	}
+	if config.URL == "" {
+		return ChartConfig{}, fmt.Errorf("expected %s to be set", ChartURLEnvVar)
+	}
+	if config.Delivery == "" {
+		config.Delivery = DeliveryRendered
+	}
+	if !slices.Contains(Deliveries, config.Delivery) {
+		return ChartConfig{}, fmt.Errorf("unsupported %s %q: expected one of %s", DeliveryEnvVar, config.Delivery, strings.Join(Deliveries, ", "))
+	}
+
+	for _, apiVersion := range strings.Split(getenv(APIVersionsEnvVar), ",") {
+		if apiVersion = strings.TrimSpace(apiVersion); apiVersion != "" {
+			config.APIVersions = append(config.APIVersions, apiVersion)
+		}
+	}
+
+	if value := getenv(PlatformValuesEnvVar); value != "" {
+		if err := json.Unmarshal([]byte(value), &config.PlatformValues); err != nil {
+			return ChartConfig{}, fmt.Errorf("parsing %s: %w", PlatformValuesEnvVar, err)
+		}
+	}
+
+	auth, err := ChartAuthFromEnv(getenv, authDir)
+	if err != nil {
+		return ChartConfig{}, err
+	}
+	config.Auth = auth
+	return config, nil
+}
+
+// ChartAuthFromEnv reads the credentials of the chart registry or repository
+// from the environment, writing the registry config and CA bundle to files
+// in dir
+func ChartAuthFromEnv(getenv func(string) string, dir string) (ChartAuth, error) {
+	auth := ChartAuth{
+		Username:              getenv(HelmUsernameEnvVar),
+		Password:              getenv(HelmPasswordEnvVar),
+		InsecureSkipTLSVerify: getenv(HelmInsecureSkipTLSVerifyEnvVar) == "true",
+	}
+
+	if registryConfig := getenv(HelmRegistryConfigEnvVar); registryConfig != "" {
+		auth.RegistryConfig = filepath.Join(dir, "registry-config.json")
+		if err := os.WriteFile(auth.RegistryConfig, []byte(registryConfig), 0600); err != nil {
+			return ChartAuth{}, fmt.Errorf("failed to write registry config: %w", err)
+		}
+	}
+
+	if caBundle := getenv(HelmCABundleEnvVar); caBundle != "" {
+		auth.CAFile = filepath.Join(dir, "ca.crt")
+		if err := os.WriteFile(auth.CAFile, []byte(caBundle), 0600); err != nil {
+			return ChartAuth{}, fmt.Errorf("failed to write CA bundle: %w", err)
+		}
+	}
+	return auth, nil
+}
+
+// NewRegistryClient returns a client of OCI registries authenticating with
+// the credentials, or with the registry config
+func NewRegistryClient(auth ChartAuth) (*registry.Client, error) {
+	registryConfig := auth.RegistryConfig
+	if registryConfig == "" {
+		registryConfig = cli.New().RegistryConfig
+	}
+
+	options := []registry.ClientOption{
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptCredentialsFile(registryConfig),
+	}
+	if auth.Username != "" || auth.Password != "" {
+		options = append(options, registry.ClientOptBasicAuth(auth.Username, auth.Password))
+	}
+	if auth.CAFile != "" || auth.CertFile != "" || auth.InsecureSkipTLSVerify {
+		tlsConfig, err := TLSConfig(auth)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, registry.ClientOptHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		}))
+	}
+
+	registryClient, err := registry.NewClient(options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create helm registry client: %w", err)
+	}
+	return registryClient, nil
+}
+
+// TLSConfig returns the TLS configuration of the chart registry or repository
+func TLSConfig(auth ChartAuth) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: auth.InsecureSkipTLSVerify}
+
+	if auth.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(auth.CertFile, auth.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %w", auth.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if auth.CAFile != "" {
+		caBundle, err := os.ReadFile(auth.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %w", auth.CAFile, err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", auth.CAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	return tlsConfig, nil
+}
+
+// SetChartPathAuth configures the chart lookup of the install to
+// authenticate with the chart registry or repository
+func SetChartPathAuth(install *action.Install, auth ChartAuth) error {
+	install.ChartPathOptions.Username = auth.Username
+	install.ChartPathOptions.Password = auth.Password
+	install.ChartPathOptions.CaFile = auth.CAFile
+	install.ChartPathOptions.CertFile = auth.CertFile
+	install.ChartPathOptions.KeyFile = auth.KeyFile
+	install.ChartPathOptions.InsecureSkipTLSverify = auth.InsecureSkipTLSVerify
+
+	registryClient, err := NewRegistryClient(auth)
+	if err != nil {
+		return err
+	}
+	install.SetRegistryClient(registryClient)
+	return nil
+}
+
+// LoadChart fetches the chart from its registry or repository, or reads it
+// from its local path
+func LoadChart(config ChartConfig) (*chart.Chart, error) {
+	install := action.NewInstall(&action.Configuration{})
+	if err := SetChartPathAuth(install, config.Auth); err != nil {
+		return nil, err
+	}
+
+	name := config.URL
+	if config.Name != "" {
+		name = config.Name
+		install.RepoURL = config.URL
+	}
+	install.Version = config.Version
+
+	chartPath, err := install.LocateChart(name, cli.New())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch helm chart %s: %w", name, err)
+	}
+
+	helmChart, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load helm chart %s: %w", chartPath, err)
+	}
+	return helmChart, nil
+}
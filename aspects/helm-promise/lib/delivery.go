@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/registry"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DeliveryEnvVar selects how the release is delivered to the destination,
+	// set by `kratix init helm-promise --delivery`
+	DeliveryEnvVar = "DELIVERY"
+	// HelmCredentialsSecretEnvVar holds the name of the Secret the Flux
+	// sources authenticate with
+	HelmCredentialsSecretEnvVar = "HELM_CREDENTIALS_SECRET"
+
+	// DeliveryRendered writes the rendered manifests of the release
+	DeliveryRendered = "rendered"
+	// DeliveryFlux writes a Flux HelmRelease and its HelmRepository or
+	// OCIRepository source
+	DeliveryFlux = "flux"
+	// DeliveryArgoCD writes an Argo CD Application
+	DeliveryArgoCD = "argocd"
+
+	// argoCDNamespace is the namespace Argo CD watches for Applications
+	argoCDNamespace = "argocd"
+	// argoCDResourcesFinalizer makes Argo CD delete the resources of an
+	// Application before the Application itself
+	argoCDResourcesFinalizer = "resources-finalizer.argocd.argoproj.io"
+	// fluxInterval is how often Flux reconciles the release and its source
+	fluxInterval = "10m"
+)
+
+// Deliveries are the supported deliveries, the first being the default
+var Deliveries = []string{DeliveryRendered, DeliveryFlux, DeliveryArgoCD}
+
+// Render renders the request for the delivery of the config. It returns the
+// files to write to the output and the status of the request.
+func Render(request *unstructured.Unstructured, config ChartConfig) ([]RenderedFile, map[string]any, error) {
+	switch config.Delivery {
+	case DeliveryFlux, DeliveryArgoCD:
+		objects, err := deliveryObjects(request, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		files, err := objectFiles(objects)
+		if err != nil {
+			return nil, nil, err
+		}
+		return files, ReleaseStatus(request, config, config.Version), nil
+	default:
+		helmChart, err := LoadChart(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		files, err := RenderRelease(helmChart, request, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return files, ReleaseStatus(request, config, helmChart.Metadata.Version), nil
+	}
+}
+
+// deliveryObjects returns the objects the GitOps tool of the delivery
+// installs the release from, with the values of the release inline
+func deliveryObjects(request *unstructured.Unstructured, config ChartConfig) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	var err error
+	if config.Delivery == DeliveryFlux {
+		objects, err = fluxObjects(request, config)
+	} else {
+		objects, err = argoCDObjects(request, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	labels := requestLabels(request)
+	for _, object := range objects {
+		labels.apply(object)
+	}
+	return objects, nil
+}
+
+func fluxObjects(request *unstructured.Unstructured, config ChartConfig) ([]*unstructured.Unstructured, error) {
+	name := request.GetName()
+	namespace := ReleaseNamespace(request, config)
+
+	var source *unstructured.Unstructured
+	releaseSpec := map[string]any{
+		"interval":    fluxInterval,
+		"releaseName": name,
+		"values":      ReleaseValues(request, config),
+	}
+
+	switch {
+	case registry.IsOCI(config.URL):
+		sourceSpec := map[string]any{
+			"interval": fluxInterval,
+			"url":      config.URL,
+			"layerSelector": map[string]any{
+				"mediaType": registry.ChartLayerMediaType,
+				"operation": "copy",
+			},
+		}
+		// without a ref, Flux pulls the `latest` tag, which charts are
+		// rarely published with
+		if config.Version != "" {
+			sourceSpec["ref"] = map[string]any{"tag": config.Version}
+		} else {
+			sourceSpec["ref"] = map[string]any{"semver": "*"}
+		}
+		source = deliveryObject("source.toolkit.fluxcd.io/v1beta2", "OCIRepository", name, namespace, sourceSpec)
+		releaseSpec["chartRef"] = map[string]any{"kind": "OCIRepository", "name": name}
+	case config.Name != "":
+		source = deliveryObject("source.toolkit.fluxcd.io/v1", "HelmRepository", name, namespace, map[string]any{
+			"interval": fluxInterval,
+			"url":      config.URL,
+		})
+		chartSpec := map[string]any{
+			"chart":     config.Name,
+			"sourceRef": map[string]any{"kind": "HelmRepository", "name": name},
+		}
+		if config.Version != "" {
+			chartSpec["version"] = config.Version
+		}
+		releaseSpec["chart"] = map[string]any{"spec": chartSpec}
+	default:
+		return nil, fmt.Errorf("%s delivery needs an OCI chart or a chart repository with %s, not %s", DeliveryFlux, ChartNameEnvVar, config.URL)
+	}
+
+	if config.CredentialsSecret != "" {
+		unstructured.SetNestedField(source.Object, map[string]any{"name": config.CredentialsSecret}, "spec", "secretRef")
+	}
+
+	release := deliveryObject("helm.toolkit.fluxcd.io/v2", "HelmRelease", name, namespace, releaseSpec)
+	return []*unstructured.Unstructured{source, release}, nil
+}
+
+func argoCDObjects(request *unstructured.Unstructured, config ChartConfig) ([]*unstructured.Unstructured, error) {
+	var repoURL, chartName string
+	switch {
+	case registry.IsOCI(config.URL):
+		// Argo CD references OCI charts by their registry path and name
+		reference := strings.TrimPrefix(config.URL, fmt.Sprintf("%s://", registry.OCIScheme))
+		repoURL, chartName = path.Dir(reference), path.Base(reference)
+	case config.Name != "":
+		repoURL, chartName = config.URL, config.Name
+	default:
+		return nil, fmt.Errorf("%s delivery needs an OCI chart or a chart repository with %s, not %s", DeliveryArgoCD, ChartNameEnvVar, config.URL)
+	}
+
+	targetRevision := config.Version
+	if targetRevision == "" {
+		targetRevision = "*"
+	}
+
+	application := deliveryObject("argoproj.io/v1alpha1", "Application", argoCDApplicationName(request), argoCDNamespace, map[string]any{
+		"project": "default",
+		"source": map[string]any{
+			"repoURL":        repoURL,
+			"chart":          chartName,
+			"targetRevision": targetRevision,
+			"helm": map[string]any{
+				"releaseName":  request.GetName(),
+				"valuesObject": ReleaseValues(request, config),
+			},
+		},
+		"destination": map[string]any{
+			"server":    "https://kubernetes.default.svc",
+			"namespace": ReleaseNamespace(request, config),
+		},
+		"syncPolicy": map[string]any{
+			"automated":   map[string]any{"prune": true, "selfHeal": true},
+			"syncOptions": []any{"CreateNamespace=true"},
+		},
+	})
+	application.SetFinalizers([]string{argoCDResourcesFinalizer})
+	return []*unstructured.Unstructured{application}, nil
+}
+
+// argoCDApplicationName returns a name for the Application of the request
+// that is unique in the argocd namespace, where the Applications of every
+// Promise and namespace live
+func argoCDApplicationName(request *unstructured.Unstructured) string {
+	var parts []string
+	if promiseName := request.GetLabels()[PromiseNameLabel]; promiseName != "" {
+		parts = append(parts, promiseName)
+	}
+	if namespace := request.GetNamespace(); namespace != "" {
+		parts = append(parts, namespace)
+	}
+	return strings.Join(append(parts, request.GetName()), "-")
+}
+
+func deliveryObject(apiVersion, kind, name, namespace string, spec map[string]any) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	object.SetAPIVersion(apiVersion)
+	object.SetKind(kind)
+	object.SetName(name)
+	object.SetNamespace(namespace)
+	return object
+}
+
+// objectFiles returns one file per object
+func objectFiles(objects []*unstructured.Unstructured) ([]RenderedFile, error) {
+	files := make([]RenderedFile, 0, len(objects))
+	names := map[string]bool{}
+	for _, object := range objects {
+		content, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, RenderedFile{Name: objectFileName(object, names), Content: content})
+	}
+	return files, nil
+}
@@ -0,0 +1,223 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// PromiseNameLabel is set by Kratix on requests, and carried over to the
+	// objects of their release
+	PromiseNameLabel = "kratix.io/promise-name"
+	// ResourceNameLabel is set on the objects of a release to the name of the
+	// request
+	ResourceNameLabel = "kratix.io/resource-name"
+)
+
+// RenderedFile is a file of the rendered release, holding one object
+type RenderedFile struct {
+	Name    string
+	Content []byte
+}
+
+// ReleaseNamespace returns the namespace of the release of the request: the
+// target namespace when it is set, or the namespace of the request
+func ReleaseNamespace(request *unstructured.Unstructured, config ChartConfig) string {
+	if config.TargetNamespace != "" {
+		return config.TargetNamespace
+	}
+	if request.GetNamespace() != "" {
+		return request.GetNamespace()
+	}
+	return "default"
+}
+
+// ReleaseValues returns the values of the release: the spec of the request,
+// overridden by the values fixed by the platform
+func ReleaseValues(request *unstructured.Unstructured, config ChartConfig) map[string]any {
+	spec, _, _ := unstructured.NestedMap(request.Object, "spec")
+	if spec == nil {
+		spec = map[string]any{}
+	}
+	if len(config.PlatformValues) == 0 {
+		return spec
+	}
+	return chartutil.CoalesceTables(runtime.DeepCopyJSON(config.PlatformValues), spec)
+}
+
+// RenderRelease renders the chart for the request, as `helm template` would,
+// and returns one file per object. Test hooks are left out.
+func RenderRelease(helmChart *chart.Chart, request *unstructured.Unstructured, config ChartConfig) ([]RenderedFile, error) {
+	labels := requestLabels(request)
+
+	install := action.NewInstall(&action.Configuration{
+		Log: func(format string, v ...any) { fmt.Fprintf(os.Stderr, format+"\n", v...) },
+	})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.ReleaseName = request.GetName()
+	install.Namespace = ReleaseNamespace(request, config)
+	install.IncludeCRDs = config.IncludeCRDs
+	install.APIVersions = chartutil.VersionSet(config.APIVersions)
+	install.PostRenderer = labels
+	if config.KubeVersion != "" {
+		kubeVersion, err := chartutil.ParseKubeVersion(config.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", KubeVersionEnvVar, config.KubeVersion, err)
+		}
+		install.KubeVersion = kubeVersion
+	}
+
+	rel, err := install.Run(helmChart, ReleaseValues(request, config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render helm chart %s: %w", helmChart.Name(), err)
+	}
+
+	objects, err := splitObjects(rel.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// hooks are not post-rendered by Helm
+	for _, hook := range rel.Hooks {
+		if slices.Contains(hook.Events, release.HookTest) {
+			continue
+		}
+		hookObjects, err := splitObjects(hook.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range hookObjects {
+			labels.apply(object)
+		}
+		objects = append(objects, hookObjects...)
+	}
+
+	return objectFiles(objects)
+}
+
+// ReleaseStatus returns the status of a request fulfilled by the release of
+// the chart version, which is left out when it is not known
+func ReleaseStatus(request *unstructured.Unstructured, config ChartConfig, version string) map[string]any {
+	chartName := config.Name
+	if chartName == "" {
+		chartName = config.URL
+	}
+	release := map[string]any{
+		"name":      request.GetName(),
+		"namespace": ReleaseNamespace(request, config),
+		"chart":     chartName,
+	}
+	if version != "" {
+		release["version"] = version
+	}
+
+	message := fmt.Sprintf("Helm release %s rendered", request.GetName())
+	switch config.Delivery {
+	case DeliveryFlux:
+		message = fmt.Sprintf("Helm release %s delivered as a Flux HelmRelease", request.GetName())
+	case DeliveryArgoCD:
+		message = fmt.Sprintf("Helm release %s delivered as an Argo CD Application", request.GetName())
+	}
+	return map[string]any{
+		"message": message,
+		"release": release,
+	}
+}
+
+// releaseLabels is a post-renderer setting the labels on every object of the
+// release
+type releaseLabels map[string]string
+
+// requestLabels returns the labels identifying the request on the objects of
+// its release
+func requestLabels(request *unstructured.Unstructured) releaseLabels {
+	labels := releaseLabels{ResourceNameLabel: request.GetName()}
+	if promiseName := request.GetLabels()[PromiseNameLabel]; promiseName != "" {
+		labels[PromiseNameLabel] = promiseName
+	}
+	return labels
+}
+
+func (l releaseLabels) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	objects, err := splitObjects(renderedManifests.String())
+	if err != nil {
+		return nil, err
+	}
+
+	modifiedManifests := bytes.NewBuffer(nil)
+	for _, object := range objects {
+		l.apply(object)
+		content, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return nil, err
+		}
+		modifiedManifests.WriteString("---\n")
+		modifiedManifests.Write(content)
+	}
+	return modifiedManifests, nil
+}
+
+func (l releaseLabels) apply(object *unstructured.Unstructured) {
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range l {
+		labels[key] = value
+	}
+	object.SetLabels(labels)
+}
+
+// splitObjects parses the objects of a manifest, in order, skipping empty
+// documents
+func splitObjects(manifest string) ([]*unstructured.Unstructured, error) {
+	documents := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(documents))
+	for key := range documents {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var objects []*unstructured.Unstructured
+	for _, key := range keys {
+		object := map[string]any{}
+		if err := yaml.Unmarshal([]byte(documents[key]), &object); err != nil {
+			return nil, fmt.Errorf("failed to parse rendered manifest: %w\n%s", err, documents[key])
+		}
+		if len(object) == 0 {
+			continue
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: object})
+	}
+	return objects, nil
+}
+
+// objectFileName names the file of an object after its kind and name, adding
+// its namespace and then a counter when the name is taken
+func objectFileName(object *unstructured.Unstructured, names map[string]bool) string {
+	kind := strings.ToLower(object.GetKind())
+	name := fmt.Sprintf("%s-%s.yaml", kind, object.GetName())
+	if names[name] && object.GetNamespace() != "" {
+		name = fmt.Sprintf("%s-%s-%s.yaml", kind, object.GetNamespace(), object.GetName())
+	}
+	for i := 2; names[name]; i++ {
+		name = fmt.Sprintf("%s-%s-%d.yaml", kind, object.GetName(), i)
+	}
+	names[name] = true
+	return name
+}
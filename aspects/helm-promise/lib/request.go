@@ -5,11 +5,31 @@ import (
 	"log"
 	"os"
 
+	"github.com/syntasso/kratix-cli/aspects/defaults"
+	"github.com/syntasso/kratix-cli/aspects/internal/pipeline"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/yaml"
 )
 
-func TransformInputToOutput(group, version, kind string) error {
+const (
+	// ScopeNamespaced objects are created in the namespace of the request
+	ScopeNamespaced = "Namespaced"
+	// ScopeCluster objects are created without a namespace
+	ScopeCluster = "Cluster"
+)
+
+// TransformOptions configure the object transformed from the request
+type TransformOptions struct {
+	// SpecDefaults are the values of the spec fields the request does not set
+	SpecDefaults map[string]any
+	// Scope is the scope of the object, ScopeNamespaced or ScopeCluster. The
+	// object is created in the default namespace when it is not set.
+	Scope string
+}
+
+// TransformInputToOutput writes the object transformed from the request to
+// the output
+func TransformInputToOutput(group, version, kind string, options TransformOptions) error {
 	inputFile := os.Getenv("KRATIX_INPUT_FILE")
 	if inputFile == "" {
 		inputFile = "/kratix/input/object.yaml"
@@ -31,27 +51,55 @@ func TransformInputToOutput(group, version, kind string) error {
 		return fmt.Errorf("Failed to unmarshal object file: %w", err)
 	}
 
+	outputObject := Transform(uRequestObj, group, version, kind)
+	ApplyScope(outputObject, uRequestObj, options.Scope)
+	defaults.ApplyToSpec(outputObject, options.SpecDefaults)
+	if pipeline.IsDeleteWorkflow() {
+		fmt.Printf("%s %s will be deleted when it is removed from the destination\n", outputObject.GetKind(), outputObject.GetName())
+		return nil
+	}
+
+	outputObjectBytes, _ := yaml.Marshal(outputObject)
+	if err := os.WriteFile(outputFile, outputObjectBytes, 0644); err != nil {
+		return fmt.Errorf("Failed to write object file to %s: %w", outputFile, err)
+	}
+
+	return pipeline.WriteStatus(ObjectStatus(uRequestObj, outputObject))
+}
+
+// Transform builds an object of the given group, version and kind from the
+// request, carrying over its name, labels, annotations and spec
+func Transform(request *unstructured.Unstructured, group, version, kind string) *unstructured.Unstructured {
 	outputObject := &unstructured.Unstructured{}
-	outputObject.SetName(uRequestObj.GetName())
+	outputObject.SetName(request.GetName())
 	outputObject.SetNamespace("default")
 	outputObject.SetKind(kind)
 	outputObject.SetAPIVersion(group + "/" + version)
-	outputObject.SetLabels(uRequestObj.GetLabels())
-	outputObject.SetAnnotations(uRequestObj.GetAnnotations())
+	outputObject.SetLabels(request.GetLabels())
+	outputObject.SetAnnotations(request.GetAnnotations())
 
-	spec := uRequestObj.Object["spec"]
+	spec := request.Object["spec"]
 	if spec == nil {
 		//if we dont do this we get spec: nil as the output, which isn't valid
 		spec = map[string]any{}
 	}
 	unstructured.SetNestedField(outputObject.Object, spec, "spec")
+	return outputObject
+}
 
-	outputObjectBytes, _ := yaml.Marshal(outputObject)
-	if err := os.WriteFile(outputFile, outputObjectBytes, 0644); err != nil {
-		return fmt.Errorf("Failed to write object file to %s: %w", outputFile, err)
+// ApplyScope sets the namespace of the object for its scope: the namespace of
+// the request for namespaced objects, or none for cluster-scoped ones
+func ApplyScope(obj, request *unstructured.Unstructured, scope string) {
+	switch scope {
+	case ScopeNamespaced:
+		namespace := request.GetNamespace()
+		if namespace == "" {
+			namespace = "default"
+		}
+		obj.SetNamespace(namespace)
+	case ScopeCluster:
+		obj.SetNamespace("")
 	}
-
-	return nil
 }
 
 func GetEnvOrDie(envVar string) string {
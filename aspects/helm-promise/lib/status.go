@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ObjectStatus returns the status of a request fulfilled by the object: a
+// reference to it and, when the request sets writeConnectionSecretToRef, the
+// secret its connection details are written to
+func ObjectStatus(request, object *unstructured.Unstructured) map[string]any {
+	resourceRef := map[string]any{
+		"apiVersion": object.GetAPIVersion(),
+		"kind":       object.GetKind(),
+		"name":       object.GetName(),
+	}
+	if object.GetNamespace() != "" {
+		resourceRef["namespace"] = object.GetNamespace()
+	}
+	status := map[string]any{
+		"message":     fmt.Sprintf("%s %s requested", object.GetKind(), object.GetName()),
+		"resourceRef": resourceRef,
+	}
+
+	// the connection secrets of cluster-scoped composite resources set their
+	// namespace, the ones of claims are in the namespace of the claim
+	if secretName, _, _ := unstructured.NestedString(request.Object, "spec", "writeConnectionSecretToRef", "name"); secretName != "" {
+		secretNamespace, _, _ := unstructured.NestedString(request.Object, "spec", "writeConnectionSecretToRef", "namespace")
+		if secretNamespace == "" {
+			secretNamespace = object.GetNamespace()
+		}
+		status["connectionSecretRef"] = map[string]any{
+			"name":      secretName,
+			"namespace": secretNamespace,
+		}
+	}
+	return status
+}
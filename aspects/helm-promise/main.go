@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/syntasso/kratix-cli/aspects/helm-promise/lib"
+	"github.com/syntasso/kratix-cli/aspects/internal/pipeline"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// run renders the release, removing the credentials of the chart registry or
+// repository written to disk once it completes
+func run() error {
+	inputFile := getEnv("KRATIX_INPUT_FILE", "/kratix/input/object.yaml")
+	outputDir := getEnv("KRATIX_OUTPUT_DIR", "/kratix/output")
+
+	authDir, err := os.MkdirTemp("", "helm-auth")
+	if err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+	defer os.RemoveAll(authDir)
+
+	config, err := lib.ChartConfigFromEnv(os.Getenv, authDir)
+	if err != nil {
+		return err
+	}
+
+	requestContents, err := os.ReadFile(inputFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read object file from %s: %w", inputFile, err)
+	}
+	request := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(requestContents, request); err != nil {
+		return fmt.Errorf("Failed to unmarshal object file: %w", err)
+	}
+
+	// the output of delete workflows is not scheduled: Kratix removes the
+	// manifests of the release from the destinations once the workflow
+	// completes
+	if pipeline.IsDeleteWorkflow() {
+		fmt.Printf("Helm release %s will be uninstalled when its manifests are removed from the destination\n", request.GetName())
+		return nil
+	}
+
+	files, status, err := lib.Render(request, config)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, file := range files {
+		path := filepath.Join(outputDir, file.Name)
+		if err := os.WriteFile(path, file.Content, 0644); err != nil {
+			return fmt.Errorf("Failed to write object file to %s: %w", path, err)
+		}
+	}
+	fmt.Printf("Helm release %s rendered to %d files in %s\n", request.GetName(), len(files), outputDir)
+
+	return pipeline.WriteStatus(status)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
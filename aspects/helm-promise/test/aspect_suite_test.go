@@ -0,0 +1,26 @@
+package run_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+func TestTest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Helm Promise Aspect Test Suite")
+}
+
+var binaryPath string
+
+var _ = BeforeSuite(func() {
+	var err error
+	binaryPath, err = gexec.Build("github.com/syntasso/kratix-cli/aspects/helm-promise")
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	gexec.CleanupBuildArtifacts()
+})
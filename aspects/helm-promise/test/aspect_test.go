@@ -0,0 +1,371 @@
+package run_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func runWithEnv(envVars map[string]string) *gexec.Session {
+	cmd := exec.Command(binaryPath)
+	cmd.Env = []string{"HOME=" + GinkgoT().TempDir()}
+	for key, value := range envVars {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	Expect(err).NotTo(HaveOccurred())
+	Eventually(session, "10s").Should(gexec.Exit())
+	return session
+}
+
+func readObject(path string) *unstructured.Unstructured {
+	contents, err := os.ReadFile(path)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	object := &unstructured.Unstructured{}
+	ExpectWithOffset(1, yaml.Unmarshal(contents, &object.Object)).To(Succeed())
+	return object
+}
+
+func outputFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+var _ = Describe("Helm Promise Aspect", func() {
+	var (
+		envVars     map[string]string
+		outputDir   string
+		metadataDir string
+	)
+
+	BeforeEach(func() {
+		outputDir = GinkgoT().TempDir()
+		metadataDir = GinkgoT().TempDir()
+		chartDir, err := filepath.Abs("assets/chart")
+		Expect(err).NotTo(HaveOccurred())
+		envVars = map[string]string{
+			"KRATIX_INPUT_FILE":   "assets/test-object.yaml",
+			"KRATIX_OUTPUT_DIR":   outputDir,
+			"KRATIX_METADATA_DIR": metadataDir,
+			"CHART_URL":           chartDir,
+		}
+	})
+
+	It("writes one file per rendered object, leaving out CRDs and test hooks", func() {
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Helm release test-object rendered to 3 files in " + outputDir))
+		Expect(outputFiles(outputDir)).To(ConsistOf("deployment-test-object.yaml", "service-test-object.yaml", "job-test-object-migrate.yaml"))
+	})
+
+	It("renders the release in the namespace of the request with the spec as values", func() {
+		runWithEnv(envVars)
+
+		deployment := readObject(filepath.Join(outputDir, "deployment-test-object.yaml"))
+		Expect(deployment.GetNamespace()).To(Equal("team-a"))
+		replicas, _, _ := unstructured.NestedFloat64(deployment.Object, "spec", "replicas")
+		Expect(replicas).To(Equal(float64(3)))
+		containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+		Expect(containers[0]).To(HaveKeyWithValue("image", "evil.example.com/example/cache"))
+	})
+
+	It("renders the release in the target namespace when it is set", func() {
+		envVars["TARGET_NAMESPACE"] = "kratix-worker-system"
+		runWithEnv(envVars)
+
+		Expect(readObject(filepath.Join(outputDir, "service-test-object.yaml")).GetNamespace()).To(Equal("kratix-worker-system"))
+		status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(ContainSubstring("namespace: kratix-worker-system"))
+	})
+
+	It("labels every object with the request, including hooks", func() {
+		runWithEnv(envVars)
+
+		for _, name := range outputFiles(outputDir) {
+			Expect(readObject(filepath.Join(outputDir, name)).GetLabels()).To(SatisfyAll(
+				HaveKeyWithValue("kratix.io/resource-name", "test-object"),
+				HaveKeyWithValue("kratix.io/promise-name", "cache"),
+			), name)
+		}
+		Expect(readObject(filepath.Join(outputDir, "deployment-test-object.yaml")).GetLabels()).To(HaveKeyWithValue("app", "test-object"))
+	})
+
+	It("gives the platform values precedence over the spec", func() {
+		envVars["PLATFORM_VALUES"] = `{"image":{"registry":"registry.example.com"}}`
+		runWithEnv(envVars)
+
+		deployment := readObject(filepath.Join(outputDir, "deployment-test-object.yaml"))
+		containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+		Expect(containers[0]).To(HaveKeyWithValue("image", "registry.example.com/example/cache"))
+		replicas, _, _ := unstructured.NestedFloat64(deployment.Object, "spec", "replicas")
+		Expect(replicas).To(Equal(float64(3)))
+	})
+
+	It("renders the CRDs of the chart when INCLUDE_CRDS is true", func() {
+		envVars["INCLUDE_CRDS"] = "true"
+		runWithEnv(envVars)
+
+		crd := readObject(filepath.Join(outputDir, "customresourcedefinition-caches.example.com.yaml"))
+		Expect(crd.GetLabels()).To(HaveKeyWithValue("kratix.io/resource-name", "test-object"))
+	})
+
+	It("sets the API versions and Kubernetes version of the capabilities", func() {
+		envVars["API_VERSIONS"] = "monitoring.coreos.com/v1, example.com/v1"
+		envVars["KUBE_VERSION"] = "v1.30.2"
+		runWithEnv(envVars)
+
+		Expect(filepath.Join(outputDir, "servicemonitor-test-object.yaml")).To(BeAnExistingFile())
+		deployment := readObject(filepath.Join(outputDir, "deployment-test-object.yaml"))
+		Expect(deployment.GetAnnotations()).To(HaveKeyWithValue("kube-version", "v1.30.2"))
+	})
+
+	It("writes the release to the status", func() {
+		Expect(os.WriteFile(filepath.Join(metadataDir, "status.yaml"), []byte("previous: step\n"), 0644)).To(Succeed())
+		session := runWithEnv(envVars)
+		Expect(session).To(gexec.Exit(0))
+
+		status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(MatchYAML(`message: Helm release test-object rendered
+previous: step
+release:
+  name: test-object
+  namespace: team-a
+  chart: ` + envVars["CHART_URL"] + `
+  version: 0.2.0
+`))
+	})
+
+	It("writes nothing in a delete workflow", func() {
+		envVars["KRATIX_WORKFLOW_ACTION"] = "delete"
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Helm release test-object will be uninstalled when its manifests are removed from the destination"))
+		Expect(outputFiles(outputDir)).To(BeEmpty())
+		Expect(filepath.Join(metadataDir, "status.yaml")).NotTo(BeAnExistingFile())
+	})
+
+	It("fails when CHART_URL is not set", func() {
+		delete(envVars, "CHART_URL")
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("expected CHART_URL to be set"))
+	})
+
+	It("fails when the platform values are not valid JSON", func() {
+		envVars["PLATFORM_VALUES"] = "image: {}"
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("parsing PLATFORM_VALUES"))
+	})
+
+	It("fails when the Kubernetes version is not valid", func() {
+		envVars["KUBE_VERSION"] = "latest"
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("invalid KUBE_VERSION latest"))
+	})
+
+	It("fails when the CA bundle has no certificates", func() {
+		envVars["HELM_CA_BUNDLE"] = "not a certificate"
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("no certificates found in CA bundle"))
+	})
+
+	Context("with the flux delivery", func() {
+		BeforeEach(func() {
+			envVars["DELIVERY"] = "flux"
+			envVars["CHART_URL"] = "oci://registry.example.com/charts/cache"
+			envVars["CHART_VERSION"] = "0.2.0"
+			envVars["PLATFORM_VALUES"] = `{"image":{"registry":"registry.example.com"}}`
+		})
+
+		It("writes a HelmRelease of an OCIRepository with the values inline", func() {
+			envVars["HELM_CREDENTIALS_SECRET"] = "registry-credentials"
+			session := runWithEnv(envVars)
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(outputFiles(outputDir)).To(ConsistOf("ocirepository-test-object.yaml", "helmrelease-test-object.yaml"))
+
+			Expect(os.ReadFile(filepath.Join(outputDir, "ocirepository-test-object.yaml"))).To(MatchYAML(`apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: OCIRepository
+metadata:
+  name: test-object
+  namespace: team-a
+  labels:
+    kratix.io/resource-name: test-object
+    kratix.io/promise-name: cache
+spec:
+  interval: 10m
+  url: oci://registry.example.com/charts/cache
+  ref:
+    tag: 0.2.0
+  layerSelector:
+    mediaType: application/vnd.cncf.helm.chart.content.v1.tar+gzip
+    operation: copy
+  secretRef:
+    name: registry-credentials
+`))
+
+			Expect(os.ReadFile(filepath.Join(outputDir, "helmrelease-test-object.yaml"))).To(MatchYAML(`apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: test-object
+  namespace: team-a
+  labels:
+    kratix.io/resource-name: test-object
+    kratix.io/promise-name: cache
+spec:
+  interval: 10m
+  releaseName: test-object
+  chartRef:
+    kind: OCIRepository
+    name: test-object
+  values:
+    replicas: 3
+    image:
+      registry: registry.example.com
+`))
+		})
+
+		It("pulls the latest version of the chart when no version is set", func() {
+			delete(envVars, "CHART_VERSION")
+			runWithEnv(envVars)
+
+			source := readObject(filepath.Join(outputDir, "ocirepository-test-object.yaml"))
+			ref, _, _ := unstructured.NestedMap(source.Object, "spec", "ref")
+			Expect(ref).To(Equal(map[string]any{"semver": "*"}))
+		})
+
+		It("writes a HelmRelease of a HelmRepository", func() {
+			envVars["CHART_URL"] = "https://charts.example.com"
+			envVars["CHART_NAME"] = "cache"
+			envVars["TARGET_NAMESPACE"] = "caches"
+			runWithEnv(envVars)
+
+			source := readObject(filepath.Join(outputDir, "helmrepository-test-object.yaml"))
+			Expect(source.GetNamespace()).To(Equal("caches"))
+			url, _, _ := unstructured.NestedString(source.Object, "spec", "url")
+			Expect(url).To(Equal("https://charts.example.com"))
+
+			release := readObject(filepath.Join(outputDir, "helmrelease-test-object.yaml"))
+			Expect(release.GetNamespace()).To(Equal("caches"))
+			chart, _, _ := unstructured.NestedMap(release.Object, "spec", "chart", "spec")
+			Expect(chart).To(Equal(map[string]any{
+				"chart":     "cache",
+				"version":   "0.2.0",
+				"sourceRef": map[string]any{"kind": "HelmRepository", "name": "test-object"},
+			}))
+		})
+
+		It("writes the release to the status", func() {
+			runWithEnv(envVars)
+
+			status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(MatchYAML(`message: Helm release test-object delivered as a Flux HelmRelease
+release:
+  name: test-object
+  namespace: team-a
+  chart: oci://registry.example.com/charts/cache
+  version: 0.2.0
+`))
+		})
+
+		It("fails when the chart is a tarball", func() {
+			envVars["CHART_URL"] = "https://example.com/cache-0.2.0.tgz"
+			session := runWithEnv(envVars)
+
+			Expect(session).To(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say("flux delivery needs an OCI chart or a chart repository with CHART_NAME"))
+		})
+	})
+
+	Context("with the argocd delivery", func() {
+		BeforeEach(func() {
+			envVars["DELIVERY"] = "argocd"
+			envVars["CHART_URL"] = "oci://registry.example.com/charts/cache"
+		})
+
+		It("writes an Application with the values inline", func() {
+			session := runWithEnv(envVars)
+
+			Expect(session).To(gexec.Exit(0))
+			Expect(outputFiles(outputDir)).To(ConsistOf("application-cache-team-a-test-object.yaml"))
+			Expect(os.ReadFile(filepath.Join(outputDir, "application-cache-team-a-test-object.yaml"))).To(MatchYAML(`apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: cache-team-a-test-object
+  namespace: argocd
+  finalizers:
+  - resources-finalizer.argocd.argoproj.io
+  labels:
+    kratix.io/resource-name: test-object
+    kratix.io/promise-name: cache
+spec:
+  project: default
+  source:
+    repoURL: registry.example.com/charts
+    chart: cache
+    targetRevision: "*"
+    helm:
+      releaseName: test-object
+      valuesObject:
+        replicas: 3
+        image:
+          registry: evil.example.com
+  destination:
+    server: https://kubernetes.default.svc
+    namespace: team-a
+  syncPolicy:
+    automated:
+      prune: true
+      selfHeal: true
+    syncOptions:
+    - CreateNamespace=true
+`))
+
+			status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(ContainSubstring("message: Helm release test-object delivered as an Argo CD Application"))
+			Expect(status).NotTo(ContainSubstring("version:"))
+		})
+	})
+
+	It("fails when the delivery is not supported", func() {
+		envVars["DELIVERY"] = "kustomize"
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say(`unsupported DELIVERY "kustomize": expected one of rendered, flux, argocd`))
+	})
+
+	It("tries to read from /kratix/input/object.yaml if KRATIX_INPUT_FILE is not set", func() {
+		delete(envVars, "KRATIX_INPUT_FILE")
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("Failed to read object file from /kratix/input/object.yaml"))
+	})
+})
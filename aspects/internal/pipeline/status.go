@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// WriteStatus merges the status fields into the status.yaml file in the
+// metadata directory, which Kratix copies to the status of the request
+func WriteStatus(status map[string]any) error {
+	metadataDir := os.Getenv("KRATIX_METADATA_DIR")
+	if metadataDir == "" {
+		metadataDir = "/kratix/metadata"
+	}
+	statusFile := filepath.Join(metadataDir, "status.yaml")
+
+	merged := map[string]any{}
+	if contents, err := os.ReadFile(statusFile); err == nil {
+		if err := yaml.Unmarshal(contents, &merged); err != nil {
+			return fmt.Errorf("Failed to unmarshal status file %s: %w", statusFile, err)
+		}
+		if merged == nil {
+			merged = map[string]any{}
+		}
+	}
+	for key, value := range status {
+		merged[key] = value
+	}
+
+	statusBytes, err := yaml.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal status: %w", err)
+	}
+	if err := os.WriteFile(statusFile, statusBytes, 0644); err != nil {
+		return fmt.Errorf("Failed to write status file to %s: %w", statusFile, err)
+	}
+	return nil
+}
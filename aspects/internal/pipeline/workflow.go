@@ -0,0 +1,15 @@
+// Package pipeline holds the helpers the aspects share to run in the
+// containers of Kratix pipelines
+package pipeline
+
+import "os"
+
+// WorkflowActionDelete is the KRATIX_WORKFLOW_ACTION of delete workflows
+const WorkflowActionDelete = "delete"
+
+// IsDeleteWorkflow returns whether the aspect runs in a delete workflow. The
+// output of delete workflows is not scheduled: Kratix removes the documents
+// written by the configure workflow from the destinations once it completes.
+func IsDeleteWorkflow() bool {
+	return os.Getenv("KRATIX_WORKFLOW_ACTION") == WorkflowActionDelete
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"log"
+	"os"
 
+	"github.com/syntasso/kratix-cli/aspects/defaults"
 	"github.com/syntasso/kratix-cli/aspects/helm-promise/lib"
 )
 
@@ -11,7 +13,14 @@ func main() {
 	operatorVersion := lib.GetEnvOrDie("OPERATOR_VERSION")
 	operatorKind := lib.GetEnvOrDie("OPERATOR_KIND")
 
-	err := lib.TransformInputToOutput(operatorGroup, operatorVersion, operatorKind)
+	specDefaults, err := defaults.SpecFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	err = lib.TransformInputToOutput(operatorGroup, operatorVersion, operatorKind, lib.TransformOptions{
+		SpecDefaults: specDefaults,
+	})
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
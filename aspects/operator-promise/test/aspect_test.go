@@ -1,12 +1,15 @@
 package run_test
 
 import (
+	"os"
 	"os/exec"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
+	"sigs.k8s.io/yaml"
 )
 
 var expectedOutput = `apiVersion: example.com/v1
@@ -41,24 +44,84 @@ func runWithEnv(envVars map[string]string) *gexec.Session {
 
 var _ = Describe("From Operator to Promise Aspect", func() {
 	var (
-		envVars map[string]string
+		envVars     map[string]string
+		metadataDir string
 	)
 
 	BeforeEach(func() {
+		var err error
+		metadataDir, err = os.MkdirTemp("", "kratix-metadata")
+		Expect(err).NotTo(HaveOccurred())
 		envVars = map[string]string{
-			"KRATIX_INPUT_FILE":  "assets/test-object.yaml",
-			"KRATIX_OUTPUT_FILE": "/dev/stdout",
-			"OPERATOR_GROUP":     "example.com",
-			"OPERATOR_VERSION":   "v1",
-			"OPERATOR_KIND":      "Example",
+			"KRATIX_INPUT_FILE":   "assets/test-object.yaml",
+			"KRATIX_OUTPUT_FILE":  "/dev/stdout",
+			"KRATIX_METADATA_DIR": metadataDir,
+			"OPERATOR_GROUP":      "example.com",
+			"OPERATOR_VERSION":    "v1",
+			"OPERATOR_KIND":       "Example",
 		}
 	})
 
+	AfterEach(func() {
+		os.RemoveAll(metadataDir)
+	})
+
 	It("creates an object file in the output directory", func() {
 		session := runWithEnv(envVars)
 		Expect(session.Out).To(gbytes.Say(expectedOutput))
 	})
 
+	It("writes a reference to the object to the status", func() {
+		Expect(os.WriteFile(filepath.Join(metadataDir, "status.yaml"), []byte("previous: step\n"), 0644)).To(Succeed())
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+
+		status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(MatchYAML(`message: Example test-object requested
+previous: step
+resourceRef:
+  apiVersion: example.com/v1
+  kind: Example
+  name: test-object
+  namespace: default
+`))
+	})
+
+	It("sets the spec defaults the request does not set", func() {
+		envVars["OPERATOR_SPEC_DEFAULTS"] = `{"field":"default","nested":{"field":"default","other":"default"},"replicas":3}`
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(0))
+		var output map[string]any
+		Expect(yaml.Unmarshal(session.Out.Contents(), &output)).To(Succeed())
+		Expect(output["spec"]).To(Equal(map[string]any{
+			"arr":      []any{map[string]any{"field": "value"}},
+			"field":    "value",
+			"nested":   map[string]any{"field": "value", "other": "default"},
+			"number":   float64(7),
+			"replicas": float64(3),
+		}))
+	})
+
+	It("fails when the spec defaults are not valid JSON", func() {
+		envVars["OPERATOR_SPEC_DEFAULTS"] = "replicas: 3"
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("parsing OPERATOR_SPEC_DEFAULTS"))
+	})
+
+	It("writes nothing in a delete workflow", func() {
+		envVars["KRATIX_WORKFLOW_ACTION"] = "delete"
+		delete(envVars, "KRATIX_OUTPUT_FILE")
+		session := runWithEnv(envVars)
+
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Example test-object will be deleted when it is removed from the destination"))
+		Expect(filepath.Join(metadataDir, "status.yaml")).NotTo(BeAnExistingFile())
+	})
+
 	It("tries to read from /kratix/input/object.yaml if KRATIX_INPUT_FILE is not set", func() {
 		delete(envVars, "KRATIX_INPUT_FILE")
 		session := runWithEnv(envVars)
@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ModuleConfig is the Promise-level configuration of the generated Terraform
+type ModuleConfig struct {
+	Source           string
+	Version          string
+	Backend          string
+	BackendConfig    map[string]any
+	Providers        map[string]map[string]any
+	Outputs          []string
+	SensitiveOutputs []string
+}
+
+// ModuleConfigFromEnv reads the module configuration from the environment
+// variables set on the aspect container by `kratix init tf-module-promise`
+func ModuleConfigFromEnv(getenv func(string) string) (ModuleConfig, error) {
+	config := ModuleConfig{
+		Source:           getenv("MODULE_SOURCE"),
+		Version:          getenv("MODULE_VERSION"),
+		Backend:          getenv("TERRAFORM_BACKEND"),
+		Outputs:          splitList(getenv("MODULE_OUTPUTS")),
+		SensitiveOutputs: splitList(getenv("MODULE_SENSITIVE_OUTPUTS")),
+	}
+
+	if backendConfig := getenv("TERRAFORM_BACKEND_CONFIG"); backendConfig != "" {
+		if err := json.Unmarshal([]byte(backendConfig), &config.BackendConfig); err != nil {
+			return ModuleConfig{}, fmt.Errorf("parsing TERRAFORM_BACKEND_CONFIG: %w", err)
+		}
+	}
+	if providers := getenv("TERRAFORM_PROVIDERS"); providers != "" {
+		if err := json.Unmarshal([]byte(providers), &config.Providers); err != nil {
+			return ModuleConfig{}, fmt.Errorf("parsing TERRAFORM_PROVIDERS: %w", err)
+		}
+	}
+	return config, nil
+}
+
+// GenerateModule returns the name and the contents of the Terraform JSON file
+// calling the configured module with the spec of the request as inputs.
+// Registry modules are pinned with the version argument and git sources are
+// checked out at the version ref. The file also
+// configures the state backend, with a state key unique to the request, the
+// providers and an output for each module output.
+func GenerateModule(request map[string]any, config ModuleConfig) (string, []byte, error) {
+	uniqueFileName, err := uniqueRequestName(request)
+	if err != nil {
+		return "", nil, err
+	}
+
+	moduleBlock := map[string]any{}
+	if _, ok := ParseRegistryModule(config.Source); ok {
+		moduleBlock["source"] = config.Source
+		if config.Version != "" {
+			moduleBlock["version"] = config.Version
+		}
+	} else {
+		source, err := VersionedModuleSource(config.Source, config.Version)
+		if err != nil {
+			return "", nil, err
+		}
+		moduleBlock["source"] = source
+	}
+
+	// Handle spec if it exists
+	if spec, ok := request["spec"].(map[string]any); ok {
+		for key, value := range spec {
+			valSlice, ok := value.([]any)
+			// 1. if its not an array and its not nil, add it to the module
+			// 2. if its an array and its not empty, add it to the module
+			// this gets around adding a bunch of empty arrays to the module
+			if (!ok && value != nil) || (ok && len(valSlice) > 0) {
+				moduleBlock[key] = value
+			}
+		}
+	}
+
+	module := map[string]any{
+		"module": map[string]any{
+			uniqueFileName: moduleBlock,
+		},
+	}
+
+	if config.Backend != "" {
+		module["terraform"] = map[string]any{
+			"backend": map[string]any{
+				config.Backend: backendWithStateKey(config.Backend, config.BackendConfig, uniqueFileName),
+			},
+		}
+	}
+
+	if len(config.Providers) > 0 {
+		providers := map[string]any{}
+		for provider, providerConfig := range config.Providers {
+			if providerConfig == nil {
+				providerConfig = map[string]any{}
+			}
+			providers[provider] = providerConfig
+		}
+		module["provider"] = providers
+	}
+
+	if len(config.Outputs) > 0 {
+		outputs := map[string]any{}
+		for _, output := range config.Outputs {
+			outputBlock := map[string]any{
+				"value": fmt.Sprintf("${module.%s.%s}", uniqueFileName, output),
+			}
+			for _, sensitive := range config.SensitiveOutputs {
+				if sensitive == output {
+					outputBlock["sensitive"] = true
+				}
+			}
+			outputs[output] = outputBlock
+		}
+		module["output"] = outputs
+	}
+
+	jsonData, err := json.MarshalIndent(module, "", "  ")
+	if err != nil {
+		return "", nil, fmt.Errorf("generating JSON: %w", err)
+	}
+
+	return uniqueFileName + ".tf.json", jsonData, nil
+}
+
+// ModuleStatus returns the status of the request: the outputs of the module
+// and, when a backend is configured, the key of the state of the request
+func ModuleStatus(request map[string]any, config ModuleConfig) (map[string]any, error) {
+	uniqueName, err := uniqueRequestName(request)
+	if err != nil {
+		return nil, err
+	}
+
+	status := map[string]any{
+		"message": fmt.Sprintf("Terraform module %s configured", config.Source),
+	}
+	if len(config.Outputs) > 0 {
+		status["outputs"] = config.Outputs
+	}
+	if attribute, ok := stateKeyAttributes[config.Backend]; ok {
+		status["stateKey"] = backendWithStateKey(config.Backend, config.BackendConfig, uniqueName)[attribute]
+	}
+	return status, nil
+}
+
+func uniqueRequestName(request map[string]any) (string, error) {
+	metadata, ok := request["metadata"].(map[string]any)
+	if !ok {
+		return "", errors.New("metadata section not found in YAML file")
+	}
+
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	kind, _ := request["kind"].(string)
+
+	if namespace == "" || name == "" || kind == "" {
+		return "", errors.New("metadata.namespace, metadata.name, or kind is missing")
+	}
+
+	return strings.ToLower(fmt.Sprintf("%s_%s_%s", kind, namespace, name)), nil
+}
+
+// stateKeyAttributes are the backend attributes that locate the state. When
+// set in the backend configuration, they are used as a prefix.
+var stateKeyAttributes = map[string]string{
+	"s3":         "key",
+	"azurerm":    "key",
+	"oss":        "key",
+	"cos":        "key",
+	"gcs":        "prefix",
+	"consul":     "path",
+	"local":      "path",
+	"pg":         "schema_name",
+	"kubernetes": "secret_suffix",
+}
+
+func backendWithStateKey(backend string, backendConfig map[string]any, uniqueName string) map[string]any {
+	config := map[string]any{}
+	for key, value := range backendConfig {
+		config[key] = value
+	}
+
+	attribute, ok := stateKeyAttributes[backend]
+	if !ok {
+		return config
+	}
+	prefix, _ := config[attribute].(string)
+
+	switch backend {
+	case "s3", "azurerm", "oss", "cos", "local":
+		config[attribute] = path.Join(prefix, uniqueName+".tfstate")
+	case "kubernetes", "pg":
+		// used in resource names, which do not allow underscores
+		config[attribute] = strings.Trim(prefix+"-"+strings.ReplaceAll(uniqueName, "_", "-"), "-")
+	default:
+		config[attribute] = path.Join(prefix, uniqueName)
+	}
+	return config
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
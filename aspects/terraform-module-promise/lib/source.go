@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultRegistryHost is the host of registry addresses without a hostname
+const DefaultRegistryHost = "registry.terraform.io"
+
+// registry addresses are [HOSTNAME/]NAMESPACE/NAME/PROVIDER[//SUBDIR]
+var registryAddress = regexp.MustCompile(`^(?:([a-zA-Z0-9.-]+\.[a-zA-Z0-9-]+(?::[0-9]+)?)/)?([a-zA-Z0-9][a-zA-Z0-9_-]*)/([a-zA-Z0-9][a-zA-Z0-9_-]*)/([a-zA-Z0-9]+)(?://(.+))?$`)
+
+// hosts that look like registry hosts but are handled by go-getter detectors
+var vcsHosts = []string{"github.com", "bitbucket.org", "gitlab.com"}
+
+// git repository URLs end in .git, before the subdirectory and query
+var gitRepository = regexp.MustCompile(`\.git(?:$|//|\?)`)
+
+// hosts of git repositories, addressed with or without a scheme
+var gitHosts = []string{"github.com", "bitbucket.org"}
+
+// RegistryModule is a module address in a Terraform module registry
+type RegistryModule struct {
+	Host      string
+	Namespace string
+	Name      string
+	Provider  string
+	Subdir    string
+}
+
+// ParseRegistryModule returns the registry module for registry addresses
+// such as terraform-aws-modules/vpc/aws, and false for any other source
+func ParseRegistryModule(source string) (RegistryModule, bool) {
+	match := registryAddress.FindStringSubmatch(source)
+	if match == nil {
+		return RegistryModule{}, false
+	}
+
+	module := RegistryModule{
+		Host:      match[1],
+		Namespace: match[2],
+		Name:      match[3],
+		Provider:  match[4],
+		Subdir:    match[5],
+	}
+	for _, host := range vcsHosts {
+		if strings.EqualFold(module.Host, host) {
+			return RegistryModule{}, false
+		}
+	}
+	if module.Host == "" {
+		module.Host = DefaultRegistryHost
+	}
+	return module, true
+}
+
+// VersionedModuleSource returns the source of a module that is not in a
+// registry. Git sources with a version are checked out at that ref; sources
+// without one are used as they are. Other sources cannot be versioned.
+func VersionedModuleSource(source, version string) (string, error) {
+	if version == "" {
+		return source, nil
+	}
+	if !isGitModuleSource(source) {
+		return "", fmt.Errorf("a module version can only be set for registry and git modules, not %s", source)
+	}
+
+	if !strings.HasPrefix(source, "git::") {
+		source = "git::" + source
+	}
+	separator := "?"
+	if strings.Contains(source, "?") {
+		separator = "&"
+	}
+	return source + separator + "ref=" + version, nil
+}
+
+// isGitModuleSource returns whether the source is a git repository that can be
+// checked out at a ref: forced git sources, URLs of .git repositories and GitHub or Bitbucket
+// repositories such as github.com/org/repo
+func isGitModuleSource(source string) bool {
+	if strings.HasPrefix(source, "git::") {
+		return true
+	}
+	if strings.Contains(source, "::") {
+		return false
+	}
+	if gitRepository.MatchString(source) {
+		return true
+	}
+	address := strings.TrimPrefix(strings.TrimPrefix(source, "https://"), "http://")
+	for _, host := range gitHosts {
+		if strings.HasPrefix(address, host+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,21 +1,25 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 
+	"github.com/syntasso/kratix-cli/aspects/internal/pipeline"
+	"github.com/syntasso/kratix-cli/aspects/terraform-module-promise/lib"
 	"gopkg.in/yaml.v3"
 )
 
 func main() {
 	yamlFile := GetEnv("KRATIX_INPUT_FILE", "/kratix/input/object.yaml")
 	outputDir := GetEnv("KRATIX_OUTPUT_DIR", "/kratix/output")
-	moduleSource := MustHaveEnv("MODULE_SOURCE")
-	moduleVersion := MustHaveEnv("MODULE_VERSION")
+	MustHaveEnv("MODULE_SOURCE")
+
+	config, err := lib.ModuleConfigFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
 
 	yamlContent, err := os.ReadFile(yamlFile)
 	if err != nil {
@@ -28,45 +32,14 @@ func main() {
 		log.Fatalf("Error parsing YAML file: %v\n", err)
 	}
 
-	metadata, ok := data["metadata"].(map[string]any)
-	if !ok {
-		log.Fatalf("Error: metadata section not found in YAML file")
-	}
-
-	namespace, _ := metadata["namespace"].(string)
-	name, _ := metadata["name"].(string)
-	kind, _ := data["kind"].(string)
-
-	if namespace == "" || name == "" || kind == "" {
-		log.Fatalf("Error: metadata.namespace, metadata.name, or kind is missing")
-	}
-
-	uniqueFileName := strings.ToLower(fmt.Sprintf("%s_%s_%s", kind, namespace, name))
-
-	module := map[string]map[string]map[string]any{
-		"module": {
-			uniqueFileName: {
-				"source": fmt.Sprintf("git::%s?ref=%s", moduleSource, moduleVersion),
-			},
-		},
-	}
-
-	// Handle spec if it exists
-	if spec, ok := data["spec"].(map[string]any); ok {
-		for key, value := range spec {
-			valSlice, ok := value.([]any)
-			// 1. if its not an array and its not nil, add it to the module
-			// 2. if its an array and its not empty, add it to the module
-			// this gets around adding a bunch of empty arrays to the module
-			if (!ok && value != nil) || (ok && len(valSlice) > 0) {
-				module["module"][uniqueFileName][key] = value
-			}
-		}
+	fileName, jsonData, err := lib.GenerateModule(data, config)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
 	}
 
-	jsonData, err := json.MarshalIndent(module, "", "  ")
-	if err != nil {
-		log.Fatalf("Error generating JSON: %v\n", err)
+	if pipeline.IsDeleteWorkflow() {
+		fmt.Printf("Terraform configuration %s will be removed from the destination\n", fileName)
+		return
 	}
 
 	err = os.MkdirAll(outputDir, os.ModePerm)
@@ -74,13 +47,21 @@ func main() {
 		log.Fatalf("Error creating output directory: %v\n", err)
 	}
 
-	path := filepath.Join(outputDir, uniqueFileName+".tf.json")
+	path := filepath.Join(outputDir, fileName)
 	err = os.WriteFile(path, jsonData, 0644)
 	if err != nil {
 		log.Fatalf("Error writing Terraform JSON file: %v\n", err)
 	}
 
 	fmt.Printf("Terraform JSON configuration written to %s\n", path)
+
+	status, err := lib.ModuleStatus(data, config)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := pipeline.WriteStatus(status); err != nil {
+		log.Fatalf("Error writing status: %v\n", err)
+	}
 }
 
 // GetEnv retrieves an environment variable or returns a default value if not set
@@ -63,25 +63,30 @@ func runWithEnv(envVars map[string]string) *gexec.Session {
 
 var _ = Describe("From TF module to Promise Aspect", func() {
 	var (
-		envVars map[string]string
-		tmpDir  string
+		envVars     map[string]string
+		tmpDir      string
+		metadataDir string
 	)
 
 	BeforeEach(func() {
 		var err error
 		tmpDir, err = os.MkdirTemp("", "kratix")
 		Expect(err).NotTo(HaveOccurred())
+		metadataDir, err = os.MkdirTemp("", "kratix-metadata")
+		Expect(err).NotTo(HaveOccurred())
 		envVars = map[string]string{
-			"KRATIX_INPUT_FILE": "assets/test-object.yaml",
-			"KRATIX_OUTPUT_DIR": tmpDir,
-			"MODULE_SOURCE":     "example.com",
-			"MODULE_VERSION":    "1.0.0",
+			"KRATIX_INPUT_FILE":   "assets/test-object.yaml",
+			"KRATIX_OUTPUT_DIR":   tmpDir,
+			"KRATIX_METADATA_DIR": metadataDir,
+			"MODULE_SOURCE":       "git::example.com",
+			"MODULE_VERSION":      "1.0.0",
 		}
 
 	})
 
 	AfterEach(func() {
 		os.RemoveAll(tmpDir)
+		os.RemoveAll(metadataDir)
 	})
 
 	It("creates an object file in the output directory", func() {
@@ -104,4 +109,140 @@ var _ = Describe("From TF module to Promise Aspect", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(string(output)).To(MatchJSON(expectedOutputNoSpec))
 	})
+
+	It("pins registry modules with the version argument", func() {
+		envVars["KRATIX_INPUT_FILE"] = "assets/test-object-no-spec.yaml"
+		envVars["MODULE_SOURCE"] = "terraform-aws-modules/vpc/aws"
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+		output, err := os.ReadFile(filepath.Join(tmpDir, "testobject_non-default_test-object.tf.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(MatchJSON(`{
+  "module": {
+    "testobject_non-default_test-object": {
+      "source": "terraform-aws-modules/vpc/aws",
+      "version": "1.0.0"
+    }
+  }
+}`))
+	})
+
+	It("uses sources as they are when no version is set", func() {
+		envVars["KRATIX_INPUT_FILE"] = "assets/test-object-no-spec.yaml"
+		envVars["MODULE_SOURCE"] = "s3::https://s3.amazonaws.com/bucket/vpc.zip"
+		delete(envVars, "MODULE_VERSION")
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+		output, err := os.ReadFile(filepath.Join(tmpDir, "testobject_non-default_test-object.tf.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(MatchJSON(`{
+  "module": {
+    "testobject_non-default_test-object": {
+      "source": "s3::https://s3.amazonaws.com/bucket/vpc.zip"
+    }
+  }
+}`))
+	})
+
+	It("configures the backend, the providers and the module outputs", func() {
+		envVars["KRATIX_INPUT_FILE"] = "assets/test-object-no-spec.yaml"
+		envVars["TERRAFORM_BACKEND"] = "s3"
+		envVars["TERRAFORM_BACKEND_CONFIG"] = `{"bucket": "tf-state", "key": "promises/test"}`
+		envVars["TERRAFORM_PROVIDERS"] = `{"aws": {"region": "eu-west-2"}, "random": {}}`
+		envVars["MODULE_OUTPUTS"] = "id,password"
+		envVars["MODULE_SENSITIVE_OUTPUTS"] = "password"
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+		output, err := os.ReadFile(filepath.Join(tmpDir, "testobject_non-default_test-object.tf.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(MatchJSON(`{
+  "module": {
+    "testobject_non-default_test-object": {
+      "source": "git::example.com?ref=1.0.0"
+    }
+  },
+  "terraform": {
+    "backend": {
+      "s3": {
+        "bucket": "tf-state",
+        "key": "promises/test/testobject_non-default_test-object.tfstate"
+      }
+    }
+  },
+  "provider": {
+    "aws": {
+      "region": "eu-west-2"
+    },
+    "random": {}
+  },
+  "output": {
+    "id": {
+      "value": "${module.testobject_non-default_test-object.id}"
+    },
+    "password": {
+      "value": "${module.testobject_non-default_test-object.password}",
+      "sensitive": true
+    }
+  }
+}`))
+	})
+
+	It("writes the module outputs and the state key to the status", func() {
+		envVars["TERRAFORM_BACKEND"] = "s3"
+		envVars["TERRAFORM_BACKEND_CONFIG"] = `{"bucket": "tf-state"}`
+		envVars["MODULE_OUTPUTS"] = "id,password"
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+
+		status, err := os.ReadFile(filepath.Join(metadataDir, "status.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(MatchYAML(`message: Terraform module git::example.com configured
+outputs:
+- id
+- password
+stateKey: testobject_non-default_test-object.tfstate
+`))
+	})
+
+	It("writes nothing in a delete workflow", func() {
+		envVars["KRATIX_WORKFLOW_ACTION"] = "delete"
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Terraform configuration testobject_non-default_test-object.tf.json will be removed from the destination"))
+
+		Expect(filepath.Join(tmpDir, "testobject_non-default_test-object.tf.json")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(metadataDir, "status.yaml")).NotTo(BeAnExistingFile())
+	})
+
+	It("uses a state key unique to the request for each backend", func() {
+		envVars["KRATIX_INPUT_FILE"] = "assets/test-object-no-spec.yaml"
+		envVars["TERRAFORM_BACKEND"] = "kubernetes"
+		envVars["TERRAFORM_BACKEND_CONFIG"] = `{"namespace": "flux-system"}`
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(0))
+		output, err := os.ReadFile(filepath.Join(tmpDir, "testobject_non-default_test-object.tf.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(MatchJSON(`{
+  "module": {
+    "testobject_non-default_test-object": {
+      "source": "git::example.com?ref=1.0.0"
+    }
+  },
+  "terraform": {
+    "backend": {
+      "kubernetes": {
+        "namespace": "flux-system",
+        "secret_suffix": "testobject-non-default-test-object"
+      }
+    }
+  }
+}`))
+	})
+
+	It("fails when the backend configuration is invalid", func() {
+		envVars["TERRAFORM_BACKEND_CONFIG"] = `not-json`
+		session := runWithEnv(envVars)
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("parsing TERRAFORM_BACKEND_CONFIG"))
+	})
 })
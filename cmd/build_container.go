@@ -244,6 +244,10 @@ func RetrievePipeline(promise *v1alpha1.Promise, c *ContainerCmdArgs) (*v1alpha1
 		return nil, err
 	}
 
+	if pipelineIdx == -1 {
+		return nil, fmt.Errorf("pipeline %s not found in the %s/%s workflow", c.Pipeline, c.Lifecycle, c.Action)
+	}
+
 	return &pipelines[pipelineIdx], nil
 }
 
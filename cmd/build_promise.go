@@ -33,65 +33,114 @@ func init() {
 }
 
 func BuildPromise(cmd *cobra.Command, args []string) error {
-	promiseName := args[0]
-	promise, err := LoadPromiseWithWorkflows(inputDir)
+	promise, err := buildPromise(inputDir, args[0])
 	if err != nil {
 		return err
 	}
+
+	promiseBytes, err := yaml.Marshal(promise)
+	if err != nil {
+		return err
+	}
+
+	if outputPath != "" {
+		return os.WriteFile(outputPath, promiseBytes, filePerm)
+	}
+
+	fmt.Println(string(promiseBytes))
+	return nil
+}
+
+// buildPromise merges the files of a Promise initialised with --split into a
+// Promise. The name is taken from metadata.yaml when promiseName is empty.
+func buildPromise(dir, promiseName string) (*v1alpha1.Promise, error) {
+	promise, err := LoadPromiseWithWorkflows(dir)
+	if err != nil {
+		return nil, err
+	}
 	promise.Kind = "Promise"
 	promise.APIVersion = v1alpha1.GroupVersion.Group + "/" + v1alpha1.GroupVersion.Version
-	promise.Name = promiseName
 
-	if _, err := os.Stat(filepath.Join(inputDir, apiFileName)); err == nil {
+	if fileExists(filepath.Join(dir, metadataFileName)) {
+		metadataBytes, err := os.ReadFile(filepath.Join(dir, metadataFileName))
+		if err != nil {
+			return nil, err
+		}
+
+		var metadata metav1.ObjectMeta
+		if err = yaml.Unmarshal(metadataBytes, &metadata); err != nil {
+			return nil, err
+		}
+		promise.Name = metadata.Name
+		promise.Labels = metadata.Labels
+		promise.Annotations = metadata.Annotations
+	}
+
+	if promiseName != "" {
+		promise.Name = promiseName
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, apiFileName)); err == nil {
 		var apiBytes []byte
-		apiBytes, err = os.ReadFile(filepath.Join(inputDir, apiFileName))
+		apiBytes, err = os.ReadFile(filepath.Join(dir, apiFileName))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if len(apiBytes) > 0 {
 			var crd apiextensionsv1.CustomResourceDefinition
 			err = yaml.Unmarshal(apiBytes, &crd)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			var crdBytes []byte
 			crdBytes, err = json.Marshal(crd)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			promise.Spec.API = &runtime.RawExtension{Raw: crdBytes}
 		}
 	}
 
-	if _, err := os.Stat(filepath.Join(inputDir, dependenciesFileName)); err == nil {
+	if _, err := os.Stat(filepath.Join(dir, dependenciesFileName)); err == nil {
 		var dependencyBytes []byte
-		dependencyBytes, err = os.ReadFile(filepath.Join(inputDir, dependenciesFileName))
+		dependencyBytes, err = os.ReadFile(filepath.Join(dir, dependenciesFileName))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		var dependencies v1alpha1.Dependencies
 		err = yaml.Unmarshal(dependencyBytes, &dependencies)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		promise.Spec.Dependencies = dependencies
 	}
 
-	promiseBytes, err := yaml.Marshal(promise)
-	if err != nil {
-		return err
+	if fileExists(filepath.Join(dir, destinationSelectorsFileName)) {
+		selectors, err := getDestinationSelectors(filepath.Join(dir, destinationSelectorsFileName))
+		if err != nil {
+			return nil, err
+		}
+		promise.Spec.DestinationSelectors = selectors
 	}
 
-	if outputPath != "" {
-		return os.WriteFile(outputPath, promiseBytes, filePerm)
+	if fileExists(filepath.Join(dir, requiredPromisesFileName)) {
+		requiredPromisesBytes, err := os.ReadFile(filepath.Join(dir, requiredPromisesFileName))
+		if err != nil {
+			return nil, err
+		}
+
+		var requiredPromises []v1alpha1.RequiredPromise
+		if err = yaml.Unmarshal(requiredPromisesBytes, &requiredPromises); err != nil {
+			return nil, err
+		}
+		promise.Spec.RequiredPromises = requiredPromises
 	}
 
-	fmt.Println(string(promiseBytes))
-	return nil
+	return promise, nil
 }
 
 func newPromise(promiseName string) v1alpha1.Promise {
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert --to split|flat",
+	Short: "Command to convert a Promise between the flat and the split layouts",
+	Long: `Command to convert a Promise between the flat and the split layouts.
+
+Converting to the split layout writes the API to api.yaml, the dependencies to
+dependencies.yaml and each workflow to workflows/LIFECYCLE/ACTION/workflow.yaml.
+The Promise metadata, destination selectors and required Promises are written to
+metadata.yaml, destination-selectors.yaml and required-promises.yaml. The
+promise.yaml file is removed.
+
+Converting to the flat layout builds promise.yaml from those files, as 'kratix
+build promise' does, and removes them. The Promise name is read from
+metadata.yaml unless --name is set.`,
+	Example: `  # convert a Promise in the current directory to the split layout
+  kratix convert --to split
+
+  # convert a Promise initialised with --split back to promise.yaml
+  kratix convert --to flat --name postgresql --dir path/to/promise`,
+	Args: cobra.NoArgs,
+	RunE: ConvertPromise,
+}
+
+var convertTo, convertName string
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringVarP(&dir, "dir", "d", ".", "Directory to read the Promise from")
+	convertCmd.Flags().StringVar(&convertTo, "to", "", "The layout to convert the Promise to; one of split or flat")
+	convertCmd.Flags().StringVarP(&convertName, "name", "n", "", "Name of the Promise when converting to the flat layout. Defaults to the name in metadata.yaml")
+	convertCmd.MarkFlagRequired("to")
+}
+
+func ConvertPromise(cmd *cobra.Command, args []string) error {
+	switch convertTo {
+	case "split":
+		return convertToSplit()
+	case "flat":
+		return convertToFlat()
+	}
+	return fmt.Errorf("unsupported layout %q: must be one of split or flat", convertTo)
+}
+
+func convertToSplit() error {
+	if !fileExists(filepath.Join(dir, promiseFileName)) {
+		return fmt.Errorf("failed to find %s in directory; the Promise may already use the split layout", promiseFileName)
+	}
+
+	promise, err := getPromise(filepath.Join(dir, promiseFileName))
+	if err != nil {
+		return err
+	}
+
+	files := map[string]any{}
+
+	var apiBytes []byte
+	if promise.Spec.API != nil {
+		crd, err := promise.GetAPIAsCRD()
+		if err != nil {
+			return err
+		}
+		if apiBytes, err = yaml.Marshal(crd); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, apiFileName), apiBytes, filePerm); err != nil {
+		return err
+	}
+
+	var dependencyBytes []byte
+	if len(promise.Spec.Dependencies) > 0 {
+		if dependencyBytes, err = yaml.Marshal(promise.Spec.Dependencies); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, dependenciesFileName), dependencyBytes, filePerm); err != nil {
+		return err
+	}
+
+	workflows := map[string]map[string][]unstructured.Unstructured{
+		"promise":  {"configure": promise.Spec.Workflows.Promise.Configure, "delete": promise.Spec.Workflows.Promise.Delete},
+		"resource": {"configure": promise.Spec.Workflows.Resource.Configure, "delete": promise.Spec.Workflows.Resource.Delete},
+	}
+	for lifecycle, actions := range workflows {
+		for action, pipelines := range actions {
+			if len(pipelines) == 0 {
+				continue
+			}
+			workflowDir := filepath.Join(dir, "workflows", lifecycle, action)
+			if err := os.MkdirAll(workflowDir, os.ModePerm); err != nil {
+				return err
+			}
+			var objects []map[string]any
+			for _, pipeline := range pipelines {
+				objects = append(objects, pipeline.Object)
+			}
+			files[filepath.Join("workflows", lifecycle, action, "workflow.yaml")] = objects
+		}
+	}
+
+	metadata := map[string]any{"name": promise.GetName()}
+	if len(promise.GetLabels()) > 0 {
+		metadata["labels"] = promise.GetLabels()
+	}
+	if len(promise.GetAnnotations()) > 0 {
+		metadata["annotations"] = promise.GetAnnotations()
+	}
+	files[metadataFileName] = metadata
+
+	if len(promise.Spec.DestinationSelectors) > 0 {
+		files[destinationSelectorsFileName] = promise.Spec.DestinationSelectors
+	}
+	if len(promise.Spec.RequiredPromises) > 0 {
+		files[requiredPromisesFileName] = promise.Spec.RequiredPromises
+	}
+
+	for file, data := range files {
+		if err := writeYAML(filepath.Join(dir, file), data); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, promiseFileName)); err != nil {
+		return err
+	}
+
+	fmt.Println("Promise converted to the split layout")
+	return nil
+}
+
+func convertToFlat() error {
+	if fileExists(filepath.Join(dir, promiseFileName)) {
+		return fmt.Errorf("%s already exists in directory; the Promise already uses the flat layout", promiseFileName)
+	}
+	if !filesGeneratedWithSplit(dir) {
+		return fmt.Errorf("failed to find %s and %s in directory. Please run 'kratix init promise --split' first", apiFileName, dependenciesFileName)
+	}
+
+	promise, err := buildPromise(dir, convertName)
+	if err != nil {
+		return err
+	}
+	if promise.GetName() == "" {
+		return fmt.Errorf("the Promise has no name: set --name or add it to %s", metadataFileName)
+	}
+
+	if err := writeYAML(filepath.Join(dir, promiseFileName), promise); err != nil {
+		return err
+	}
+
+	splitFiles := []string{apiFileName, dependenciesFileName, metadataFileName, destinationSelectorsFileName, requiredPromisesFileName}
+	for _, lifecycle := range []string{"promise", "resource"} {
+		for _, action := range []string{"configure", "delete"} {
+			splitFiles = append(splitFiles, filepath.Join("workflows", lifecycle, action, "workflow.yaml"))
+		}
+	}
+	for _, file := range splitFiles {
+		if err := os.Remove(filepath.Join(dir, file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	fmt.Println("Promise converted to the flat layout")
+	return nil
+}
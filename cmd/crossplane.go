@@ -1,15 +1,24 @@
 package cmd
 
 import (
+	"fmt"
+	"maps"
+	"strings"
+
+	xrdv1 "github.com/crossplane/crossplane/apis/apiextensions/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 )
 
-var mandatoryAdditionalClaimFields = map[string]apiextensionsv1.JSONSchemaProps{
-	"compositeDeletePolicy": {
-		Type:    "string",
-		Enum:    []apiextensionsv1.JSON{{Raw: []byte(`"Background"`)}, {Raw: []byte(`"Foreground"`)}},
-		Default: &apiextensionsv1.JSON{Raw: []byte(`"Background"`)},
-	},
+const (
+	// XRD scopes of Crossplane v2. Crossplane v1 XRDs are LegacyCluster.
+	xrdScopeNamespaced    = "Namespaced"
+	xrdScopeCluster       = "Cluster"
+	xrdScopeLegacyCluster = "LegacyCluster"
+)
+
+// compositionFields are the fields of claims and composite resources that
+// select their Composition
+var compositionFields = map[string]apiextensionsv1.JSONSchemaProps{
 	"compositionRef": {
 		Type: "object",
 		Properties: map[string]apiextensionsv1.JSONSchemaProps{
@@ -51,34 +60,46 @@ var mandatoryAdditionalClaimFields = map[string]apiextensionsv1.JSONSchemaProps{
 			{Raw: []byte(`"Manual"`)},
 		},
 	},
-	"publishConnectionDetailsTo": {
-		Type: "object",
-		Properties: map[string]apiextensionsv1.JSONSchemaProps{
-			"configRef": {
-				Type: "object",
-				Properties: map[string]apiextensionsv1.JSONSchemaProps{
-					"name": {Type: "string"},
-				},
-				Default: &apiextensionsv1.JSON{Raw: []byte(`{"name": "default"}`)},
+}
+
+var publishConnectionDetailsToField = apiextensionsv1.JSONSchemaProps{
+	Type: "object",
+	Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"configRef": {
+			Type: "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"name": {Type: "string"},
 			},
-			"metadata": {
-				Type: "object",
-				Properties: map[string]apiextensionsv1.JSONSchemaProps{
-					"annotations": {
-						Type:                 "object",
-						AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
-					},
-					"labels": {
-						Type:                 "object",
-						AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
-					},
-					"type": {Type: "string"},
+			Default: &apiextensionsv1.JSON{Raw: []byte(`{"name": "default"}`)},
+		},
+		"metadata": {
+			Type: "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"annotations": {
+					Type:                 "object",
+					AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
+				},
+				"labels": {
+					Type:                 "object",
+					AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
 				},
+				"type": {Type: "string"},
 			},
-			"name": {Type: "string"},
 		},
-		Required: []string{"name"},
+		"name": {Type: "string"},
+	},
+	Required: []string{"name"},
+}
+
+// mandatoryAdditionalClaimFields are the fields Crossplane adds to the spec
+// of claims
+var mandatoryAdditionalClaimFields = withFields(compositionFields, map[string]apiextensionsv1.JSONSchemaProps{
+	"compositeDeletePolicy": {
+		Type:    "string",
+		Enum:    []apiextensionsv1.JSON{{Raw: []byte(`"Background"`)}, {Raw: []byte(`"Foreground"`)}},
+		Default: &apiextensionsv1.JSON{Raw: []byte(`"Background"`)},
 	},
+	"publishConnectionDetailsTo": publishConnectionDetailsToField,
 	"resourceRef": {
 		Type: "object",
 		Properties: map[string]apiextensionsv1.JSONSchemaProps{
@@ -95,4 +116,66 @@ var mandatoryAdditionalClaimFields = map[string]apiextensionsv1.JSONSchemaProps{
 		},
 		Required: []string{"name"},
 	},
+})
+
+// legacyCompositeFields are the fields Crossplane adds to the spec of the
+// cluster-scoped composite resources of Crossplane v1 XRDs, leaving out the
+// ones it sets itself. Their connection secret needs a namespace.
+var legacyCompositeFields = withFields(compositionFields, map[string]apiextensionsv1.JSONSchemaProps{
+	"publishConnectionDetailsTo": publishConnectionDetailsToField,
+	"writeConnectionSecretToRef": {
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"name":      {Type: "string"},
+			"namespace": {Type: "string"},
+		},
+		Required: []string{"name", "namespace"},
+	},
+})
+
+// compositeFields are the fields Crossplane v2 adds to the spec of composite
+// resources, which it nests under spec.crossplane
+var compositeFields = map[string]apiextensionsv1.JSONSchemaProps{
+	"crossplane": {
+		Type:       "object",
+		Properties: compositionFields,
+	},
+}
+
+func withFields(fields, additionalFields map[string]apiextensionsv1.JSONSchemaProps) map[string]apiextensionsv1.JSONSchemaProps {
+	merged := maps.Clone(fields)
+	maps.Copy(merged, additionalFields)
+	return merged
+}
+
+// xrdTarget is the object the crossplane aspect creates for each request: a
+// claim, the cluster-scoped composite resource of a Crossplane v1 XRD without
+// claims, or a Crossplane v2 namespaced or cluster-scoped composite resource
+type xrdTarget struct {
+	kind string
+	// scope is the scope of the object, Namespaced or Cluster
+	scope      string
+	specFields map[string]apiextensionsv1.JSONSchemaProps
+	// connectionSecrets is whether the object writes its connection details
+	// to a secret, which Crossplane v2 composite resources do not
+	connectionSecrets bool
+}
+
+// xrdTargetOf returns the object created for the requests to a Promise
+// generated from the XRD with the scope
+func xrdTargetOf(xrd *xrdv1.CompositeResourceDefinition, scope string) (xrdTarget, error) {
+	switch scope {
+	case xrdScopeLegacyCluster:
+		if xrd.Spec.ClaimNames != nil && xrd.Spec.ClaimNames.Kind != "" {
+			return xrdTarget{kind: xrd.Spec.ClaimNames.Kind, scope: xrdScopeNamespaced, specFields: mandatoryAdditionalClaimFields, connectionSecrets: true}, nil
+		}
+		return xrdTarget{kind: xrd.Spec.Names.Kind, scope: xrdScopeCluster, specFields: legacyCompositeFields, connectionSecrets: true}, nil
+	case xrdScopeNamespaced, xrdScopeCluster:
+		if xrd.Spec.ClaimNames != nil {
+			return xrdTarget{}, fmt.Errorf("claimNames are only supported by %s XRDs, the XRD is %s", xrdScopeLegacyCluster, scope)
+		}
+		return xrdTarget{kind: xrd.Spec.Names.Kind, scope: scope, specFields: compositeFields}, nil
+	default:
+		return xrdTarget{}, fmt.Errorf("unsupported XRD scope %q: expected one of %s", scope, strings.Join([]string{xrdScopeNamespaced, xrdScopeCluster, xrdScopeLegacyCluster}, ", "))
+	}
 }
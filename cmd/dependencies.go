@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/syntasso/kratix/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const certManagerInjectCAAnnotation = "cert-manager.io/inject-ca-from"
+
+// clusterScopedKinds are the well-known kinds that cannot be namespaced
+var clusterScopedKinds = []schema.GroupKind{
+	{Group: "", Kind: "Namespace"},
+	{Group: "", Kind: "Node"},
+	{Group: "", Kind: "PersistentVolume"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+	{Group: "apiregistration.k8s.io", Kind: "APIService"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"},
+	{Group: "storage.k8s.io", Kind: "StorageClass"},
+	{Group: "storage.k8s.io", Kind: "CSIDriver"},
+	{Group: "storage.k8s.io", Kind: "CSINode"},
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"},
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"},
+	{Group: "node.k8s.io", Kind: "RuntimeClass"},
+	{Group: "networking.k8s.io", Kind: "IngressClass"},
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"},
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"},
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"},
+	{Group: "cert-manager.io", Kind: "ClusterIssuer"},
+	{Group: "apiextensions.crossplane.io", Kind: "CompositeResourceDefinition"},
+	{Group: "apiextensions.crossplane.io", Kind: "Composition"},
+	{Group: "pkg.crossplane.io", Kind: "Provider"},
+	{Group: "pkg.crossplane.io", Kind: "Configuration"},
+	{Group: "pkg.crossplane.io", Kind: "Function"},
+}
+
+// clusterScopedKindsOf returns the kinds of the dependencies that cannot be
+// namespaced: the well-known cluster-scoped kinds and the kinds defined by the
+// cluster-scoped CRDs in the dependencies
+func clusterScopedKindsOf(dependencies []v1alpha1.Dependency) map[schema.GroupKind]bool {
+	kinds := map[schema.GroupKind]bool{}
+	for _, gk := range clusterScopedKinds {
+		kinds[gk] = true
+	}
+
+	for _, dep := range dependencies {
+		if dep.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		scope, _, _ := unstructured.NestedString(dep.Object, "spec", "scope")
+		if scope != "Cluster" {
+			continue
+		}
+		crdGroup, _, _ := unstructured.NestedString(dep.Object, "spec", "group")
+		crdKind, _, _ := unstructured.NestedString(dep.Object, "spec", "names", "kind")
+		kinds[schema.GroupKind{Group: crdGroup, Kind: crdKind}] = true
+	}
+	return kinds
+}
+
+// defaultDependencyNamespaces sets the namespace of the namespaced
+// dependencies that do not set one. Cluster-scoped dependencies are left as
+// they are.
+func defaultDependencyNamespaces(dependencies []v1alpha1.Dependency, namespace string) {
+	clusterScoped := clusterScopedKindsOf(dependencies)
+	for i := range dependencies {
+		if dependencies[i].GetNamespace() == "" && !clusterScoped[dependencies[i].GroupVersionKind().GroupKind()] {
+			dependencies[i].SetNamespace(namespace)
+		}
+	}
+}
+
+// relocateDependencies moves the namespaced dependencies to the namespace. The
+// Namespace objects and the references to the namespaces the dependencies were
+// in, such as the service accounts bound to roles and the services of webhooks,
+// are moved with them. A Namespace object is added when none is included.
+func relocateDependencies(dependencies []v1alpha1.Dependency, namespace string) []v1alpha1.Dependency {
+	clusterScoped := clusterScopedKindsOf(dependencies)
+	previousNamespaces := map[string]bool{}
+	for _, dep := range dependencies {
+		if !clusterScoped[dep.GroupVersionKind().GroupKind()] && dep.GetNamespace() != "" {
+			previousNamespaces[dep.GetNamespace()] = true
+		}
+	}
+	relocate := func(ns string) string {
+		if previousNamespaces[ns] {
+			return namespace
+		}
+		return ns
+	}
+
+	var relocated []v1alpha1.Dependency
+	hasNamespace := false
+	for _, dep := range dependencies {
+		gk := dep.GroupVersionKind().GroupKind()
+		switch {
+		case gk == schema.GroupKind{Kind: "Namespace"}:
+			dep.SetName(relocate(dep.GetName()))
+			if dep.GetName() == namespace {
+				if hasNamespace {
+					continue
+				}
+				hasNamespace = true
+			}
+		case !clusterScoped[gk]:
+			dep.SetNamespace(namespace)
+		}
+
+		relocateNamespaceReferences(&dep.Unstructured, relocate)
+		relocated = append(relocated, dep)
+	}
+
+	if !hasNamespace && namespace != "default" {
+		ns := unstructured.Unstructured{}
+		ns.SetAPIVersion("v1")
+		ns.SetKind("Namespace")
+		ns.SetName(namespace)
+		relocated = append([]v1alpha1.Dependency{{Unstructured: ns}}, relocated...)
+	}
+	return relocated
+}
+
+// relocateNamespaceReferences updates the fields of well-known kinds that
+// refer to objects in other namespaces
+func relocateNamespaceReferences(obj *unstructured.Unstructured, relocate func(string) string) {
+	if annotations := obj.GetAnnotations(); annotations[certManagerInjectCAAnnotation] != "" {
+		if ns, name, ok := strings.Cut(annotations[certManagerInjectCAAnnotation], "/"); ok {
+			annotations[certManagerInjectCAAnnotation] = relocate(ns) + "/" + name
+			obj.SetAnnotations(annotations)
+		}
+	}
+
+	relocateField := func(fields map[string]any, path ...string) {
+		if ns, found, _ := unstructured.NestedString(fields, path...); found {
+			unstructured.SetNestedField(fields, relocate(ns), path...)
+		}
+	}
+
+	switch obj.GetKind() {
+	case "RoleBinding", "ClusterRoleBinding":
+		subjects, _, _ := unstructured.NestedSlice(obj.Object, "subjects")
+		for _, subject := range subjects {
+			if subject, ok := subject.(map[string]any); ok && subject["kind"] == "ServiceAccount" {
+				relocateField(subject, "namespace")
+			}
+		}
+		unstructured.SetNestedSlice(obj.Object, subjects, "subjects")
+	case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+		webhooks, _, _ := unstructured.NestedSlice(obj.Object, "webhooks")
+		for _, webhook := range webhooks {
+			if webhook, ok := webhook.(map[string]any); ok {
+				relocateField(webhook, "clientConfig", "service", "namespace")
+			}
+		}
+		unstructured.SetNestedSlice(obj.Object, webhooks, "webhooks")
+	case "CustomResourceDefinition":
+		relocateField(obj.Object, "spec", "conversion", "webhook", "clientConfig", "service", "namespace")
+	case "APIService":
+		relocateField(obj.Object, "spec", "service", "namespace")
+	}
+}
+
+// dependencyFilter matches dependencies by kind, optionally qualified with its
+// group as in Deployment.apps, or by label selector
+type dependencyFilter struct {
+	kind     string
+	group    *string
+	selector labels.Selector
+}
+
+func parseDependencyFilters(filters []string) ([]dependencyFilter, error) {
+	var parsed []dependencyFilter
+	for _, filter := range filters {
+		if strings.ContainsAny(filter, "=!()") {
+			selector, err := labels.Parse(filter)
+			if err != nil {
+				return nil, fmt.Errorf("invalid label selector %q: %w", filter, err)
+			}
+			parsed = append(parsed, dependencyFilter{selector: selector})
+			continue
+		}
+
+		kind, group, qualified := strings.Cut(filter, ".")
+		if kind == "" {
+			return nil, fmt.Errorf("invalid filter %q: expected a kind or a label selector", filter)
+		}
+		f := dependencyFilter{kind: kind}
+		if qualified {
+			f.group = &group
+		}
+		parsed = append(parsed, f)
+	}
+	return parsed, nil
+}
+
+func (f dependencyFilter) matches(dep v1alpha1.Dependency) bool {
+	if f.selector != nil {
+		return f.selector.Matches(labels.Set(dep.GetLabels()))
+	}
+	gvk := dep.GroupVersionKind()
+	return strings.EqualFold(gvk.Kind, f.kind) && (f.group == nil || gvk.Group == *f.group)
+}
+
+func matchesAnyFilter(dep v1alpha1.Dependency, filters []dependencyFilter) bool {
+	for _, filter := range filters {
+		if filter.matches(dep) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterDependencies keeps the dependencies matching any of the include
+// filters, or all of them when there are none, and not matching any of the
+// exclude filters
+func filterDependencies(dependencies []v1alpha1.Dependency, include, exclude []dependencyFilter) []v1alpha1.Dependency {
+	var filtered []v1alpha1.Dependency
+	for _, dep := range dependencies {
+		if len(include) > 0 && !matchesAnyFilter(dep, include) {
+			continue
+		}
+		if matchesAnyFilter(dep, exclude) {
+			continue
+		}
+		filtered = append(filtered, dep)
+	}
+	return filtered
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"os"
+
+	helmlib "github.com/syntasso/kratix-cli/aspects/helm-promise/lib"
+	"helm.sh/helm/v3/pkg/action"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// helmCredentialsSecretKeys maps the environment variables of the
+// helm-promise aspect to the keys of the --credentials-secret Secret. Secrets
+// of type kubernetes.io/dockerconfigjson, as used for imagePullSecrets, hold
+// the registry config in .dockerconfigjson.
+var helmCredentialsSecretKeys = []struct{ envVar, key string }{
+	{helmlib.HelmUsernameEnvVar, "username"},
+	{helmlib.HelmPasswordEnvVar, "password"},
+	{helmlib.HelmRegistryConfigEnvVar, corev1.DockerConfigJsonKey},
+	{helmlib.HelmCABundleEnvVar, "ca.crt"},
+}
+
+var (
+	helmUsername, helmPassword, helmRegistryConfig string
+	helmCAFile, helmCertFile, helmKeyFile          string
+	helmInsecureSkipTLSVerify                      bool
+	helmCredentialsSecret                          string
+)
+
+// helmCredentials returns the username and password of the chart registry or
+// repository, from the flags or the environment
+func helmCredentials() (string, string) {
+	username, password := helmUsername, helmPassword
+	if username == "" {
+		username = os.Getenv(helmlib.HelmUsernameEnvVar)
+	}
+	if password == "" {
+		password = os.Getenv(helmlib.HelmPasswordEnvVar)
+	}
+	return username, password
+}
+
+// setChartPathAuth configures the chart lookup to authenticate with the chart
+// registry or repository
+func setChartPathAuth(install *action.Install) error {
+	username, password := helmCredentials()
+	return helmlib.SetChartPathAuth(install, helmlib.ChartAuth{
+		Username:              username,
+		Password:              password,
+		RegistryConfig:        helmRegistryConfig,
+		CAFile:                helmCAFile,
+		CertFile:              helmCertFile,
+		KeyFile:               helmKeyFile,
+		InsecureSkipTLSVerify: helmInsecureSkipTLSVerify,
+	})
+}
+
+// helmAuthEnvVars returns the environment variables authenticating the
+// helm-promise aspect with the chart registry or repository
+func helmAuthEnvVars() []corev1.EnvVar {
+	var envVars []corev1.EnvVar
+	if helmCredentialsSecret != "" {
+		optional := true
+		for _, secretKey := range helmCredentialsSecretKeys {
+			envVars = append(envVars, corev1.EnvVar{
+				Name: secretKey.envVar,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: helmCredentialsSecret},
+						Key:                  secretKey.key,
+						Optional:             &optional,
+					},
+				},
+			})
+		}
+	}
+	if helmInsecureSkipTLSVerify {
+		envVars = append(envVars, corev1.EnvVar{Name: helmlib.HelmInsecureSkipTLSVerifyEnvVar, Value: "true"})
+	}
+	return envVars
+}
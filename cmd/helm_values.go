@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// exposeValues keeps the exposed values in the schema of the chart values, or
+// all of them when none are, and removes the values fixed by the platform.
+// Exposed values are paths into the chart values, such as auth.database.
+func exposeValues(schema *apiextensionsv1.JSONSchemaProps, exposed []string, platformValues map[string]any) error {
+	if len(exposed) > 0 {
+		tree := fieldTree{}
+		for _, path := range exposed {
+			tree.add(strings.Split(path, "."))
+		}
+		if _, err := keepFields(schema, tree, "spec"); err != nil {
+			return err
+		}
+	}
+
+	removePlatformValues(schema, platformValues)
+	return nil
+}
+
+// removePlatformValues removes the values fixed by the platform from the
+// schema, along with the objects left without properties. Free-form objects
+// are kept, as Helm merges the keys of the request with the platform's.
+func removePlatformValues(schema *apiextensionsv1.JSONSchemaProps, platformValues map[string]any) {
+	for name, value := range platformValues {
+		property, found := schema.Properties[name]
+		if !found {
+			continue
+		}
+
+		if nested, ok := value.(map[string]any); ok {
+			if len(property.Properties) == 0 {
+				continue
+			}
+			removePlatformValues(&property, nested)
+			if len(property.Properties) > 0 {
+				schema.Properties[name] = property
+				continue
+			}
+		}
+
+		delete(schema.Properties, name)
+		schema.Required = slices.DeleteFunc(schema.Required, func(required string) bool { return required == name })
+	}
+}
@@ -1,19 +1,18 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
-	"log"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/syntasso/kratix/api/v1alpha1"
-	goyaml "gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/yaml"
 
 	xrdv1 "github.com/crossplane/crossplane/apis/apiextensions/v1"
@@ -21,13 +20,15 @@ import (
 
 const (
 	crossplaneContainerName  = "from-api-to-crossplane-claim"
-	crossplaneContainerImage = "ghcr.io/syntasso/kratix-cli/from-api-to-crossplane-claim:v0.1.0"
+	crossplaneContainerImage = "ghcr.io/syntasso/kratix-cli/from-api-to-crossplane-claim:v0.2.0"
 
-	workflowDirectory = "workflows/resource/configure"
+	workflowDirectory       = "workflows/resource/configure"
+	deleteWorkflowDirectory = "workflows/resource/delete"
 
 	XRD_GROUP_ENV_VAR   = "XRD_GROUP"
 	XRD_VERSION_ENV_VAR = "XRD_VERSION"
 	XRD_KIND_ENV_VAR    = "XRD_KIND"
+	XRD_SCOPE_ENV_VAR   = "XRD_SCOPE"
 )
 
 var (
@@ -37,8 +38,17 @@ var (
 	crossplanePromiseCmd = &cobra.Command{
 		Use:   "crossplane-promise",
 		Short: "Initialize a new Promise from a Crossplane XRD",
+		Long: `Initialize a new Promise from a Crossplane XRD.
+
+Requests to the Promise create the claim of Crossplane v1 XRDs with claimNames,
+or the composite resource of other XRDs. Composite resources of Crossplane v2
+Namespaced XRDs are created in the namespace of the request, and cluster-scoped
+ones without a namespace.`,
 		Example: `  # initialize a new promise from a Crossplane XRD and Composition
   kratix init crossplane-promise s3buckets --xrd xrd.yaml --group syntasso.io --kind S3Bucket --dir --compositions composition.yaml
+
+  # initialize a new promise from the v1beta1 version of a Crossplane XRD and a directory of Compositions
+  kratix init crossplane-promise s3buckets --xrd xrd.yaml --xrd-version v1beta1 --group syntasso.io --kind S3Bucket --compositions compositions/
 `,
 
 		Args: cobra.ExactArgs(1),
@@ -46,6 +56,7 @@ var (
 	}
 
 	xrdPath          string
+	xrdVersion       string
 	compositions     string
 	skipDependencies bool
 )
@@ -53,7 +64,8 @@ var (
 func init() {
 	initCmd.AddCommand(crossplanePromiseCmd)
 	crossplanePromiseCmd.Flags().StringVarP(&xrdPath, "xrd", "x", "", "Filepath to the XRD file")
-	crossplanePromiseCmd.Flags().StringVarP(&compositions, "compositions", "c", "", "Filepath to the Compositions file. Can contain a single Composition or multiple Compositions.")
+	crossplanePromiseCmd.Flags().StringVar(&xrdVersion, "xrd-version", "", "The version of the XRD to generate the Promise API from. Defaults to its referenceable version")
+	crossplanePromiseCmd.Flags().StringVarP(&compositions, "compositions", "c", "", "Filepath to a Compositions file or directory. Files can contain a single Composition or multiple Compositions.")
 	crossplanePromiseCmd.Flags().BoolVarP(&skipDependencies, "skip-dependencies", "s", false, "Skip generating dependencies. For when the XRD and Compositions are already deployed to Crossplane")
 	crossplanePromiseCmd.MarkFlagRequired("xrd")
 }
@@ -64,7 +76,11 @@ func InitCrossplanePromise(cmd *cobra.Command, args []string) error {
 		plural = fmt.Sprintf("%ss", strings.ToLower(kind))
 	}
 
-	xrd, err := getXRD(xrdPath)
+	xrd, xrdObject, scope, err := getXRD(xrdPath)
+	if err != nil {
+		return err
+	}
+	target, err := xrdTargetOf(xrd, scope)
 	if err != nil {
 		return err
 	}
@@ -72,52 +88,64 @@ func InitCrossplanePromise(cmd *cobra.Command, args []string) error {
 	var dependencies []v1alpha1.Dependency
 	if !skipDependencies {
 		if compositions != "" {
-			dependencies, err = generateDependenciesFromCompositions(compositions)
+			dependencies, err = generateDependenciesFromCompositions(compositions, xrd)
 			if err != nil {
 				return fmt.Errorf("failed to generate dependencies from compositions: %w", err)
 			}
 		}
-		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(xrd)
-		if err != nil {
-			return fmt.Errorf("Failed to parse xrd: %w", err)
+		if xrdObject == nil {
+			objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(xrd)
+			if err != nil {
+				return fmt.Errorf("Failed to parse xrd: %w", err)
+			}
+			xrdObject = objMap
 		}
-		dependencies = append(dependencies, v1alpha1.Dependency{Unstructured: unstructured.Unstructured{Object: objMap}})
+		dependencies = append(dependencies, v1alpha1.Dependency{Unstructured: unstructured.Unstructured{Object: xrdObject}})
 	}
 
-	xrdStoredVersion, err := getXRDStoredVersion(xrd)
+	xrdAPIVersion, err := getXRDVersion(xrd, xrdVersion)
 	if err != nil {
 		return err
 	}
 
-	crd, err := generateCRDFromXRD(xrdStoredVersion)
+	crd, err := generateCRDFromXRD(xrdAPIVersion, target)
 	if err != nil {
 		return err
 	}
 
-	pipelines := generateResourceConfigurePipelines(crossplaneContainerName, crossplaneContainerImage, []corev1.EnvVar{
+	envs := []corev1.EnvVar{
 		{
 			Name:  XRD_GROUP_ENV_VAR,
 			Value: xrd.Spec.Group,
 		},
 		{
 			Name:  XRD_VERSION_ENV_VAR,
-			Value: xrdStoredVersion.Name,
+			Value: xrdAPIVersion.Name,
 		},
 		{
 			Name:  XRD_KIND_ENV_VAR,
-			Value: xrd.Spec.ClaimNames.Kind,
+			Value: target.kind,
 		},
-	})
+		{
+			Name:  XRD_SCOPE_ENV_VAR,
+			Value: target.scope,
+		},
+	}
+	pipelines := generateResourcePipelines(v1alpha1.WorkflowActionConfigure, crossplaneContainerName, crossplaneContainerImage, envs)
+	deletePipelines := generateResourcePipelines(v1alpha1.WorkflowActionDelete, crossplaneContainerName, crossplaneContainerImage, envs)
 
 	exampleResource := generateExampleResource(crd)
 	flags := fmt.Sprintf("--xrd %s", xrdPath)
+	if xrdVersion != "" {
+		flags = fmt.Sprintf("%s --xrd-version %s", flags, xrdVersion)
+	}
 	if compositions != "" {
 		flags = fmt.Sprintf("%s --compositions %s", flags, compositions)
 	}
 	if skipDependencies {
 		flags = fmt.Sprintf("%s --skip-dependencies", flags)
 	}
-	filesToWrite, err := getFilesToWrite(promiseName, split, workflowDirectory, flags, crossplaneDestinationSelectors, dependencies, crd, pipelines, exampleResource)
+	filesToWrite, err := getFilesToWrite(promiseName, split, flags, crossplaneDestinationSelectors, dependencies, crd, pipelines, deletePipelines, exampleResource)
 	if err != nil {
 		return err
 	}
@@ -131,13 +159,23 @@ func InitCrossplanePromise(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func getXRDStoredVersion(xrd *xrdv1.CompositeResourceDefinition) (*xrdv1.CompositeResourceDefinitionVersion, error) {
+// getXRDVersion returns the named version of the XRD, or its referenceable
+// version when no name is given. The version must be served.
+func getXRDVersion(xrd *xrdv1.CompositeResourceDefinition, name string) (*xrdv1.CompositeResourceDefinitionVersion, error) {
+	var names []string
 	for i, version := range xrd.Spec.Versions {
-		if version.Served {
+		names = append(names, version.Name)
+		if (name == "" && version.Referenceable) || (name != "" && version.Name == name) {
+			if !version.Served {
+				return nil, fmt.Errorf("version %s of XRD %s is not served", version.Name, xrd.Name)
+			}
 			return &xrd.Spec.Versions[i], nil
 		}
 	}
-	return nil, fmt.Errorf("no served version found in XRD")
+	if name == "" {
+		return nil, fmt.Errorf("no referenceable version found in XRD %s; set --xrd-version to one of: %s", xrd.Name, strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("version %s not found in XRD %s; the XRD has versions: %s", name, xrd.Name, strings.Join(names, ", "))
 }
 
 func generateExampleResource(crd *apiextensionsv1.CustomResourceDefinition) *unstructured.Unstructured {
@@ -154,29 +192,53 @@ func generateExampleResource(crd *apiextensionsv1.CustomResourceDefinition) *uns
 	}
 }
 
-func generateDependenciesFromCompositions(compositionsFilepath string) ([]v1alpha1.Dependency, error) {
-	contents, err := os.ReadFile(compositionsFilepath)
+// generateDependenciesFromCompositions reads the Compositions in the file or
+// directory, and checks they compose the composite resources of the XRD.
+// Other documents, such as the Functions of the Compositions, are kept.
+func generateDependenciesFromCompositions(compositionsPath string, xrd *xrdv1.CompositeResourceDefinition) ([]v1alpha1.Dependency, error) {
+	dependencies, err := readDependencies(compositionsPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s: %w", compositions, err)
+		return nil, err
 	}
 
-	var compositions []v1alpha1.Dependency
-	docs := goyaml.NewDecoder(bytes.NewReader(contents))
-	for {
-		var comp map[string]any
-		if err := docs.Decode(&comp); err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-			log.Fatalf("Failed to decode YAML: %v", err)
+	var found bool
+	for _, dep := range dependencies {
+		if dep.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.crossplane.io", Kind: "Composition"}) {
+			continue
 		}
-		compositions = append(compositions, v1alpha1.Dependency{Unstructured: unstructured.Unstructured{Object: comp}})
+		if err := validateComposition(dep, xrd); err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("no Compositions found in %s", compositionsPath)
 	}
+	return dependencies, nil
+}
 
-	return compositions, nil
+// validateComposition checks the compositeTypeRef of the Composition refers
+// to a version of the composite resources of the XRD
+func validateComposition(composition v1alpha1.Dependency, xrd *xrdv1.CompositeResourceDefinition) error {
+	apiVersion, _, _ := unstructured.NestedString(composition.Object, "spec", "compositeTypeRef", "apiVersion")
+	compositeKind, _, _ := unstructured.NestedString(composition.Object, "spec", "compositeTypeRef", "kind")
+	if apiVersion == "" || compositeKind == "" {
+		return fmt.Errorf("Composition %s has no spec.compositeTypeRef", composition.GetName())
+	}
+
+	compositeGroup, compositeVersion, _ := strings.Cut(apiVersion, "/")
+	versionFound := slices.ContainsFunc(xrd.Spec.Versions, func(version xrdv1.CompositeResourceDefinitionVersion) bool {
+		return version.Name == compositeVersion
+	})
+	if compositeGroup != xrd.Spec.Group || compositeKind != xrd.Spec.Names.Kind || !versionFound {
+		return fmt.Errorf("Composition %s composes %s %s, not the %s composite resources of XRD %s", composition.GetName(), apiVersion, compositeKind, xrd.Spec.Names.Kind, xrd.Name)
+	}
+	return nil
 }
 
-func generateCRDFromXRD(version *xrdv1.CompositeResourceDefinitionVersion) (*apiextensionsv1.CustomResourceDefinition, error) {
+// generateCRDFromXRD returns the Promise API of the XRD version, with the
+// spec fields Crossplane adds to the target object
+func generateCRDFromXRD(version *xrdv1.CompositeResourceDefinitionVersion, target xrdTarget) (*apiextensionsv1.CustomResourceDefinition, error) {
 	schemaRaw := version.Schema.OpenAPIV3Schema
 	schema := &apiextensionsv1.JSONSchemaProps{}
 	if err := yaml.Unmarshal(schemaRaw.Raw, schema); err != nil {
@@ -202,7 +264,7 @@ func generateCRDFromXRD(version *xrdv1.CompositeResourceDefinitionVersion) (*api
 		schema.Properties["spec"] = specProp
 	}
 
-	for key, value := range mandatoryAdditionalClaimFields {
+	for key, value := range target.specFields {
 		schema.Properties["spec"].Properties[key] = value
 	}
 
@@ -218,20 +280,42 @@ func generateCRDFromXRD(version *xrdv1.CompositeResourceDefinitionVersion) (*api
 	}
 	crd.APIVersion = "apiextensions.k8s.io/v1"
 	crd.Kind = "CustomResourceDefinition"
+	statusProperties := map[string]apiextensionsv1.JSONSchemaProps{
+		"resourceRef": resourceRefStatusSchema,
+	}
+	if target.connectionSecrets {
+		statusProperties["connectionSecretRef"] = secretRefStatusSchema
+	}
+	setStatusSchema(crd, statusProperties)
 
 	return crd, nil
 }
 
-func getXRD(path string) (*xrdv1.CompositeResourceDefinition, error) {
+// getXRD reads a Crossplane v1 or v2 XRD and returns its scope. The v1 types
+// do not hold the fields of v2 XRDs, so v2 XRDs are also returned as read to
+// be used as dependencies.
+func getXRD(path string) (*xrdv1.CompositeResourceDefinition, map[string]any, string, error) {
 	xrd := &xrdv1.CompositeResourceDefinition{}
 	contents, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+		return nil, nil, "", fmt.Errorf("failed to read file %s: %w", path, err)
 	}
 
 	if err := yaml.Unmarshal(contents, xrd); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal file %s: %w", path, err)
+		return nil, nil, "", fmt.Errorf("failed to unmarshal file %s: %w", path, err)
 	}
 
-	return xrd, nil
+	if xrd.APIVersion != "apiextensions.crossplane.io/v2" {
+		return xrd, nil, xrdScopeLegacyCluster, nil
+	}
+
+	object := map[string]any{}
+	if err := yaml.Unmarshal(contents, &object); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to unmarshal file %s: %w", path, err)
+	}
+	scope, _, _ := unstructured.NestedString(object, "spec", "scope")
+	if scope == "" {
+		scope = xrdScopeNamespaced
+	}
+	return xrd, object, scope, nil
 }
@@ -1,23 +1,60 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	helmclient "github.com/mittwald/go-helm-client"
 	"github.com/spf13/cobra"
+	"github.com/syntasso/kratix-cli/aspects/defaults"
+	helmlib "github.com/syntasso/kratix-cli/aspects/helm-promise/lib"
 	"github.com/syntasso/kratix-cli/internal"
 	"github.com/syntasso/kratix/api/v1alpha1"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/registry"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	helmContainerName  = "helm-resource-configure"
+	helmContainerImage = "ghcr.io/syntasso/kratix-cli/helm-resource-configure:v0.2.0"
+)
+
 var intHelmPromiseCmd = &cobra.Command{
-	Use:   "helm-promise PROMISE-NAME --chart-url HELM-CHART-URL --group PROMISE-API-GROUP --kind PROMISE-API-KIND [--chart-version]",
+	Use:   "helm-promise PROMISE-NAME --chart-url HELM-CHART-URL|--chart-path HELM-CHART-PATH --group PROMISE-API-GROUP --kind PROMISE-API-KIND [--chart-version]",
 	Short: "Initialize a new Promise from a Helm chart",
-	Long:  "Initialize a new Promise from a Helm Chart",
+	Long: `Initialize a new Promise from a Helm Chart. The Promise API is generated from the chart's values.schema.json when it has one, and from the chart's default values otherwise.
+
+Local chart directories and archives are read with --chart-path. The resource
+pipeline renders the chart published at --chart-url when it is set too, at the
+--chart-version defaulting to the version of the local chart; otherwise the
+chart is vendored into the resources of an --image built from the
+helm-resource-configure image.
+
+Charts in private registries and repositories are fetched with --username and
+--password, defaulting to $HELM_USERNAME and $HELM_PASSWORD, or with the logins of
+the registry config. The resource pipelines authenticate with the username,
+password, .dockerconfigjson and ca.crt keys of the --credentials-secret Secret.
+
+--expose limits the Promise API to the given chart values. The --platform-values
+are rendered over the values of every request and left out of the Promise API.
+--include-crds, --api-versions and --kube-version configure the rendering of the
+chart in the resource pipeline, as they do for helm template.
+
+--delivery selects what the resource pipeline writes to the destination: the
+rendered manifests of the release (the default), a Flux HelmRelease with its
+HelmRepository or OCIRepository source, or an Argo CD Application. The GitOps
+deliveries install the published --chart-url chart, with the values of the
+request inline; Flux sources authenticate with the --credentials-secret Secret.`,
 	Example: `  # initialize a new promise from an OCI Helm Chart
   kratix init helm-promise postgresql --chart-url oci://registry-1.docker.io/bitnamicharts/postgresql [--chart-version] --group syntasso.io --kind database
 
@@ -26,34 +63,127 @@ var intHelmPromiseCmd = &cobra.Command{
 
   # initialize a new promise from a Helm Chart tar URL
   kratix init helm-promise postgresql --chart-url https://github.com/stefanprodan/podinfo/raw/gh-pages/podinfo-0.2.1.tgz --group syntasso.io --kind database
+
+  # initialize a new promise from a private OCI registry, authenticating the pipelines with an imagePullSecret
+  HELM_USERNAME=robot HELM_PASSWORD=... kratix init helm-promise postgresql --chart-url oci://harbor.example.com/charts/postgresql --credentials-secret harbor-pull-secret --group syntasso.io --kind database
+
+  # initialize a new promise exposing a few chart values, with values fixed by the platform
+  kratix init helm-promise postgresql --chart-url oci://registry-1.docker.io/bitnamicharts/postgresql --expose auth.database --expose primary.persistence.size --platform-values platform-values.yaml --group syntasso.io --kind database
+
+  # initialize a new promise delivering its releases as Flux HelmReleases
+  kratix init helm-promise postgresql --chart-url oci://registry-1.docker.io/bitnamicharts/postgresql --delivery flux --group syntasso.io --kind database
+
+  # initialize a new promise from a local chart, vendoring it into the pipeline image
+  kratix init helm-promise postgresql --chart-path charts/postgresql --image myorg/postgresql-helm:v0.1.0 --group syntasso.io --kind database
+
+  # initialize a new promise from a local chart that is published to a registry
+  kratix init helm-promise postgresql --chart-path charts/postgresql --chart-url oci://registry.example.com/charts/postgresql --chart-version 1.2.0 --group syntasso.io --kind database
 `,
 	RunE: InitHelmPromise,
 	Args: cobra.ExactArgs(1),
 }
 
-var chartURL, chartName, chartVersion string
+var (
+	chartURL, chartName, chartVersion, chartPath string
+	exposedValues                                []string
+	platformValuesFile                           string
+	delivery                                     string
+	vendoredChartImage                           string
+	includeCRDs                                  bool
+	apiVersions                                  []string
+	kubeVersion                                  string
+)
 
 func init() {
 	initCmd.AddCommand(intHelmPromiseCmd)
 	intHelmPromiseCmd.Flags().StringVarP(&chartURL, "chart-url", "", "", "The URL (supports OCI and tarball) of the Helm chart")
 	intHelmPromiseCmd.Flags().StringVarP(&chartVersion, "chart-version", "", "", "The Helm chart version. Default to latest")
 	intHelmPromiseCmd.Flags().StringVarP(&chartName, "chart-name", "", "", "The Helm chart name. Required when using Helm repository")
-	intHelmPromiseCmd.MarkFlagRequired("chart-url")
+	intHelmPromiseCmd.Flags().StringVarP(&chartPath, "chart-path", "", "", "The path to a local Helm chart directory or archive")
+	intHelmPromiseCmd.Flags().StringVarP(&vendoredChartImage, "image", "i", "", "The image to vendor the --chart-path chart into. Required with --chart-path when --chart-url is not set")
+	intHelmPromiseCmd.Flags().StringArrayVarP(&exposedValues, "expose", "", nil, "The path of a chart value to expose in the Promise API, such as auth.database. Can be specified multiple times. Defaults to all values")
+	intHelmPromiseCmd.Flags().StringVarP(&platformValuesFile, "platform-values", "", "", "The path to a values file fixed by the platform, taking precedence over the values of the requests")
+	intHelmPromiseCmd.Flags().StringVarP(&helmUsername, "username", "", "", "The username of the chart registry or repository. Defaults to $"+helmlib.HelmUsernameEnvVar)
+	intHelmPromiseCmd.Flags().StringVarP(&helmPassword, "password", "", "", "The password of the chart registry or repository. Defaults to $"+helmlib.HelmPasswordEnvVar)
+	intHelmPromiseCmd.Flags().StringVarP(&helmRegistryConfig, "registry-config", "", "", "The path to the registry config file. Defaults to Helm's registry config")
+	intHelmPromiseCmd.Flags().StringVarP(&helmCAFile, "ca-file", "", "", "The path to the CA bundle verifying the chart registry or repository")
+	intHelmPromiseCmd.Flags().StringVarP(&helmCertFile, "cert-file", "", "", "The path to the client certificate of the chart registry or repository")
+	intHelmPromiseCmd.Flags().StringVarP(&helmKeyFile, "key-file", "", "", "The path to the client key of the chart registry or repository")
+	intHelmPromiseCmd.Flags().BoolVarP(&helmInsecureSkipTLSVerify, "insecure-skip-tls-verify", "", false, "Skip the TLS verification of the chart registry or repository")
+	intHelmPromiseCmd.Flags().StringVarP(&helmCredentialsSecret, "credentials-secret", "", "", "The name of the Secret with the credentials of the chart registry or repository, used by the resource pipeline")
+	intHelmPromiseCmd.Flags().BoolVarP(&includeCRDs, "include-crds", "", false, "Render the CRDs of the chart in the resource pipeline")
+	intHelmPromiseCmd.Flags().StringArrayVarP(&apiVersions, "api-versions", "", nil, "An API version available to the chart's .Capabilities.APIVersions in the resource pipeline, such as monitoring.coreos.com/v1. Can be specified multiple times")
+	intHelmPromiseCmd.Flags().StringVarP(&kubeVersion, "kube-version", "", "", "The Kubernetes version of the chart's .Capabilities.KubeVersion in the resource pipeline")
+	intHelmPromiseCmd.Flags().StringVarP(&delivery, "delivery", "", helmlib.DeliveryRendered, "How the resource pipeline delivers the release: "+strings.Join(helmlib.Deliveries, ", "))
+	intHelmPromiseCmd.MarkFlagsRequiredTogether("cert-file", "key-file")
+	intHelmPromiseCmd.MarkFlagsOneRequired("chart-url", "chart-path")
 }
 
 func InitHelmPromise(cmd *cobra.Command, args []string) error {
 	promiseName := args[0]
-	resourceConfigure, err := generateHelmResourceConfigurePipeline()
+	if vendorChart() && vendoredChartImage == "" {
+		return fmt.Errorf("--image is required to vendor the --chart-path chart; set --chart-url to use a published chart instead")
+	}
+	if !vendorChart() && vendoredChartImage != "" {
+		return fmt.Errorf("--image is only used to vendor the --chart-path chart when --chart-url is not set")
+	}
+	if vendorChart() && helmCredentialsSecret != "" {
+		return fmt.Errorf("--credentials-secret is only used to fetch the --chart-url chart; the --chart-path chart is vendored into the image")
+	}
+
+	if err := validateDelivery(); err != nil {
+		return err
+	}
+
+	platformValues, err := defaults.ReadFile(platformValuesFile)
 	if err != nil {
 		return err
 	}
 
-	crdSchema, err := schemaFromChart()
+	chart, err := getChart()
+	if err != nil {
+		return err
+	}
+
+	// the pipeline renders the published chart, so pin it to the version of the
+	// --chart-path chart the Promise API is generated from
+	if chartPath != "" && chartURL != "" && chartVersion == "" {
+		chartVersion = chart.Metadata.Version
+	}
+
+	resourceConfigure, err := generateHelmResourcePipeline(v1alpha1.WorkflowActionConfigure, chart, platformValues)
+	if err != nil {
+		return err
+	}
+	resourceDelete, err := generateHelmResourcePipeline(v1alpha1.WorkflowActionDelete, chart, platformValues)
+	if err != nil {
+		return err
+	}
+
+	crdSchema, err := schemaFromChart(chart, platformValues)
+	if err != nil {
+		return err
+	}
+
+	statusSchema, err := statusSchemaYAML(map[string]apiextensionsv1.JSONSchemaProps{
+		"release": {
+			Type:        "object",
+			Description: "The Helm release rendered for the request",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"name":      {Type: "string"},
+				"namespace": {Type: "string"},
+				"chart":     {Type: "string"},
+				"version":   {Type: "string"},
+			},
+		},
+	})
 	if err != nil {
 		return err
 	}
 
 	templateValues := generateTemplateValues(promiseName, "helm-promise", flags(), resourceConfigure, crdSchema)
+	templateValues.StatusSchema = statusSchema
+	templateValues.ResourceDelete = resourceDelete
 
 	templates := map[string]string{
 		resourceFileName: "templates/promise/example-resource.yaml.tpl",
@@ -64,6 +194,7 @@ func InitHelmPromise(cmd *cobra.Command, args []string) error {
 		templates[apiFileName] = "templates/promise/api.yaml.tpl"
 		templates[dependenciesFileName] = "templates/promise/dependencies.yaml"
 		templates[resourceConfigureWorkflowFileName] = "templates/promise/workflow.yaml.tpl"
+		templates[resourceDeleteWorkflowFileName] = "templates/promise/delete-workflow.yaml.tpl"
 	} else {
 		templates[promiseFileName] = "templates/promise/promise.yaml.tpl"
 	}
@@ -79,54 +210,157 @@ func InitHelmPromise(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("%s promise bootstrapped in %s\n", promiseName, dirName)
+
+	if vendorChart() {
+		imageDir, err := writeVendoredChart(chart)
+		if err != nil {
+			return err
+		}
+		fmt.Println("The chart was vendored into the resource pipeline image.")
+		fmt.Println("Run the following command to build the image:")
+		fmt.Printf("\n  docker build -t %s %s\n\n", vendoredChartImage, imageDir)
+		fmt.Println("Don't forget to push the image to a registry!")
+	}
 	return nil
 }
 
-func generateHelmResourceConfigurePipeline() (string, error) {
-	envVars := []corev1.EnvVar{{Name: "CHART_URL", Value: chartURL}}
-	if chartName != "" {
-		envVars = append(envVars, corev1.EnvVar{Name: "CHART_NAME", Value: chartName})
+// vendorChart returns whether the local chart is copied into the pipeline
+// image, as it is not published
+func vendorChart() bool {
+	return chartPath != "" && chartURL == ""
+}
+
+// validateDelivery checks the --delivery is supported, that the rendering
+// flags are only set when the pipeline renders the chart, and that the GitOps
+// deliveries reference a published chart their controllers can fetch
+func validateDelivery() error {
+	if !slices.Contains(helmlib.Deliveries, delivery) {
+		return fmt.Errorf("unsupported --delivery %s: expected one of %s", delivery, strings.Join(helmlib.Deliveries, ", "))
 	}
+	if delivery == helmlib.DeliveryRendered {
+		if kubeVersion != "" {
+			if _, err := chartutil.ParseKubeVersion(kubeVersion); err != nil {
+				return fmt.Errorf("invalid --kube-version %s: %w", kubeVersion, err)
+			}
+		}
+		return nil
+	}
+	if includeCRDs || len(apiVersions) > 0 || kubeVersion != "" {
+		return fmt.Errorf("--include-crds, --api-versions and --kube-version configure the rendering of --delivery %s; the %s controller renders the chart", helmlib.DeliveryRendered, delivery)
+	}
+	if vendorChart() {
+		return fmt.Errorf("--delivery %s needs the chart published at --chart-url; the --chart-path chart can only be vendored with --delivery %s", delivery, helmlib.DeliveryRendered)
+	}
+	if !registry.IsOCI(chartURL) && chartName == "" {
+		return fmt.Errorf("--delivery %s needs an OCI --chart-url or a chart repository with --chart-name", delivery)
+	}
+	return nil
+}
 
-	if chartVersion != "" {
-		envVars = append(envVars, corev1.EnvVar{Name: "CHART_VERSION", Value: chartVersion})
-	}
-
-	pipelines := []unstructured.Unstructured{
-		{
-			Object: map[string]interface{}{
-				"apiVersion": "platform.kratix.io/v1alpha1",
-				"kind":       "Pipeline",
-				"metadata": map[string]interface{}{
-					"name": "instance-configure",
-				},
-				"spec": map[string]interface{}{
-					"containers": []interface{}{
-						v1alpha1.Container{
-							Name:  "instance-configure",
-							Image: "ghcr.io/syntasso/kratix-cli/helm-resource-configure:v0.1.0",
-							Env:   envVars,
-						},
-					},
-				},
-			},
-		},
+// vendoredChartPath is where the vendored chart is in the pipeline image
+func vendoredChartPath(chart *chart.Chart) string {
+	return fmt.Sprintf("/resources/%s-%s.tgz", chart.Name(), chart.Metadata.Version)
+}
+
+// writeVendoredChart packages the chart into the resources of an image built
+// from the helm-resource-configure image, and returns its directory
+func writeVendoredChart(chart *chart.Chart) (string, error) {
+	containerDir := filepath.Join(workflowDirectory, "instance-configure", "instance-configure")
+	resourcesDir := filepath.Join(outputDir, containerDir, "resources")
+	if err := os.MkdirAll(resourcesDir, os.ModePerm); err != nil {
+		return "", err
 	}
-	pipelineBytes, err := yaml.Marshal(pipelines)
-	if err != nil {
+	if _, err := chartutil.Save(chart, resourcesDir); err != nil {
+		return "", fmt.Errorf("failed to package helm chart %s: %w", chartPath, err)
+	}
+
+	templates := map[string]string{
+		filepath.Join(containerDir, "Dockerfile"): "templates/workflows/helm-chart.Dockerfile.tpl",
+	}
+	values := struct{ BaseImage string }{BaseImage: helmContainerImage}
+	if err := templateFiles(workflowTemplates, outputDir, templates, values); err != nil {
 		return "", err
 	}
-	return string(pipelineBytes), nil
+	return filepath.Join(outputDir, containerDir), nil
 }
 
-func schemaFromChart() (string, error) {
-	values, err := valuesFromChart()
-	if err != nil {
-		return "", err
+// generateHelmResourcePipeline returns the resource workflow rendering the
+// chart, from its published location or from the image it is vendored into,
+// with the values fixed by the platform
+func generateHelmResourcePipeline(action v1alpha1.Action, chart *chart.Chart, platformValues map[string]any) (string, error) {
+	containerImage := helmContainerImage
+	envVars := []corev1.EnvVar{{Name: helmlib.ChartURLEnvVar, Value: chartURL}}
+	if vendorChart() {
+		containerImage = vendoredChartImage
+		envVars = []corev1.EnvVar{{Name: helmlib.ChartURLEnvVar, Value: vendoredChartPath(chart)}}
+	} else {
+		if chartName != "" {
+			envVars = append(envVars, corev1.EnvVar{Name: helmlib.ChartNameEnvVar, Value: chartName})
+		}
+
+		if chartVersion != "" {
+			envVars = append(envVars, corev1.EnvVar{Name: helmlib.ChartVersionEnvVar, Value: chartVersion})
+		}
+
+		envVars = append(envVars, helmAuthEnvVars()...)
 	}
-	schema, err := internal.HelmValuesToSchema(values)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert helm values to schema: %w", err)
+
+	if includeCRDs {
+		envVars = append(envVars, corev1.EnvVar{Name: helmlib.IncludeCRDsEnvVar, Value: "true"})
+	}
+	if len(apiVersions) > 0 {
+		envVars = append(envVars, corev1.EnvVar{Name: helmlib.APIVersionsEnvVar, Value: strings.Join(apiVersions, ",")})
+	}
+	if kubeVersion != "" {
+		envVars = append(envVars, corev1.EnvVar{Name: helmlib.KubeVersionEnvVar, Value: kubeVersion})
+	}
+
+	if delivery != helmlib.DeliveryRendered {
+		envVars = append(envVars, corev1.EnvVar{Name: helmlib.DeliveryEnvVar, Value: delivery})
+		if delivery == helmlib.DeliveryFlux && helmCredentialsSecret != "" {
+			envVars = append(envVars, corev1.EnvVar{Name: helmlib.HelmCredentialsSecretEnvVar, Value: helmCredentialsSecret})
+		}
+	}
+
+	if len(platformValues) > 0 {
+		platformValuesJSON, err := json.Marshal(platformValues)
+		if err != nil {
+			return "", err
+		}
+		envVars = append(envVars, corev1.EnvVar{Name: helmlib.PlatformValuesEnvVar, Value: string(platformValuesJSON)})
+	}
+
+	return resourcePipelinesYAML(action, fmt.Sprintf("instance-%s", action), containerImage, envVars)
+}
+
+func schemaFromChart(chart *chart.Chart, platformValues map[string]any) (string, error) {
+	var err error
+	var schema *apiextensionsv1.JSONSchemaProps
+	if len(chart.Schema) > 0 {
+		schema, err = internal.HelmJSONSchemaToSchema(chart.Schema, chart.Values)
+		if err != nil {
+			return "", fmt.Errorf("failed to convert helm values.schema.json to schema: %w", err)
+		}
+	} else {
+		schema, err = internal.HelmValuesToSchema(chart.Values)
+		if err != nil {
+			return "", fmt.Errorf("failed to convert helm values to schema: %w", err)
+		}
+	}
+
+	for _, file := range chart.Raw {
+		if file.Name != "values.yaml" {
+			continue
+		}
+		descriptions, err := internal.HelmValuesDescriptions(file.Data)
+		if err != nil {
+			return "", err
+		}
+		internal.AddDescriptions(schema, descriptions)
+	}
+
+	if err := exposeValues(schema, exposedValues, platformValues); err != nil {
+		return "", err
 	}
 
 	bytes, err := yaml.Marshal(*schema)
@@ -137,15 +371,24 @@ func schemaFromChart() (string, error) {
 	return string(bytes), nil
 }
 
-func valuesFromChart() (map[string]interface{}, error) {
+func getChart() (*chart.Chart, error) {
+	if chartPath != "" {
+		helmChart, err := loader.Load(chartPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load helm chart %s: %w", chartPath, err)
+		}
+		return helmChart, nil
+	}
+
 	client, err := helmclient.New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create helm client: %w", err)
 	}
 
 	install := action.NewInstall(&action.Configuration{})
-	registryClient, _ := registry.NewClient()
-	install.SetRegistryClient(registryClient)
+	if err := setChartPathAuth(install); err != nil {
+		return nil, err
+	}
 
 	if chartName != "" {
 		install.RepoURL = chartURL
@@ -155,12 +398,12 @@ func valuesFromChart() (map[string]interface{}, error) {
 		install.ChartPathOptions.Version = chartVersion
 	}
 
-	chart, _, err := client.GetChart(getChartName(), &install.ChartPathOptions)
+	helmChart, _, err := client.GetChart(getChartName(), &install.ChartPathOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch helm chart: %w", err)
 	}
 
-	return chart.Values, nil
+	return helmChart, nil
 }
 
 // when provided --chart-url is a chart repo and --chart-name is provided, getChartName() returns chart-name
@@ -173,13 +416,46 @@ func getChartName() string {
 }
 
 func flags() string {
-	flags := fmt.Sprintf("--chart-url %s", chartURL)
+	var flags []string
+	if chartPath != "" {
+		flags = append(flags, fmt.Sprintf("--chart-path %s", chartPath))
+	}
+	if chartURL != "" {
+		flags = append(flags, fmt.Sprintf("--chart-url %s", chartURL))
+	}
+	if vendoredChartImage != "" {
+		flags = append(flags, fmt.Sprintf("--image %s", vendoredChartImage))
+	}
 	if chartName != "" {
-		flags += fmt.Sprintf(" --chart-name %s", chartName)
+		flags = append(flags, fmt.Sprintf("--chart-name %s", chartName))
 	}
 	if chartVersion != "" {
-		flags += fmt.Sprintf(" --chart-version %s", chartVersion)
+		flags = append(flags, fmt.Sprintf("--chart-version %s", chartVersion))
+	}
+	for _, path := range exposedValues {
+		flags = append(flags, fmt.Sprintf("--expose %s", path))
+	}
+	if platformValuesFile != "" {
+		flags = append(flags, fmt.Sprintf("--platform-values %s", platformValuesFile))
+	}
+	if helmCredentialsSecret != "" {
+		flags = append(flags, fmt.Sprintf("--credentials-secret %s", helmCredentialsSecret))
+	}
+	if helmInsecureSkipTLSVerify {
+		flags = append(flags, "--insecure-skip-tls-verify")
+	}
+	if includeCRDs {
+		flags = append(flags, "--include-crds")
+	}
+	for _, apiVersion := range apiVersions {
+		flags = append(flags, fmt.Sprintf("--api-versions %s", apiVersion))
+	}
+	if kubeVersion != "" {
+		flags = append(flags, fmt.Sprintf("--kube-version %s", kubeVersion))
+	}
+	if delivery != helmlib.DeliveryRendered {
+		flags = append(flags, fmt.Sprintf("--delivery %s", delivery))
 	}
 
-	return flags
+	return strings.Join(flags, " ")
 }
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 
 	"github.com/spf13/cobra"
+	"github.com/syntasso/kratix-cli/aspects/defaults"
 	"github.com/syntasso/kratix/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -20,29 +22,76 @@ import (
 
 const (
 	operatorContainerName  = "from-api-to-operator"
-	operatorContainerImage = "ghcr.io/syntasso/kratix-cli/from-api-to-operator:v0.1.0"
+	operatorContainerImage = "ghcr.io/syntasso/kratix-cli/from-api-to-operator:v0.2.0"
 )
 
 var operatorPromiseCmd = &cobra.Command{
-	Use:   "operator-promise PROMISE-NAME --group PROMISE-API-GROUP --version PROMISE-API-VERSION --kind PROMISE-API-KIND --operator-manifests OPERATOR-MANIFESTS-DIR --api-schema-from CRD-NAME",
+	Use:   "operator-promise PROMISE-NAME --group PROMISE-API-GROUP --version PROMISE-API-VERSION --kind PROMISE-API-KIND --operator-manifests OPERATOR-MANIFESTS [--api-schema-from CRD-NAME]",
 	Short: "Generate a Promise from a given Kubernetes Operator.",
-	Long:  `Generate a Promise from a given Kubernetes Operator.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  InitPromiseFromOperator,
+	Long: `Generate a Promise from a given Kubernetes Operator.
+
+The operator can be a directory or file of manifests, an OLM bundle or a Helm
+chart. The ClusterServiceVersion of an OLM bundle is converted into the
+Deployments, ServiceAccounts and RBAC objects OLM would create, and the CRDs
+it owns are the ones the API schema can be generated from. Helm charts are
+rendered locally with their default values, including their CRDs.
+
+The operator manifests become the Promise dependencies. Namespaced manifests
+without a namespace are placed in the default namespace, or in the --namespace
+namespace along with every other namespaced manifest. Cluster-scoped manifests,
+such as CRDs, ClusterRoles and the objects of cluster-scoped CRDs in the
+manifests, are never namespaced.
+
+Use --include and --exclude to select the manifests by kind, such as
+ClusterRole or Deployment.apps, or by label selector, such as
+app.kubernetes.io/component=webhook.
+
+The Promise API is generated from the storage version of the CRD, or from
+--api-schema-version, without the printer columns and status of the operator.
+--include and --exclude filters starting with spec. select the fields of the
+API instead, and --values-file sets the values of the fields requests do not
+set, such as the fields left out of the API.`,
+	Example: `  # generate a Promise from the operator manifests in a directory
+  kratix init operator-promise postgresql --group syntasso.io --kind Database --operator-manifests manifests/ --api-schema-from clusters.postgresql.cnpg.io
+
+  # install the operator in its own namespace, leaving out the CRDs already in the cluster
+  kratix init operator-promise postgresql --group syntasso.io --kind Database --operator-manifests manifests/ --api-schema-from clusters.postgresql.cnpg.io \
+    --namespace postgres-operator --exclude CustomResourceDefinition
+
+  # expose only some fields of the v1 CRD, setting the others from a values file
+  kratix init operator-promise postgresql --group syntasso.io --kind Database --operator-manifests manifests/ --api-schema-from clusters.postgresql.cnpg.io \
+    --api-schema-version v1 --include spec.instances --include spec.storage.size --values-file values.yaml
+
+  # generate a Promise from an OLM bundle, using the CRD it owns for the API schema
+  kratix init operator-promise postgresql --group syntasso.io --kind Database --operator-manifests bundle/
+
+  # generate a Promise from a Helm-packaged operator
+  kratix init operator-promise postgresql --group syntasso.io --kind Database --operator-manifests cloudnative-pg-0.23.0.tgz --api-schema-from clusters.postgresql.cnpg.io`,
+	Args: cobra.ExactArgs(1),
+	RunE: InitPromiseFromOperator,
 }
 
 var (
 	operatorManifestsDir, targetCrdName string
+	operatorNamespace                   string
+	operatorInclude, operatorExclude    []string
+	operatorAPIVersion                  string
+	operatorValuesFile                  string
 )
 
 func init() {
 	initCmd.AddCommand(operatorPromiseCmd)
 
-	operatorPromiseCmd.Flags().StringVarP(&operatorManifestsDir, "operator-manifests", "m", "", "The path to the directory containing the operator manifests.")
-	operatorPromiseCmd.Flags().StringVarP(&targetCrdName, "api-schema-from", "a", "", "The name of the CRD which the Promise API schema should be generated from.")
+	operatorPromiseCmd.Flags().StringVarP(&operatorManifestsDir, "operator-manifests", "m", "", "The path to the operator: a directory or file of manifests, an OLM bundle directory or a Helm chart directory or archive.")
+	operatorPromiseCmd.Flags().StringVarP(&targetCrdName, "api-schema-from", "a", "", "The name of the CRD which the Promise API schema should be generated from. Defaults to the CRD owned by the operator when it owns only one.")
+	operatorPromiseCmd.Flags().StringVar(&operatorAPIVersion, "api-schema-version", "", "The version of the CRD which the Promise API schema should be generated from. Defaults to its storage version.")
+	operatorPromiseCmd.Flags().StringVar(&operatorValuesFile, "values-file", "", "A YAML file of values for the spec of the operator objects. They are the defaults for the fields requests do not set, including the fields left out of the Promise API.")
+
+	operatorPromiseCmd.Flags().StringVarP(&operatorNamespace, "namespace", "n", "", "The namespace to install the namespaced operator manifests in. Defaults to their own namespace, or default when they do not set one.")
+	operatorPromiseCmd.Flags().StringArrayVar(&operatorInclude, "include", nil, "Only include the operator manifests matching a kind, such as ClusterRole or Deployment.apps, or a label selector, and only include the spec.* fields in the Promise API. Can be specified multiple times.")
+	operatorPromiseCmd.Flags().StringArrayVar(&operatorExclude, "exclude", nil, "Exclude the operator manifests matching a kind, such as CustomResourceDefinition, or a label selector, and exclude the spec.* fields from the Promise API. Can be specified multiple times.")
 
 	operatorPromiseCmd.MarkFlagRequired("operator-manifests")
-	operatorPromiseCmd.MarkFlagRequired("api-schema-from")
 }
 
 func InitPromiseFromOperator(cmd *cobra.Command, args []string) error {
@@ -52,16 +101,45 @@ func InitPromiseFromOperator(cmd *cobra.Command, args []string) error {
 		plural = fmt.Sprintf("%ss", strings.ToLower(kind))
 	}
 
-	dependencies, err := buildDependencies(operatorManifestsDir)
+	manifestInclude, fieldInclude := splitFieldFilters(operatorInclude)
+	manifestExclude, fieldExclude := splitFieldFilters(operatorExclude)
+	include, err := parseDependencyFilters(manifestInclude)
+	if err != nil {
+		return err
+	}
+	exclude, err := parseDependencyFilters(manifestExclude)
+	if err != nil {
+		return err
+	}
+
+	specDefaults, err := defaults.ReadFile(operatorValuesFile)
+	if err != nil {
+		return err
+	}
+
+	dependencies, ownedCRDs, err := operatorDependencies(operatorManifestsDir, operatorNamespace)
 	if err != nil {
 		return err
 	}
 
+	if targetCrdName == "" {
+		if len(ownedCRDs) != 1 {
+			return fmt.Errorf("--api-schema-from is required when the operator does not own exactly one CRD; the operator owns: %s", strings.Join(ownedCRDs, ", "))
+		}
+		targetCrdName = ownedCRDs[0]
+		fmt.Printf("Generating the Promise API from %s, the CRD owned by the operator\n", targetCrdName)
+	}
+
 	crd, err := findTargetCRD(targetCrdName, dependencies)
 	if err != nil {
 		return err
 	}
 
+	if operatorNamespace != "" {
+		dependencies = relocateDependencies(dependencies, operatorNamespace)
+	}
+	dependencies = filterDependencies(dependencies, include, exclude)
+
 	if len(crd.Spec.Versions) == 0 {
 		return fmt.Errorf("no versions found in CRD")
 	}
@@ -72,8 +150,22 @@ func InitPromiseFromOperator(cmd *cobra.Command, args []string) error {
 		Kind:     kind,
 	}
 
-	storedVersionIdx := findStoredVersionIdx(crd)
-	operatorVersion := crd.Spec.Versions[storedVersionIdx].Name
+	versionIdx, err := findVersionIdx(crd, operatorAPIVersion)
+	if err != nil {
+		return err
+	}
+	if crd.Spec.Versions[versionIdx].Schema == nil || crd.Spec.Versions[versionIdx].Schema.OpenAPIV3Schema == nil {
+		return fmt.Errorf("no schema found in version %s of CRD %s", crd.Spec.Versions[versionIdx].Name, crd.Name)
+	}
+	removedRequired, err := pruneSpecFields(crd.Spec.Versions[versionIdx].Schema.OpenAPIV3Schema, fieldInclude, fieldExclude)
+	if err != nil {
+		return err
+	}
+	for _, path := range missingDefaults(removedRequired, specDefaults) {
+		fmt.Printf("warning: %s is required by the operator but left out of the Promise API; set it in --values-file\n", path)
+	}
+
+	operatorVersion := crd.Spec.Versions[versionIdx].Name
 	envs := []corev1.EnvVar{
 		{
 			Name:  "OPERATOR_GROUP",
@@ -88,7 +180,17 @@ func InitPromiseFromOperator(cmd *cobra.Command, args []string) error {
 			Value: crd.Spec.Names.Kind,
 		},
 	}
-	updateOperatorCrd(crd, storedVersionIdx, group, names, version)
+	if specDefaults != nil {
+		specDefaultsJSON, err := json.Marshal(specDefaults)
+		if err != nil {
+			return err
+		}
+		envs = append(envs, corev1.EnvVar{
+			Name:  defaults.SpecEnvVar,
+			Value: string(specDefaultsJSON),
+		})
+	}
+	updateOperatorCrd(crd, versionIdx, group, names, version)
 
 	exampleResource := &unstructured.Unstructured{
 		Object: map[string]any{
@@ -102,10 +204,26 @@ func InitPromiseFromOperator(cmd *cobra.Command, args []string) error {
 		},
 	}
 
-	pipelines := generateResourceConfigurePipelines(operatorContainerName, operatorContainerImage, envs)
+	pipelines := generateResourcePipelines(v1alpha1.WorkflowActionConfigure, operatorContainerName, operatorContainerImage, envs)
+	deletePipelines := generateResourcePipelines(v1alpha1.WorkflowActionDelete, operatorContainerName, operatorContainerImage, envs)
 
 	flags := fmt.Sprintf("--operator-manifests %s --api-schema-from %s", operatorManifestsDir, targetCrdName)
-	filesToWrite, err := getFilesToWrite(promiseName, split, workflowDirectory, flags, nil, dependencies, crd, pipelines, exampleResource)
+	if operatorAPIVersion != "" {
+		flags += fmt.Sprintf(" --api-schema-version %s", operatorAPIVersion)
+	}
+	if operatorValuesFile != "" {
+		flags += fmt.Sprintf(" --values-file %s", operatorValuesFile)
+	}
+	if operatorNamespace != "" {
+		flags += fmt.Sprintf(" --namespace %s", operatorNamespace)
+	}
+	for _, filter := range operatorInclude {
+		flags += fmt.Sprintf(" --include %s", filter)
+	}
+	for _, filter := range operatorExclude {
+		flags += fmt.Sprintf(" --exclude %s", filter)
+	}
+	filesToWrite, err := getFilesToWrite(promiseName, split, flags, nil, dependencies, crd, pipelines, deletePipelines, exampleResource)
 	if err != nil {
 		return err
 	}
@@ -155,12 +273,17 @@ func findStoredVersionIdx(crd *apiextensionsv1.CustomResourceDefinition) int {
 	return storedVersionIdx
 }
 
-func updateOperatorCrd(crd *apiextensionsv1.CustomResourceDefinition, storedVersionIdx int, group string, names apiextensionsv1.CustomResourceDefinitionNames, version string) {
+// updateOperatorCrd turns the CRD into the Promise API, with the schema of
+// the version at versionIdx. The printer columns, subresources and conversion
+// of the operator CRD refer to fields of the operator objects, so they are
+// dropped, and its status is replaced with the status the aspect writes.
+func updateOperatorCrd(crd *apiextensionsv1.CustomResourceDefinition, versionIdx int, group string, names apiextensionsv1.CustomResourceDefinitionNames, version string) {
 	crd.Spec.Names = names
 	crd.Name = fmt.Sprintf("%s.%s", names.Plural, group)
 	crd.Spec.Group = group
+	crd.Spec.Conversion = nil
 
-	storedVersion := crd.Spec.Versions[storedVersionIdx]
+	storedVersion := crd.Spec.Versions[versionIdx]
 
 	if version == "" {
 		version = storedVersion.Name
@@ -169,6 +292,11 @@ func updateOperatorCrd(crd *apiextensionsv1.CustomResourceDefinition, storedVers
 	storedVersion.Name = version
 	storedVersion.Storage = true
 	storedVersion.Served = true
+	storedVersion.Deprecated = false
+	storedVersion.DeprecationWarning = nil
+	storedVersion.AdditionalPrinterColumns = nil
+	storedVersion.Subresources = nil
+	storedVersion.Schema.OpenAPIV3Schema.Required = slices.DeleteFunc(storedVersion.Schema.OpenAPIV3Schema.Required, func(name string) bool { return name == "status" })
 	storedVersion.Schema.OpenAPIV3Schema.Properties["kind"] = apiextensionsv1.JSONSchemaProps{
 		Type: "string",
 		Enum: []apiextensionsv1.JSON{{Raw: []byte(fmt.Sprintf("%q", kind))}},
@@ -180,6 +308,9 @@ func updateOperatorCrd(crd *apiextensionsv1.CustomResourceDefinition, storedVers
 	crd.Spec.Versions = []apiextensionsv1.CustomResourceDefinitionVersion{
 		storedVersion,
 	}
+	setStatusSchema(crd, map[string]apiextensionsv1.JSONSchemaProps{
+		"resourceRef": resourceRefStatusSchema,
+	})
 }
 
 func writePromiseFiles(outputDir string, filesToWrite map[string]any) error {
@@ -212,7 +343,10 @@ func writePromiseFiles(outputDir string, filesToWrite map[string]any) error {
 	return nil
 }
 
-func generateResourceConfigurePipelines(containerName, containerImage string, envs []corev1.EnvVar) []unstructured.Unstructured {
+// generateResourcePipelines returns the resource workflow for the action. The
+// aspect in the container reads the action from KRATIX_WORKFLOW_ACTION, so
+// the configure and delete workflows run the same container.
+func generateResourcePipelines(action v1alpha1.Action, containerName, containerImage string, envs []corev1.EnvVar) []unstructured.Unstructured {
 	container := v1alpha1.Container{
 		Name:  containerName,
 		Image: containerImage,
@@ -224,7 +358,7 @@ func generateResourceConfigurePipelines(containerName, containerImage string, en
 			"apiVersion": "platform.kratix.io/v1alpha1",
 			"kind":       "Pipeline",
 			"metadata": map[string]any{
-				"name": "instance-configure",
+				"name": fmt.Sprintf("instance-%s", action),
 			},
 			"spec": map[string]any{
 				"containers": []any{container},
@@ -235,6 +369,16 @@ func generateResourceConfigurePipelines(containerName, containerImage string, en
 	return []unstructured.Unstructured{pipeline}
 }
 
+// resourcePipelinesYAML returns the resource workflow for the action for the
+// Promise templates
+func resourcePipelinesYAML(action v1alpha1.Action, containerName, containerImage string, envs []corev1.EnvVar) (string, error) {
+	pipelineBytes, err := yamlsig.Marshal(generateResourcePipelines(action, containerName, containerImage, envs))
+	if err != nil {
+		return "", err
+	}
+	return string(pipelineBytes), nil
+}
+
 func topLevelRequiredFields(crd *apiextensionsv1.CustomResourceDefinition) map[string]any {
 	crdSpec := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
 	requiredSpecFields := crdSpec.Required
@@ -249,7 +393,7 @@ func topLevelRequiredFields(crd *apiextensionsv1.CustomResourceDefinition) map[s
 	return m
 }
 
-func getFilesToWrite(promiseName string, split bool, workflowDirectory, extraFlags string, destinationSelectors []v1alpha1.PromiseScheduling, dependencies []v1alpha1.Dependency, crd *apiextensionsv1.CustomResourceDefinition, workflow []unstructured.Unstructured, exampleResource *unstructured.Unstructured) (map[string]any, error) {
+func getFilesToWrite(promiseName string, split bool, extraFlags string, destinationSelectors []v1alpha1.PromiseScheduling, dependencies []v1alpha1.Dependency, crd *apiextensionsv1.CustomResourceDefinition, workflow, deleteWorkflow []unstructured.Unstructured, exampleResource *unstructured.Unstructured) (map[string]any, error) {
 	readmeTemplate, err := template.ParseFS(promiseTemplates, "templates/promise/README.md.tpl")
 	if err != nil {
 		return nil, err
@@ -276,11 +420,14 @@ func getFilesToWrite(promiseName string, split bool, workflowDirectory, extraFla
 			workflowDirectory: map[string]any{
 				"workflow.yaml": workflow,
 			},
+			deleteWorkflowDirectory: map[string]any{
+				"workflow.yaml": deleteWorkflow,
+			},
 			"README.md": templatedReadme.String(),
 		}, nil
 	}
 
-	promise, err := generatePromise(promiseName, destinationSelectors, dependencies, crd, workflow)
+	promise, err := generatePromise(promiseName, destinationSelectors, dependencies, crd, workflow, deleteWorkflow)
 	if err != nil {
 		return nil, err
 	}
@@ -292,7 +439,7 @@ func getFilesToWrite(promiseName string, split bool, workflowDirectory, extraFla
 	}, nil
 }
 
-func generatePromise(promiseName string, destinationSelectors []v1alpha1.PromiseScheduling, dependencies []v1alpha1.Dependency, crd *apiextensionsv1.CustomResourceDefinition, pipelines []unstructured.Unstructured) (v1alpha1.Promise, error) {
+func generatePromise(promiseName string, destinationSelectors []v1alpha1.PromiseScheduling, dependencies []v1alpha1.Dependency, crd *apiextensionsv1.CustomResourceDefinition, pipelines, deletePipelines []unstructured.Unstructured) (v1alpha1.Promise, error) {
 	promise := newPromise(promiseName)
 
 	crdBytes, err := json.Marshal(crd)
@@ -303,6 +450,7 @@ func generatePromise(promiseName string, destinationSelectors []v1alpha1.Promise
 	promise.Spec.API = &runtime.RawExtension{Raw: crdBytes}
 	promise.Spec.Dependencies = dependencies
 	promise.Spec.Workflows.Resource.Configure = pipelines
+	promise.Spec.Workflows.Resource.Delete = deletePipelines
 	promise.Spec.DestinationSelectors = destinationSelectors
 
 	return promise, nil
@@ -31,6 +31,10 @@ const (
 	apiFileName                       = "api.yaml"
 	resourceFileName                  = "example-resource.yaml"
 	resourceConfigureWorkflowFileName = "workflows/resource/configure/workflow.yaml"
+	resourceDeleteWorkflowFileName    = "workflows/resource/delete/workflow.yaml"
+	destinationSelectorsFileName      = "destination-selectors.yaml"
+	metadataFileName                  = "metadata.yaml"
+	requiredPromisesFileName          = "required-promises.yaml"
 )
 
 func init() {
@@ -46,8 +50,10 @@ type promiseTemplateValues struct {
 	Singular             string
 	SubCommand           string
 	ResourceConfigure    string
+	ResourceDelete       string
 	PromiseConfigure     string
 	CRDSchema            string
+	StatusSchema         string
 	DestinationSelectors string
 	ExtraFlags           string
 }
@@ -1,43 +1,93 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/syntasso/kratix-cli/internal"
 	"github.com/syntasso/kratix/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	terraformModuleContainerName  = "terraform-generate"
+	terraformModuleContainerImage = "ghcr.io/syntasso/kratix-cli/terraform-generate:v0.2.0"
+)
+
 // terraformModuleCmd represents the terraformModule command
 var (
 	terraformModuleCmd = &cobra.Command{
 		Use:   "tf-module-promise",
-		Short: "Initialize a Promise from a Terraform Module stored in Git",
+		Short: "Initialize a Promise from a Terraform Module",
+		Long: `Initialize a Promise from a Terraform Module.
+
+The module source can be a git repository, a Terraform Registry address such as
+terraform-aws-modules/vpc/aws, an S3 or HTTP archive, or a local directory.
+Append //PATH to the source to use a module in a subdirectory.
+
+With --module-version, git sources are checked out at that ref and registry
+modules are pinned to that version. It cannot be set for other sources.
+
+The generated Terraform exposes every output of the module. Use --backend and
+--backend-config to store the state of each request under its own key in a
+backend, and --provider to configure the providers the module needs.`,
 		Example: `  # Initialize a Promise from a Terraform Module in git
   kratix init tf-module-promise vpc --module-version v5.19.0 --module-source https://github.com/terraform-aws-modules/terraform-aws-vpc.git --group syntasso.io --kind VPC --version v1alpha1
+
+  # Initialize a Promise from a Terraform Registry module
+  kratix init tf-module-promise vpc --module-version 5.19.0 --module-source terraform-aws-modules/vpc/aws --group syntasso.io --kind VPC
+
+  # Initialize a Promise from a module in a subdirectory of a git repository
+  kratix init tf-module-promise sg --module-version v5.3.0 --module-source https://github.com/terraform-aws-modules/terraform-aws-security-group.git//modules/http-80 --group syntasso.io --kind SecurityGroup
+
+  # Initialize a Promise from a local module
+  kratix init tf-module-promise vpc --module-source ./modules/vpc --group syntasso.io --kind VPC
+
+  # Initialize a Promise storing the state in S3 and configuring the AWS provider
+  kratix init tf-module-promise vpc --module-version 5.19.0 --module-source terraform-aws-modules/vpc/aws --group syntasso.io --kind VPC \
+    --backend s3 --backend-config bucket=tf-state,region=eu-west-2 --provider aws:region=eu-west-2
 		`,
 		RunE: InitFromTerraformModule,
 		Args: cobra.ExactArgs(1),
 	}
 
 	moduleSource, moduleVersion string
+	terraformBackend            string
+	terraformBackendConfig      map[string]string
+	terraformProviders          []string
 )
 
 func init() {
 	initCmd.AddCommand(terraformModuleCmd)
-	terraformModuleCmd.Flags().StringVarP(&moduleSource, "module-source", "s", "", "source of the terraform module")
-	terraformModuleCmd.Flags().StringVarP(&moduleVersion, "module-version", "m", "", "version of the terraform module")
+	terraformModuleCmd.Flags().StringVarP(&moduleSource, "module-source", "s", "", "source of the terraform module: a git repository, registry address, archive URL or local directory")
+	terraformModuleCmd.Flags().StringVarP(&moduleVersion, "module-version", "m", "", "version of the terraform module; a git ref or a registry module version")
+	terraformModuleCmd.Flags().StringVar(&terraformBackend, "backend", "", "type of the terraform backend storing the state of each request, e.g. s3, gcs or kubernetes")
+	terraformModuleCmd.Flags().StringToStringVar(&terraformBackendConfig, "backend-config", nil, "configuration of the terraform backend, as KEY=VALUE pairs. The state key is set per request")
+	terraformModuleCmd.Flags().StringArrayVar(&terraformProviders, "provider", nil, "terraform provider to configure, as NAME or NAME:KEY=VALUE[,KEY=VALUE]. Can be specified multiple times")
 	terraformModuleCmd.MarkFlagRequired("module-source")
-	terraformModuleCmd.MarkFlagRequired("module-version")
 }
 
 func InitFromTerraformModule(cmd *cobra.Command, args []string) error {
 	fmt.Println("Fetching terraform module variables, this might take up to a minute...")
-	versionedModuleSourceURL := fmt.Sprintf("git::%s?ref=%s", moduleSource, moduleVersion)
-	variables, err := internal.GetVariablesFromModule(versionedModuleSourceURL)
+	resolvedModuleSource, err := internal.ResolveModuleSource(moduleSource, moduleVersion)
+	if err != nil {
+		return fmt.Errorf("failed to resolve terraform module source: %w", err)
+	}
+	if len(terraformBackendConfig) > 0 && terraformBackend == "" {
+		return fmt.Errorf("--backend-config requires --backend to be set")
+	}
+	providers, err := parseTerraformProviders(terraformProviders)
+	if err != nil {
+		return err
+	}
+
+	variables, outputs, err := internal.GetVariablesAndOutputsFromModule(resolvedModuleSource)
 	if err != nil {
 		return fmt.Errorf("failed to download and convert terraform module to CRD: %w", err)
 	}
@@ -53,14 +103,47 @@ func InitFromTerraformModule(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to marshal CRD schema: %w", err)
 	}
 
-	resourceConfigure, err := generateTerraformModuleResourceConfigurePipeline()
+	resourceConfigure, err := generateTerraformModuleResourcePipeline(v1alpha1.WorkflowActionConfigure, providers, outputs)
+	if err != nil {
+		return err
+	}
+	resourceDelete, err := generateTerraformModuleResourcePipeline(v1alpha1.WorkflowActionDelete, providers, outputs)
 	if err != nil {
 		return err
 	}
 
 	promiseName := args[0]
-	flags := fmt.Sprintf("--module-source %s --module-version %s", moduleSource, moduleVersion)
+	flags := fmt.Sprintf("--module-source %s", moduleSource)
+	if moduleVersion != "" {
+		flags += fmt.Sprintf(" --module-version %s", moduleVersion)
+	}
+	if terraformBackend != "" {
+		flags += fmt.Sprintf(" --backend %s", terraformBackend)
+	}
+	for _, key := range slices.Sorted(maps.Keys(terraformBackendConfig)) {
+		flags += fmt.Sprintf(" --backend-config %s=%s", key, terraformBackendConfig[key])
+	}
+	for _, provider := range terraformProviders {
+		flags += fmt.Sprintf(" --provider %s", provider)
+	}
+	statusSchema, err := statusSchemaYAML(map[string]apiextensionsv1.JSONSchemaProps{
+		"outputs": {
+			Type:        "array",
+			Description: "The outputs of the Terraform module",
+			Items:       &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
+		},
+		"stateKey": {
+			Type:        "string",
+			Description: "The key of the Terraform state of the request in the backend",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
 	templateValues := generateTemplateValues(promiseName, "tf-module-promise", flags, resourceConfigure, string(crdSchema))
+	templateValues.StatusSchema = statusSchema
+	templateValues.ResourceDelete = resourceDelete
 	templateValues.DestinationSelectors = "- matchLabels:\n    environment: terraform"
 
 	templates := map[string]string{
@@ -72,6 +155,7 @@ func InitFromTerraformModule(cmd *cobra.Command, args []string) error {
 		templates[apiFileName] = "templates/promise/api.yaml.tpl"
 		templates[dependenciesFileName] = "templates/promise/dependencies.yaml"
 		templates[resourceConfigureWorkflowFileName] = "templates/promise/workflow.yaml.tpl"
+		templates[resourceDeleteWorkflowFileName] = "templates/promise/delete-workflow.yaml.tpl"
 	} else {
 		templates[promiseFileName] = "templates/promise/promise.yaml.tpl"
 	}
@@ -85,39 +169,90 @@ func InitFromTerraformModule(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func generateTerraformModuleResourceConfigurePipeline() (string, error) {
-	pipelines := []unstructured.Unstructured{
+// parseTerraformProviders parses the --provider flags, in the form
+// NAME[:KEY=VALUE,...], into the configuration of each provider
+func parseTerraformProviders(providerFlags []string) (map[string]map[string]string, error) {
+	providers := map[string]map[string]string{}
+	for _, providerFlag := range providerFlags {
+		name, options, _ := strings.Cut(providerFlag, ":")
+		if name == "" {
+			return nil, fmt.Errorf("invalid provider %q: expected NAME[:KEY=VALUE,...]", providerFlag)
+		}
+
+		config := map[string]string{}
+		if options != "" {
+			for _, option := range strings.Split(options, ",") {
+				key, value, ok := strings.Cut(option, "=")
+				if !ok || key == "" {
+					return nil, fmt.Errorf("invalid provider %q: expected NAME[:KEY=VALUE,...]", providerFlag)
+				}
+				config[key] = value
+			}
+		}
+		providers[name] = config
+	}
+	return providers, nil
+}
+
+func generateTerraformModuleResourcePipeline(action v1alpha1.Action, providers map[string]map[string]string, outputs []internal.TerraformOutput) (string, error) {
+	env := []corev1.EnvVar{
 		{
-			Object: map[string]any{
-				"apiVersion": "platform.kratix.io/v1alpha1",
-				"kind":       "Pipeline",
-				"metadata": map[string]any{
-					"name": "instance-configure",
-				},
-				"spec": map[string]any{
-					"containers": []any{
-						v1alpha1.Container{
-							Name:  "terraform-generate",
-							Image: "ghcr.io/syntasso/kratix-cli/terraform-generate:v0.1.0",
-							Env: []corev1.EnvVar{
-								{
-									Name:  "MODULE_SOURCE",
-									Value: moduleSource,
-								},
-								{
-									Name:  "MODULE_VERSION",
-									Value: moduleVersion,
-								},
-							},
-						},
-					},
-				},
-			},
+			Name:  "MODULE_SOURCE",
+			Value: moduleSource,
 		},
 	}
-	pipelineBytes, err := yaml.Marshal(pipelines)
-	if err != nil {
-		return "", err
+	if moduleVersion != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  "MODULE_VERSION",
+			Value: moduleVersion,
+		})
+	}
+	if terraformBackend != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  "TERRAFORM_BACKEND",
+			Value: terraformBackend,
+		})
+	}
+	if len(terraformBackendConfig) > 0 {
+		backendConfig, err := json.Marshal(terraformBackendConfig)
+		if err != nil {
+			return "", err
+		}
+		env = append(env, corev1.EnvVar{
+			Name:  "TERRAFORM_BACKEND_CONFIG",
+			Value: string(backendConfig),
+		})
+	}
+	if len(providers) > 0 {
+		providersConfig, err := json.Marshal(providers)
+		if err != nil {
+			return "", err
+		}
+		env = append(env, corev1.EnvVar{
+			Name:  "TERRAFORM_PROVIDERS",
+			Value: string(providersConfig),
+		})
 	}
-	return string(pipelineBytes), nil
+
+	var outputNames, sensitiveOutputNames []string
+	for _, output := range outputs {
+		outputNames = append(outputNames, output.Name)
+		if output.Sensitive {
+			sensitiveOutputNames = append(sensitiveOutputNames, output.Name)
+		}
+	}
+	if len(outputNames) > 0 {
+		env = append(env, corev1.EnvVar{
+			Name:  "MODULE_OUTPUTS",
+			Value: strings.Join(outputNames, ","),
+		})
+	}
+	if len(sensitiveOutputNames) > 0 {
+		env = append(env, corev1.EnvVar{
+			Name:  "MODULE_SENSITIVE_OUTPUTS",
+			Value: strings.Join(sensitiveOutputNames, ","),
+		})
+	}
+
+	return resourcePipelinesYAML(action, terraformModuleContainerName, terraformModuleContainerImage, env)
 }
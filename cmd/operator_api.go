@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// specFieldPrefix marks the --include and --exclude filters that select the
+// fields of the operator CRD spec, rather than the operator manifests
+const specFieldPrefix = "spec."
+
+// splitFieldFilters separates the filters selecting spec fields, such as
+// spec.replicas, from the filters selecting manifests
+func splitFieldFilters(filters []string) (manifests []string, fields []string) {
+	for _, filter := range filters {
+		if strings.HasPrefix(filter, specFieldPrefix) {
+			fields = append(fields, filter)
+			continue
+		}
+		manifests = append(manifests, filter)
+	}
+	return manifests, fields
+}
+
+// findVersionIdx returns the index of the named version of the CRD, or of its
+// storage version when no name is given
+func findVersionIdx(crd *apiextensionsv1.CustomResourceDefinition, name string) (int, error) {
+	if name == "" {
+		return findStoredVersionIdx(crd), nil
+	}
+
+	var names []string
+	for idx, crdVersion := range crd.Spec.Versions {
+		if crdVersion.Name == name {
+			return idx, nil
+		}
+		names = append(names, crdVersion.Name)
+	}
+	return 0, fmt.Errorf("version %s not found in CRD %s; the CRD has versions: %s", name, crd.Name, strings.Join(names, ", "))
+}
+
+// pruneSpecFields keeps the included fields of the spec, or all of them when
+// none are, and removes the excluded ones. Fields are paths into the spec,
+// such as spec.postgresql.version, that go through the items of arrays. It
+// returns the paths of the removed fields the operator requires.
+func pruneSpecFields(schema *apiextensionsv1.JSONSchemaProps, include, exclude []string) ([]string, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	spec, ok := schema.Properties["spec"]
+	if !ok {
+		return nil, fmt.Errorf("the CRD schema has no spec")
+	}
+
+	var removedRequired []string
+	if len(include) > 0 {
+		tree := fieldTree{}
+		for _, path := range include {
+			tree.add(strings.Split(strings.TrimPrefix(path, specFieldPrefix), "."))
+		}
+		removed, err := keepFields(&spec, tree, "spec")
+		if err != nil {
+			return nil, err
+		}
+		removedRequired = append(removedRequired, removed...)
+	}
+
+	for _, path := range exclude {
+		removed, err := removeField(&spec, strings.Split(strings.TrimPrefix(path, specFieldPrefix), "."), "spec")
+		if err != nil {
+			return nil, err
+		}
+		removedRequired = append(removedRequired, removed...)
+	}
+
+	schema.Properties["spec"] = spec
+	return removedRequired, nil
+}
+
+// fieldTree holds the fields to keep, where a nil subtree keeps the whole
+// field
+type fieldTree map[string]fieldTree
+
+func (t fieldTree) add(path []string) {
+	subtree, found := t[path[0]]
+	if found && subtree == nil {
+		return
+	}
+	if len(path) == 1 {
+		t[path[0]] = nil
+		return
+	}
+	if subtree == nil {
+		subtree = fieldTree{}
+		t[path[0]] = subtree
+	}
+	subtree.add(path[1:])
+}
+
+// objectSchema returns the schema of the properties of an object, or of the
+// items of an array of objects
+func objectSchema(schema *apiextensionsv1.JSONSchemaProps) *apiextensionsv1.JSONSchemaProps {
+	if schema.Type == "array" && schema.Items != nil && schema.Items.Schema != nil {
+		return schema.Items.Schema
+	}
+	return schema
+}
+
+func keepFields(schema *apiextensionsv1.JSONSchemaProps, tree fieldTree, path string) ([]string, error) {
+	object := objectSchema(schema)
+	for name := range tree {
+		if _, found := object.Properties[name]; !found {
+			return nil, fmt.Errorf("field %s.%s not found in the CRD schema", path, name)
+		}
+	}
+
+	var removedRequired []string
+	for name, property := range object.Properties {
+		subtree, keep := tree[name]
+		if !keep {
+			delete(object.Properties, name)
+			if slices.Contains(object.Required, name) {
+				removedRequired = append(removedRequired, path+"."+name)
+			}
+			continue
+		}
+		if subtree == nil {
+			continue
+		}
+		removed, err := keepFields(&property, subtree, path+"."+name)
+		if err != nil {
+			return nil, err
+		}
+		removedRequired = append(removedRequired, removed...)
+		object.Properties[name] = property
+	}
+	object.Required = slices.DeleteFunc(object.Required, func(name string) bool {
+		_, found := object.Properties[name]
+		return !found
+	})
+	return removedRequired, nil
+}
+
+func removeField(schema *apiextensionsv1.JSONSchemaProps, fieldPath []string, path string) ([]string, error) {
+	object := objectSchema(schema)
+	name := fieldPath[0]
+	property, found := object.Properties[name]
+	if !found {
+		return nil, fmt.Errorf("field %s.%s not found in the CRD schema", path, name)
+	}
+
+	if len(fieldPath) > 1 {
+		removed, err := removeField(&property, fieldPath[1:], path+"."+name)
+		if err != nil {
+			return nil, err
+		}
+		object.Properties[name] = property
+		return removed, nil
+	}
+
+	delete(object.Properties, name)
+	if slices.Contains(object.Required, name) {
+		object.Required = slices.DeleteFunc(object.Required, func(required string) bool { return required == name })
+		return []string{path + "." + name}, nil
+	}
+	return nil, nil
+}
+
+// missingDefaults returns the paths of the fields without a value in the spec
+// defaults
+func missingDefaults(paths []string, specDefaults map[string]any) []string {
+	var missing []string
+	for _, path := range paths {
+		fields := strings.Split(strings.TrimPrefix(path, specFieldPrefix), ".")
+		if _, found, _ := unstructured.NestedFieldNoCopy(specDefaults, fields...); !found {
+			missing = append(missing, path)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/syntasso/kratix/api/v1alpha1"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// operatorDependencies reads the operator from a directory or file of
+// manifests, an OLM bundle or a Helm chart, and returns its manifests along
+// with the names of the CRDs it owns
+func operatorDependencies(path, namespace string) ([]v1alpha1.Dependency, []string, error) {
+	if isHelmChart(path) {
+		dependencies, err := renderOperatorChart(path, namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		defaultDependencyNamespaces(dependencies, "default")
+		return dependencies, crdNames(dependencies), nil
+	}
+
+	if manifestsDir, ok := olmBundleManifestsDir(path); ok {
+		path = manifestsDir
+	}
+	dependencies, err := readDependencies(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dependencies, ownedCRDs, err := convertClusterServiceVersions(dependencies)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ownedCRDs == nil {
+		ownedCRDs = crdNames(dependencies)
+	}
+	defaultDependencyNamespaces(dependencies, "default")
+	return dependencies, ownedCRDs, nil
+}
+
+func crdNames(dependencies []v1alpha1.Dependency) []string {
+	var names []string
+	for _, dep := range dependencies {
+		if dep.GetKind() == "CustomResourceDefinition" {
+			names = append(names, dep.GetName())
+		}
+	}
+	return names
+}
+
+// isHelmChart returns whether the path is a chart directory or archive
+func isHelmChart(path string) bool {
+	if strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz") {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(path, "Chart.yaml"))
+	return err == nil
+}
+
+// renderOperatorChart renders the chart locally with its default values,
+// including the CRDs in its crds directory
+func renderOperatorChart(path, namespace string) ([]v1alpha1.Dependency, error) {
+	chart, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load helm chart %s: %w", path, err)
+	}
+
+	if namespace == "" {
+		namespace = "default"
+	}
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...any) {}})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.IncludeCRDs = true
+	install.ReleaseName = chart.Name()
+	install.Namespace = namespace
+
+	release, err := install.Run(chart, map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render helm chart %s: %w", path, err)
+	}
+
+	dependencies, err := decodeDependencies(strings.NewReader(release.Manifest), path)
+	if err != nil {
+		return nil, err
+	}
+	if len(dependencies) == 0 {
+		return nil, fmt.Errorf("no manifests rendered from helm chart %s", path)
+	}
+	return dependencies, nil
+}
+
+// olmBundleManifestsDir returns the manifests directory of an OLM bundle,
+// which has its metadata in a sibling directory
+func olmBundleManifestsDir(path string) (string, bool) {
+	if _, err := os.Stat(filepath.Join(path, "metadata", "annotations.yaml")); err != nil {
+		return "", false
+	}
+	manifestsDir := filepath.Join(path, "manifests")
+	info, err := os.Stat(manifestsDir)
+	return manifestsDir, err == nil && info.IsDir()
+}
+
+// convertClusterServiceVersions replaces the ClusterServiceVersions of OLM
+// bundles with the Deployments, ServiceAccounts and RBAC objects OLM would
+// create for them, and returns the names of the CRDs they own. It returns nil
+// owned CRDs when there are no ClusterServiceVersions.
+func convertClusterServiceVersions(dependencies []v1alpha1.Dependency) ([]v1alpha1.Dependency, []string, error) {
+	var converted []v1alpha1.Dependency
+	var ownedCRDs []string
+	for _, dep := range dependencies {
+		if dep.GetKind() != "ClusterServiceVersion" || dep.GroupVersionKind().Group != "operators.coreos.com" {
+			converted = append(converted, dep)
+			continue
+		}
+
+		installed, err := clusterServiceVersionObjects(&dep.Unstructured)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to convert ClusterServiceVersion %s: %w", dep.GetName(), err)
+		}
+		converted = append(converted, installed...)
+
+		owned, _, _ := unstructured.NestedSlice(dep.Object, "spec", "customresourcedefinitions", "owned")
+		if ownedCRDs == nil {
+			ownedCRDs = []string{}
+		}
+		for _, crd := range owned {
+			if crd, ok := crd.(map[string]any); ok {
+				if name, ok := crd["name"].(string); ok {
+					ownedCRDs = append(ownedCRDs, name)
+				}
+			}
+		}
+
+		if webhooks, _, _ := unstructured.NestedSlice(dep.Object, "spec", "webhookdefinitions"); len(webhooks) > 0 {
+			fmt.Printf("warning: the webhooks of ClusterServiceVersion %s are not converted; OLM manages their certificates\n", dep.GetName())
+		}
+	}
+	return converted, ownedCRDs, nil
+}
+
+// clusterServiceVersionObjects returns the objects of the deployment install
+// strategy of the ClusterServiceVersion
+func clusterServiceVersionObjects(csv *unstructured.Unstructured) ([]v1alpha1.Dependency, error) {
+	strategy, _, _ := unstructured.NestedString(csv.Object, "spec", "install", "strategy")
+	if strategy != "deployment" {
+		return nil, fmt.Errorf("unsupported install strategy %q", strategy)
+	}
+
+	// CSV names are PACKAGE.vVERSION
+	prefix, _, _ := strings.Cut(csv.GetName(), ".v")
+	namespace := csv.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	var objects []v1alpha1.Dependency
+	serviceAccounts := map[string]bool{}
+	addServiceAccount := func(name string) {
+		if serviceAccounts[name] {
+			return
+		}
+		serviceAccounts[name] = true
+		objects = append(objects, newDependency("v1", "ServiceAccount", name, namespace, nil))
+	}
+
+	for _, scope := range []struct {
+		field, role, binding string
+	}{
+		{field: "clusterPermissions", role: "ClusterRole", binding: "ClusterRoleBinding"},
+		{field: "permissions", role: "Role", binding: "RoleBinding"},
+	} {
+		permissions, _, _ := unstructured.NestedSlice(csv.Object, "spec", "install", "spec", scope.field)
+		for _, permission := range permissions {
+			permission, ok := permission.(map[string]any)
+			if !ok {
+				continue
+			}
+			serviceAccount, _ := permission["serviceAccountName"].(string)
+			if serviceAccount == "" {
+				return nil, fmt.Errorf("%s without a serviceAccountName", scope.field)
+			}
+			addServiceAccount(serviceAccount)
+
+			name := fmt.Sprintf("%s-%s", prefix, serviceAccount)
+			roleNamespace := namespace
+			if scope.role == "ClusterRole" {
+				roleNamespace = ""
+			}
+			objects = append(objects,
+				newDependency("rbac.authorization.k8s.io/v1", scope.role, name, roleNamespace, map[string]any{
+					"rules": permission["rules"],
+				}),
+				newDependency("rbac.authorization.k8s.io/v1", scope.binding, name, roleNamespace, map[string]any{
+					"roleRef": map[string]any{
+						"apiGroup": "rbac.authorization.k8s.io",
+						"kind":     scope.role,
+						"name":     name,
+					},
+					"subjects": []any{
+						map[string]any{
+							"kind":      "ServiceAccount",
+							"name":      serviceAccount,
+							"namespace": namespace,
+						},
+					},
+				}),
+			)
+		}
+	}
+
+	deployments, _, _ := unstructured.NestedSlice(csv.Object, "spec", "install", "spec", "deployments")
+	for _, deployment := range deployments {
+		deployment, ok := deployment.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := deployment["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("deployment without a name")
+		}
+		if serviceAccount, _, _ := unstructured.NestedString(deployment, "spec", "template", "spec", "serviceAccountName"); serviceAccount != "" {
+			addServiceAccount(serviceAccount)
+		}
+
+		obj := newDependency("apps/v1", "Deployment", name, namespace, map[string]any{
+			"spec": deployment["spec"],
+		})
+		if labels, ok := deployment["label"].(map[string]any); ok {
+			deploymentLabels := map[string]string{}
+			for key, value := range labels {
+				deploymentLabels[key] = fmt.Sprint(value)
+			}
+			obj.SetLabels(deploymentLabels)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+func newDependency(apiVersion, kind, name, namespace string, fields map[string]any) v1alpha1.Dependency {
+	obj := unstructured.Unstructured{Object: map[string]any{}}
+	for key, value := range fields {
+		obj.Object[key] = value
+	}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	if namespace != "" {
+		obj.SetNamespace(namespace)
+	}
+	return v1alpha1.Dependency{Unstructured: obj}
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/syntasso/kratix-cli/aspects/defaults"
+	helmlib "github.com/syntasso/kratix-cli/aspects/helm-promise/lib"
+	terraformlib "github.com/syntasso/kratix-cli/aspects/terraform-module-promise/lib"
+	"github.com/syntasso/kratix/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+)
+
+type RenderOptions struct {
+	Dir   string
+	Input string
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render [LIFECYCLE/ACTION/PIPELINE-NAME]",
+	Short: "Command to render the output of the Kratix CLI aspects in a Promise's pipelines",
+	Long: `Command to render the output of the Kratix CLI aspects in a Promise's pipelines.
+
+The containers generated by 'kratix init tf-module-promise', 'kratix init
+operator-promise', 'kratix init crossplane-promise' and 'kratix init
+helm-promise' are recognised by their image and their logic is run in-process
+with the container's environment, so no container engine is needed. Containers
+with any other image, such as the ones of vendored charts, are skipped. Values
+read from Secrets are not set.
+
+When no pipeline is given, every resource configure pipeline is rendered. The
+input object defaults to example-resource.yaml.`,
+	Example: `  # render the output of all resource configure pipelines for example-resource.yaml
+  kratix render
+
+  # render a single pipeline against a different resource request
+  kratix render resource/configure/instance-configure --input my-request.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: Render,
+}
+
+var renderOpts = &RenderOptions{}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+	renderCmd.Flags().StringVarP(&renderOpts.Dir, "dir", "d", ".", "Directory to read the Promise from")
+	renderCmd.Flags().StringVarP(&renderOpts.Input, "input", "i", "", "File to use as the input object. Defaults to example-resource.yaml")
+}
+
+// renderedDocument is a file an aspect would write to /kratix/output
+type renderedDocument struct {
+	Name    string
+	Content []byte
+}
+
+type aspectRenderer func(request *unstructured.Unstructured, env map[string]string) ([]renderedDocument, error)
+
+var aspectRenderers = map[string]aspectRenderer{
+	terraformModuleContainerName: renderTerraformModule,
+	operatorContainerName:        renderOperatorObject,
+	crossplaneContainerName:      renderCrossplaneClaim,
+	helmContainerName:            renderHelmRelease,
+}
+
+func Render(cmd *cobra.Command, args []string) error {
+	promise, err := LoadPromiseWithWorkflows(renderOpts.Dir)
+	if err != nil {
+		return err
+	}
+
+	var pipelines []v1alpha1.Pipeline
+	if len(args) == 1 {
+		containerArgs, err := ParseContainerCmdArgs(args[0])
+		if err != nil {
+			return err
+		}
+		if containerArgs.Action == string(v1alpha1.WorkflowActionDelete) {
+			return fmt.Errorf("cannot render %s: the output of delete pipelines is not written to destinations", args[0])
+		}
+		pipeline, err := RetrievePipeline(promise, containerArgs)
+		if err != nil {
+			return err
+		}
+		pipelines = []v1alpha1.Pipeline{*pipeline}
+	} else {
+		allPipelines, err := v1alpha1.NewPipelinesMap(promise, ctrl.LoggerFrom(context.Background()))
+		if err != nil {
+			return err
+		}
+		pipelines = allPipelines[v1alpha1.WorkflowTypeResource][v1alpha1.WorkflowActionConfigure]
+	}
+
+	request, err := loadRenderInput()
+	if err != nil {
+		return err
+	}
+
+	var output strings.Builder
+	rendered := 0
+	for _, pipeline := range pipelines {
+		for _, container := range pipeline.Spec.Containers {
+			render, ok := aspectRenderers[aspectName(container.Image)]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "skipping container %s: image %s is not a known aspect\n", container.Name, container.Image)
+				continue
+			}
+
+			env := map[string]string{}
+			for _, e := range container.Env {
+				env[e.Name] = e.Value
+			}
+
+			documents, err := render(request.DeepCopy(), env)
+			if err != nil {
+				return fmt.Errorf("failed to render container %s in pipeline %s: %w", container.Name, pipeline.GetName(), err)
+			}
+
+			for _, doc := range documents {
+				output.WriteString("---\n")
+				fmt.Fprintf(&output, "# Source: %s/%s/%s\n", pipeline.GetName(), container.Name, doc.Name)
+				output.Write(doc.Content)
+				if !strings.HasSuffix(string(doc.Content), "\n") {
+					output.WriteString("\n")
+				}
+			}
+			rendered++
+		}
+	}
+
+	if rendered == 0 {
+		return fmt.Errorf("no containers with a known aspect image found in the pipelines")
+	}
+
+	fmt.Print(output.String())
+	return nil
+}
+
+// aspectName returns the image name without the registry, repository path, tag or digest
+func aspectName(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := path.Base(image)
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+func loadRenderInput() (*unstructured.Unstructured, error) {
+	input := renderOpts.Input
+	if input == "" {
+		input = filepath.Join(renderOpts.Dir, resourceFileName)
+	}
+
+	inputBytes, err := os.ReadFile(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input object: %w", err)
+	}
+
+	var request unstructured.Unstructured
+	if err := yaml.Unmarshal(inputBytes, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse input object: %w", err)
+	}
+
+	// resource requests are always namespaced once applied to the platform
+	if request.GetNamespace() == "" {
+		request.SetNamespace("default")
+	}
+	return &request, nil
+}
+
+func requiredEnv(env map[string]string, names ...string) ([]string, error) {
+	var values []string
+	for _, name := range names {
+		if env[name] == "" {
+			return nil, fmt.Errorf("expected %s to be set", name)
+		}
+		values = append(values, env[name])
+	}
+	return values, nil
+}
+
+func renderTerraformModule(request *unstructured.Unstructured, env map[string]string) ([]renderedDocument, error) {
+	if _, err := requiredEnv(env, "MODULE_SOURCE"); err != nil {
+		return nil, err
+	}
+
+	config, err := terraformlib.ModuleConfigFromEnv(func(name string) string { return env[name] })
+	if err != nil {
+		return nil, err
+	}
+
+	fileName, content, err := terraformlib.GenerateModule(request.Object, config)
+	if err != nil {
+		return nil, err
+	}
+	return []renderedDocument{{Name: fileName, Content: content}}, nil
+}
+
+func renderOperatorObject(request *unstructured.Unstructured, env map[string]string) ([]renderedDocument, error) {
+	values, err := requiredEnv(env, "OPERATOR_GROUP", "OPERATOR_VERSION", "OPERATOR_KIND")
+	if err != nil {
+		return nil, err
+	}
+	specDefaults, err := defaults.SpecFromEnv(func(name string) string { return env[name] })
+	if err != nil {
+		return nil, err
+	}
+	return renderTransformedObject(request, values[0], values[1], values[2], helmlib.TransformOptions{SpecDefaults: specDefaults})
+}
+
+func renderCrossplaneClaim(request *unstructured.Unstructured, env map[string]string) ([]renderedDocument, error) {
+	values, err := requiredEnv(env, XRD_GROUP_ENV_VAR, XRD_VERSION_ENV_VAR, XRD_KIND_ENV_VAR)
+	if err != nil {
+		return nil, err
+	}
+	return renderTransformedObject(request, values[0], values[1], values[2], helmlib.TransformOptions{Scope: env[XRD_SCOPE_ENV_VAR]})
+}
+
+func renderTransformedObject(request *unstructured.Unstructured, group, version, kind string, options helmlib.TransformOptions) ([]renderedDocument, error) {
+	object := helmlib.Transform(request, group, version, kind)
+	helmlib.ApplyScope(object, request, options.Scope)
+	defaults.ApplyToSpec(object, options.SpecDefaults)
+	content, err := yaml.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	return []renderedDocument{{Name: "object.yaml", Content: content}}, nil
+}
+
+func renderHelmRelease(request *unstructured.Unstructured, env map[string]string) ([]renderedDocument, error) {
+	authDir, err := os.MkdirTemp("", "helm-auth")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(authDir)
+
+	config, err := helmlib.ChartConfigFromEnv(func(name string) string { return env[name] }, authDir)
+	if err != nil {
+		return nil, err
+	}
+	files, _, err := helmlib.Render(request, config)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]renderedDocument, 0, len(files))
+	for _, file := range files {
+		documents = append(documents, renderedDocument{Name: file.Name, Content: file.Content})
+	}
+	return documents, nil
+}
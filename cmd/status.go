@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+var resourceRefStatusSchema = apiextensionsv1.JSONSchemaProps{
+	Type:        "object",
+	Description: "The object generated from the request",
+	Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"apiVersion": {Type: "string"},
+		"kind":       {Type: "string"},
+		"name":       {Type: "string"},
+		"namespace":  {Type: "string"},
+	},
+}
+
+var secretRefStatusSchema = apiextensionsv1.JSONSchemaProps{
+	Type:        "object",
+	Description: "The secret the connection details are written to",
+	Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"name":      {Type: "string"},
+		"namespace": {Type: "string"},
+	},
+}
+
+// resourceStatusSchema returns the status schema of the resource requests:
+// the message and the given properties are written by the aspect in the
+// resource workflow, and unknown fields are kept for the conditions Kratix
+// and other workflow steps set
+func resourceStatusSchema(properties map[string]apiextensionsv1.JSONSchemaProps) apiextensionsv1.JSONSchemaProps {
+	status := apiextensionsv1.JSONSchemaProps{
+		Type:                   "object",
+		XPreserveUnknownFields: ptr.To(true),
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"message": {Type: "string"},
+		},
+	}
+	for name, property := range properties {
+		status.Properties[name] = property
+	}
+	return status
+}
+
+// setStatusSchema adds the status subresource and replaces the status schema
+// of every version of the CRD
+func setStatusSchema(crd *apiextensionsv1.CustomResourceDefinition, properties map[string]apiextensionsv1.JSONSchemaProps) {
+	for i := range crd.Spec.Versions {
+		if crd.Spec.Versions[i].Subresources == nil {
+			crd.Spec.Versions[i].Subresources = &apiextensionsv1.CustomResourceSubresources{}
+		}
+		crd.Spec.Versions[i].Subresources.Status = &apiextensionsv1.CustomResourceSubresourceStatus{}
+		if crd.Spec.Versions[i].Schema == nil || crd.Spec.Versions[i].Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		schema := crd.Spec.Versions[i].Schema.OpenAPIV3Schema
+		if schema.Properties == nil {
+			schema.Properties = map[string]apiextensionsv1.JSONSchemaProps{}
+		}
+		schema.Properties["status"] = resourceStatusSchema(properties)
+	}
+}
+
+// statusSchemaYAML returns the status schema for the Promise templates
+func statusSchemaYAML(properties map[string]apiextensionsv1.JSONSchemaProps) (string, error) {
+	status, err := yaml.Marshal(resourceStatusSchema(properties))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(status)), nil
+}
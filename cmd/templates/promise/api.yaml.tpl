@@ -15,7 +15,15 @@ spec:
         openAPIV3Schema:
           type: object
           properties:
+{{- if .StatusSchema }}
+            status:
+{{ .StatusSchema | indent 14 }}
+{{- end }}
             spec:
 {{ .CRDSchema | indent 14 }}
       served: true
       storage: true
+{{- if .StatusSchema }}
+      subresources:
+        status: {}
+{{- end }}
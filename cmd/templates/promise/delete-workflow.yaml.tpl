@@ -0,0 +1 @@
+{{ .ResourceDelete }}
\ No newline at end of file
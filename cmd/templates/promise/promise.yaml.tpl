@@ -23,10 +23,18 @@ spec:
             openAPIV3Schema:
               type: object
               properties:
+{{- if .StatusSchema }}
+                status:
+{{ .StatusSchema | indent 18 }}
+{{- end }}
                 spec:
 {{ .CRDSchema | indent 18 }}
           served: true
           storage: true
+{{- if .StatusSchema }}
+          subresources:
+            status: {}
+{{- end }}
 {{- if .DestinationSelectors }}
   destinationSelectors:
 {{ .DestinationSelectors | indent 4 }}
@@ -38,3 +46,7 @@ spec:
     resource:
       configure:
 {{ .ResourceConfigure | indent 8 }}
+{{- if .ResourceDelete }}
+      delete:
+{{ .ResourceDelete | indent 8 }}
+{{- end }}
@@ -0,0 +1,3 @@
+FROM "{{ .BaseImage }}"
+
+ADD resources /resources
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Command to test kratix resources locally",
+	Long:  "Command to test kratix resources locally",
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/syntasso/kratix/api/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+type TestWorkflowOptions struct {
+	Dir       string
+	Engine    string
+	Input     string
+	OutputDir string
+}
+
+var testWorkflowCmd = &cobra.Command{
+	Use:   "workflow LIFECYCLE/ACTION/PIPELINE-NAME [flags]",
+	Short: "Command to run a Promise workflow pipeline locally",
+	Long: `Command to run a Promise workflow pipeline locally.
+
+Each container of the pipeline is run in order with the container engine. The
+input object is mounted at /kratix/input/object.yaml, and the /kratix/output and
+/kratix/metadata directories are shared between the containers, as they are when
+the pipeline runs in Kratix. Once all containers have run, the output and the
+metadata are left in the output directory.
+
+For resource workflows, the input object defaults to example-resource.yaml. For
+promise workflows, the input object defaults to the Promise itself.`,
+	Example: `  # run the resource configure pipeline 'instance' against example-resource.yaml
+  kratix test workflow resource/configure/instance
+
+  # run the pipeline against a different resource request
+  kratix test workflow resource/configure/instance --input my-request.yaml
+
+  # run the pipeline with podman and write the results to a given directory
+  kratix test workflow resource/configure/instance --engine podman --output-dir /tmp/instance-output`,
+	Args: cobra.ExactArgs(1),
+	RunE: RunWorkflow,
+}
+
+var testWorkflowOpts = &TestWorkflowOptions{}
+
+func init() {
+	testCmd.AddCommand(testWorkflowCmd)
+	testWorkflowCmd.Flags().StringVarP(&testWorkflowOpts.Dir, "dir", "d", ".", "Directory to read the Promise from")
+	testWorkflowCmd.Flags().StringVarP(&testWorkflowOpts.Engine, "engine", "e", "docker", "Container engine used to run the pipeline containers; one of docker or podman")
+	testWorkflowCmd.Flags().StringVarP(&testWorkflowOpts.Input, "input", "i", "", "File to mount as /kratix/input/object.yaml. Defaults to example-resource.yaml for resource workflows")
+	testWorkflowCmd.Flags().StringVarP(&testWorkflowOpts.OutputDir, "output-dir", "o", "", "Directory to write the pipeline input, output and metadata to. Defaults to test-output/LIFECYCLE/ACTION/PIPELINE-NAME in the Promise directory")
+}
+
+func RunWorkflow(cmd *cobra.Command, args []string) error {
+	if err := validateEngine(testWorkflowOpts.Engine); err != nil {
+		return err
+	}
+
+	containerArgs, err := ParseContainerCmdArgs(args[0])
+	if err != nil {
+		return err
+	}
+
+	promise, err := LoadPromiseWithWorkflows(testWorkflowOpts.Dir)
+	if err != nil {
+		return err
+	}
+
+	pipeline, err := RetrievePipeline(promise, containerArgs)
+	if err != nil {
+		return err
+	}
+
+	if len(pipeline.Spec.Containers) == 0 {
+		return fmt.Errorf("pipeline %s has no containers", pipeline.GetName())
+	}
+
+	outputDir := testWorkflowOpts.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(testWorkflowOpts.Dir, "test-output", containerArgs.Lifecycle, containerArgs.Action, containerArgs.Pipeline)
+	}
+	outputDir, err = filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+
+	inputBytes, err := workflowInput(promise, containerArgs)
+	if err != nil {
+		return err
+	}
+
+	volumes := map[string]string{}
+	for _, volume := range []string{"input", "output", "metadata"} {
+		volumeDir := filepath.Join(outputDir, volume)
+		if err := os.RemoveAll(volumeDir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(volumeDir, os.ModePerm); err != nil {
+			return err
+		}
+		volumes[volume] = volumeDir
+	}
+
+	if err := os.WriteFile(filepath.Join(volumes["input"], "object.yaml"), inputBytes, filePerm); err != nil {
+		return err
+	}
+
+	for _, container := range pipeline.Spec.Containers {
+		fmt.Printf("Running container %s with image %s...\n", container.Name, container.Image)
+		if err := forkRunCommand(testWorkflowOpts.Engine, workflowRunArgs(promise, containerArgs, container, volumes)); err != nil {
+			return fmt.Errorf("container %s failed: %w", container.Name, err)
+		}
+	}
+
+	fmt.Printf("Workflow output written to %s\n", outputDir)
+	return nil
+}
+
+func workflowInput(promise *v1alpha1.Promise, c *ContainerCmdArgs) ([]byte, error) {
+	input := testWorkflowOpts.Input
+	if input == "" && c.Lifecycle == "resource" {
+		input = filepath.Join(testWorkflowOpts.Dir, resourceFileName)
+	}
+
+	if input != "" {
+		inputBytes, err := os.ReadFile(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input object: %w", err)
+		}
+		return inputBytes, nil
+	}
+
+	return yaml.Marshal(promise)
+}
+
+func workflowRunArgs(promise *v1alpha1.Promise, c *ContainerCmdArgs, container v1alpha1.Container, volumes map[string]string) []string {
+	runArgs := []string{
+		"run", "--rm",
+		"--volume", volumes["input"] + ":/kratix/input:ro",
+		"--volume", volumes["output"] + ":/kratix/output",
+		"--volume", volumes["metadata"] + ":/kratix/metadata",
+		"--env", "KRATIX_WORKFLOW_TYPE=" + c.Lifecycle,
+		"--env", "KRATIX_WORKFLOW_ACTION=" + c.Action,
+		"--env", "KRATIX_PROMISE_NAME=" + promise.GetName(),
+	}
+
+	for _, env := range container.Env {
+		if env.ValueFrom != nil {
+			fmt.Printf("warning: env var %s of container %s uses valueFrom, which is not supported locally, skipping\n", env.Name, container.Name)
+			continue
+		}
+		runArgs = append(runArgs, "--env", env.Name+"="+env.Value)
+	}
+
+	if len(container.EnvFrom) > 0 || len(container.VolumeMounts) > 0 {
+		fmt.Printf("warning: envFrom and volumeMounts of container %s are not supported locally, skipping\n", container.Name)
+	}
+
+	var command []string
+	if len(container.Command) > 0 {
+		runArgs = append(runArgs, "--entrypoint", container.Command[0])
+		command = container.Command[1:]
+	}
+
+	runArgs = append(runArgs, container.Image)
+	runArgs = append(runArgs, command...)
+	return append(runArgs, container.Args...)
+}
+
+func forkRunCommand(engine string, runArgs []string) error {
+	runner := exec.Command(engine, runArgs...)
+	runner.Stdout = os.Stdout
+	runner.Stderr = os.Stderr
+	if err := runner.Run(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -22,12 +24,32 @@ It can be used to update the API GVK, or to add/remove properties to the API.
 
 The --group, --kind, --version, and --plural flags are used to update the API
 GVK. The --property flag is used to add or remove properties from the API. The
-format is PROPERTY-NAME:TYPE. Valid types are string, number, integer, object,
-and boolean.
+format is PROPERTY-NAME:TYPE[,OPTION...]. Valid types are string, number,
+integer, object, and boolean, arrays of any type in the form []TYPE, and maps
+in the form map[string]TYPE.
+
+The following options can be set after the type, separated by commas:
+  required            the property must be set
+  default=VALUE       the default value; arrays and maps take a JSON value
+  enum=A|B|C          the allowed values, or the allowed items of arrays and maps
+  min=N, max=N        the minimum and maximum value of numbers, length of
+                      strings, items of arrays or entries of maps
+  pattern=REGEX       the pattern strings, or the items of arrays and maps, match
+  description=TEXT    the description of the property
+Commas in option values must be escaped as '\,'.
 
 For object types, the property name can be nested using the '.' character.
 
-To remove a property, append a '-' to the property name.`
+To remove a property, append a '-' to the property name.
+
+The --version flag renames the current storage version of the API. To evolve the
+API without breaking existing resource requests, use --new-version instead: it
+adds a new served version with a copy of the storage version's schema, marks all
+other versions as deprecated and updates example-resource.yaml to the new
+version. The new version becomes the storage version unless --storage-version is
+set. Properties are updated in the new version and in the storage version, so
+that they are not pruned from the stored resources, or only in the storage
+version when --new-version is not set.`
 
 var updateAPICmd = &cobra.Command{
 	Use:   "api --property PROPERTY-NAME:TYPE",
@@ -39,6 +61,9 @@ var updateAPICmd = &cobra.Command{
   # add an integer 'port' property nested into a 'service' object
   kratix update api --property service.port:integer
 
+  # add a required enum property with a default value and a list of tags
+  kratix update api --property size:string,enum=small|large,default=small,required --property tags:[]string
+
   # removes the property from the API
   kratix update api --property region-
 
@@ -47,13 +72,19 @@ var updateAPICmd = &cobra.Command{
 
   # updates the version and the plural form
   kratix update api --version v1beta3 --plural mydbs
+
+  # adds a v1beta1 version with a new property, keeping v1alpha1 as the storage version
+  kratix update api --new-version v1beta1 --storage-version v1alpha1 --property tier:string
   `,
 	RunE: UpdateAPI,
 }
 
 var (
-	dir, apiVersion string
-	properties      []string
+	dir, apiVersion    string
+	properties         []string
+	newAPIVersion      string
+	storageAPIVersion  string
+	deprecationWarning string
 )
 
 func init() {
@@ -64,6 +95,10 @@ func init() {
 	updateAPICmd.Flags().StringVarP(&apiVersion, "version", "v", "", "The group version for the Promise")
 	updateAPICmd.Flags().StringVar(&plural, "plural", "", "The plural form of the kind")
 	updateAPICmd.Flags().StringArrayVarP(&properties, "property", "p", []string{}, "Property of the Promise API to update")
+	updateAPICmd.Flags().StringVar(&newAPIVersion, "new-version", "", "Add a new served version to the API, copied from the current storage version")
+	updateAPICmd.Flags().StringVar(&storageAPIVersion, "storage-version", "", "The version of the API to set as the storage version. Defaults to --new-version when it is set")
+	updateAPICmd.Flags().StringVar(&deprecationWarning, "deprecation-warning", "", "Warning returned to clients of the versions deprecated by --new-version")
+	updateAPICmd.MarkFlagsMutuallyExclusive("version", "new-version")
 }
 
 func UpdateAPI(cmd *cobra.Command, args []string) error {
@@ -119,76 +154,323 @@ func UpdateAPI(cmd *cobra.Command, args []string) error {
 func updateCRDBytes(crd *apiextensionsv1.CustomResourceDefinition) ([]byte, error) {
 	if gvkNeedsUpdate() {
 		updateGVK(crd)
+	}
+
+	if err := updateVersions(crd); err != nil {
+		return nil, err
+	}
+
+	if gvkNeedsUpdate() {
 		if err := updateExampleResource(crd); err != nil {
 			return nil, err
 		}
 	}
 
-	if crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties == nil {
-		crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"] = apiextensionsv1.JSONSchemaProps{
+	for _, crdVersion := range propertyVersions(crd) {
+		if err := updateProperties(crdVersion); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(crd)
+}
+
+// propertyVersions returns the versions of the API the properties are updated
+// in: the target version and, when it differs, the storage version, as fields
+// missing from the storage version are pruned from the stored resources
+func propertyVersions(crd *apiextensionsv1.CustomResourceDefinition) []*apiextensionsv1.CustomResourceDefinitionVersion {
+	versions := []*apiextensionsv1.CustomResourceDefinitionVersion{targetVersion(crd)}
+	if storage := storageVersion(crd); storage != versions[0] {
+		versions = append(versions, storage)
+	}
+	return versions
+}
+
+func updateProperties(crdVersion *apiextensionsv1.CustomResourceDefinitionVersion) error {
+	specSchema := crdVersion.Schema.OpenAPIV3Schema.Properties["spec"]
+	if specSchema.Properties == nil {
+		specSchema = apiextensionsv1.JSONSchemaProps{
 			Type:       "object",
 			Properties: map[string]apiextensionsv1.JSONSchemaProps{},
 		}
 	}
 
-	specProperties := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties
-
-	if len(properties) != 0 {
-		for _, prop := range properties {
-			parsedProps := strings.Split(prop, ":")
-			if len(parsedProps) != 2 {
-				if prop[len(prop)-1:] != "-" {
-					return nil, fmt.Errorf("invalid property format: %s", prop)
-				}
-				p := strings.TrimRight(prop, "-")
-
-				nestedFields := strings.Split(p, ".")
-				curr := specProperties
-				for i := 0; i < len(nestedFields)-1; i++ {
-					if curr[nestedFields[i]].Properties == nil {
-						curr = nil
-						break
-					}
-					curr = curr[nestedFields[i]].Properties
-				}
-				if curr != nil {
-					delete(curr, nestedFields[len(nestedFields)-1])
-				}
-				continue
+	for _, prop := range properties {
+		if !strings.Contains(prop, ":") {
+			if prop[len(prop)-1:] != "-" {
+				return fmt.Errorf("invalid property format: %s", prop)
 			}
+			removeProperty(&specSchema, strings.Split(strings.TrimRight(prop, "-"), "."))
+			continue
+		}
 
-			propNames := strings.Split(parsedProps[0], ".")
-			propType := parsedProps[1]
+		definition, err := ParseProperty(prop)
+		if err != nil {
+			return err
+		}
+		if err := setProperty(&specSchema, definition.Path, definition); err != nil {
+			return err
+		}
+	}
 
-			if !slices.Contains([]string{"string", "number", "integer", "object", "boolean"}, propType) {
-				return nil, fmt.Errorf("unsupported property type: %s", propType)
-			}
+	crdVersion.Schema.OpenAPIV3Schema.Properties["spec"] = specSchema
+	return nil
+}
 
-			curr := specProperties
-			lastProp := len(propNames) - 1
-			for i := 0; i < lastProp; i++ {
-				if curr[propNames[i]].Properties == nil {
-					curr[propNames[i]] = apiextensionsv1.JSONSchemaProps{
-						Type:       "object",
-						Properties: map[string]apiextensionsv1.JSONSchemaProps{},
-					}
-				}
-				if curr[propNames[i]].Type != "object" {
-					return nil, fmt.Errorf("nested field %s is not an object", propNames[i])
-				}
-
-				curr = curr[propNames[i]].Properties
-			}
-			curr[propNames[lastProp]] = apiextensionsv1.JSONSchemaProps{
-				Type: propType,
+// PropertyDefinition is a property of the Promise API as given to --property
+type PropertyDefinition struct {
+	Path     []string
+	Schema   apiextensionsv1.JSONSchemaProps
+	Required bool
+}
+
+// ParseProperty parses a PROPERTY-NAME:TYPE[,OPTION...] property definition
+func ParseProperty(prop string) (*PropertyDefinition, error) {
+	name, definition, _ := strings.Cut(prop, ":")
+	options := splitPropertyOptions(definition)
+
+	if name == "" || slices.Contains(strings.Split(name, "."), "") {
+		return nil, fmt.Errorf("invalid property format: %s", prop)
+	}
+
+	schema, err := parsePropertyType(options[0])
+	if err != nil {
+		return nil, err
+	}
+
+	property := &PropertyDefinition{Path: strings.Split(name, ".")}
+	for _, option := range options[1:] {
+		key, value, hasValue := strings.Cut(option, "=")
+		if key == "required" && !hasValue {
+			property.Required = true
+			continue
+		}
+		if !hasValue {
+			return nil, fmt.Errorf("invalid option %q for property %s", option, name)
+		}
+		if err := applyPropertyOption(&schema, key, value); err != nil {
+			return nil, fmt.Errorf("invalid option %q for property %s: %w", option, name, err)
+		}
+	}
+	property.Schema = schema
+	return property, nil
+}
+
+func splitPropertyOptions(definition string) []string {
+	var options []string
+	var current strings.Builder
+	for i := 0; i < len(definition); i++ {
+		switch {
+		case definition[i] == '\\' && i+1 < len(definition) && definition[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case definition[i] == ',':
+			options = append(options, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(definition[i])
+		}
+	}
+	return append(options, current.String())
+}
+
+func parsePropertyType(propType string) (apiextensionsv1.JSONSchemaProps, error) {
+	switch {
+	case strings.HasPrefix(propType, "[]"):
+		items, err := parsePropertyType(strings.TrimPrefix(propType, "[]"))
+		if err != nil {
+			return items, err
+		}
+		return apiextensionsv1.JSONSchemaProps{
+			Type:  "array",
+			Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &items},
+		}, nil
+	case strings.HasPrefix(propType, "map[string]"):
+		values, err := parsePropertyType(strings.TrimPrefix(propType, "map[string]"))
+		if err != nil {
+			return values, err
+		}
+		return apiextensionsv1.JSONSchemaProps{
+			Type:                 "object",
+			AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &values},
+		}, nil
+	case slices.Contains([]string{"string", "number", "integer", "object", "boolean"}, propType):
+		return apiextensionsv1.JSONSchemaProps{Type: propType}, nil
+	}
+	return apiextensionsv1.JSONSchemaProps{}, fmt.Errorf("unsupported property type: %s", propType)
+}
+
+// elementSchema returns the schema of the items of an array or the values of
+// a map, or the schema itself for any other type
+func elementSchema(schema *apiextensionsv1.JSONSchemaProps) *apiextensionsv1.JSONSchemaProps {
+	switch {
+	case schema.Items != nil && schema.Items.Schema != nil:
+		return elementSchema(schema.Items.Schema)
+	case schema.AdditionalProperties != nil && schema.AdditionalProperties.Schema != nil:
+		return elementSchema(schema.AdditionalProperties.Schema)
+	}
+	return schema
+}
+
+func applyPropertyOption(schema *apiextensionsv1.JSONSchemaProps, key, value string) error {
+	switch key {
+	case "default":
+		defaultValue, err := propertyValue(schema.Type, value)
+		if err != nil {
+			return err
+		}
+		schema.Default = &defaultValue
+	case "enum":
+		element := elementSchema(schema)
+		element.Enum = nil
+		for _, v := range strings.Split(value, "|") {
+			enumValue, err := propertyValue(element.Type, v)
+			if err != nil {
+				return err
 			}
+			element.Enum = append(element.Enum, enumValue)
 		}
+	case "min", "max":
+		return applyPropertyLimit(schema, key, value)
+	case "pattern":
+		element := elementSchema(schema)
+		if element.Type != "string" {
+			return fmt.Errorf("pattern is only supported for strings")
+		}
+		if _, err := regexp.Compile(value); err != nil {
+			return err
+		}
+		element.Pattern = value
+	case "description":
+		schema.Description = value
+	default:
+		return fmt.Errorf("unknown option %s", key)
 	}
-	return json.Marshal(crd)
+	return nil
+}
+
+func applyPropertyLimit(schema *apiextensionsv1.JSONSchemaProps, key, value string) error {
+	if schema.Type == "number" || schema.Type == "integer" {
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if key == "min" {
+			schema.Minimum = &limit
+		} else {
+			schema.Maximum = &limit
+		}
+		return nil
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	var minLimit, maxLimit **int64
+	switch {
+	case schema.Type == "string":
+		minLimit, maxLimit = &schema.MinLength, &schema.MaxLength
+	case schema.Type == "array":
+		minLimit, maxLimit = &schema.MinItems, &schema.MaxItems
+	case schema.Type == "object" && schema.AdditionalProperties != nil:
+		minLimit, maxLimit = &schema.MinProperties, &schema.MaxProperties
+	default:
+		return fmt.Errorf("%s is not supported for type %s", key, schema.Type)
+	}
+	if key == "min" {
+		*minLimit = &limit
+	} else {
+		*maxLimit = &limit
+	}
+	return nil
+}
+
+// propertyValue converts a value given on the command line to the JSON value
+// of the given type; arrays and objects are expected to be given as JSON
+func propertyValue(propType, value string) (apiextensionsv1.JSON, error) {
+	var v any
+	var err error
+	switch propType {
+	case "string":
+		v = value
+	case "integer":
+		v, err = strconv.ParseInt(value, 10, 64)
+	case "number":
+		v, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		v, err = strconv.ParseBool(value)
+	default:
+		err = json.Unmarshal([]byte(value), &v)
+	}
+	if err != nil {
+		return apiextensionsv1.JSON{}, fmt.Errorf("invalid %s value %q", propType, value)
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return apiextensionsv1.JSON{}, err
+	}
+	return apiextensionsv1.JSON{Raw: raw}, nil
+}
+
+func setProperty(parent *apiextensionsv1.JSONSchemaProps, path []string, property *PropertyDefinition) error {
+	if parent.Properties == nil {
+		parent.Properties = map[string]apiextensionsv1.JSONSchemaProps{}
+	}
+
+	name := path[0]
+	if len(path) == 1 {
+		parent.Properties[name] = property.Schema
+		parent.Required = updateRequired(parent.Required, name, property.Required)
+		return nil
+	}
+
+	child := parent.Properties[name]
+	if child.Properties == nil {
+		child = apiextensionsv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{},
+		}
+	}
+	if child.Type != "object" {
+		return fmt.Errorf("nested field %s is not an object", name)
+	}
+	if err := setProperty(&child, path[1:], property); err != nil {
+		return err
+	}
+	parent.Properties[name] = child
+	return nil
+}
+
+func removeProperty(parent *apiextensionsv1.JSONSchemaProps, path []string) {
+	name := path[0]
+	if len(path) == 1 {
+		delete(parent.Properties, name)
+		parent.Required = updateRequired(parent.Required, name, false)
+		return
+	}
+
+	child, ok := parent.Properties[name]
+	if !ok || child.Properties == nil {
+		return
+	}
+	removeProperty(&child, path[1:])
+	parent.Properties[name] = child
+}
+
+func updateRequired(required []string, name string, isRequired bool) []string {
+	required = slices.DeleteFunc(required, func(r string) bool { return r == name })
+	if isRequired {
+		required = append(required, name)
+	}
+	if len(required) == 0 {
+		return nil
+	}
+	return required
 }
 
 func gvkNeedsUpdate() bool {
-	if apiVersion != "" || kind != "" || group != "" || plural != "" {
+	if apiVersion != "" || kind != "" || group != "" || plural != "" || newAPIVersion != "" {
 		return true
 	}
 	return false
@@ -201,7 +483,7 @@ func updateGVK(crd *apiextensionsv1.CustomResourceDefinition) {
 	}
 
 	if apiVersion != "" {
-		crd.Spec.Versions[0].Name = apiVersion
+		targetVersion(crd).Name = apiVersion
 	}
 
 	if group != "" {
@@ -214,6 +496,80 @@ func updateGVK(crd *apiextensionsv1.CustomResourceDefinition) {
 	crd.Name = fmt.Sprintf("%s.%s", crd.Spec.Names.Plural, crd.Spec.Group)
 }
 
+// targetVersion returns the version of the API being updated: the version added
+// with --new-version if set, or the storage version otherwise
+func targetVersion(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinitionVersion {
+	if newAPIVersion != "" {
+		for i := range crd.Spec.Versions {
+			if crd.Spec.Versions[i].Name == newAPIVersion {
+				return &crd.Spec.Versions[i]
+			}
+		}
+	}
+	return storageVersion(crd)
+}
+
+func storageVersion(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinitionVersion {
+	for i := range crd.Spec.Versions {
+		if crd.Spec.Versions[i].Storage {
+			return &crd.Spec.Versions[i]
+		}
+	}
+	return &crd.Spec.Versions[0]
+}
+
+func updateVersions(crd *apiextensionsv1.CustomResourceDefinition) error {
+	storage := storageAPIVersion
+	if newAPIVersion != "" {
+		for _, v := range crd.Spec.Versions {
+			if v.Name == newAPIVersion {
+				return fmt.Errorf("version %s already exists in the API", newAPIVersion)
+			}
+		}
+
+		version := *storageVersion(crd).DeepCopy()
+		version.Name = newAPIVersion
+		version.Served = true
+		version.Storage = false
+		version.Deprecated = false
+		version.DeprecationWarning = nil
+
+		for i := range crd.Spec.Versions {
+			old := &crd.Spec.Versions[i]
+			if old.Deprecated {
+				continue
+			}
+			warning := deprecationWarning
+			if warning == "" {
+				warning = fmt.Sprintf("%s/%s %s is deprecated; use %s/%s %s", crd.Spec.Group, old.Name, crd.Spec.Names.Kind, crd.Spec.Group, newAPIVersion, crd.Spec.Names.Kind)
+			}
+			old.Deprecated = true
+			old.DeprecationWarning = &warning
+			fmt.Printf("Version %s marked as deprecated\n", old.Name)
+		}
+		crd.Spec.Versions = append(crd.Spec.Versions, version)
+
+		if storage == "" {
+			storage = newAPIVersion
+		}
+	}
+
+	if storage == "" {
+		return nil
+	}
+
+	if !slices.ContainsFunc(crd.Spec.Versions, func(v apiextensionsv1.CustomResourceDefinitionVersion) bool {
+		return v.Name == storage
+	}) {
+		return fmt.Errorf("version %s not found in the API", storage)
+	}
+
+	for i := range crd.Spec.Versions {
+		crd.Spec.Versions[i].Storage = crd.Spec.Versions[i].Name == storage
+	}
+	return nil
+}
+
 func updateExampleResource(crd *apiextensionsv1.CustomResourceDefinition) error {
 	rrFilePath := filepath.Join(dir, resourceFileName)
 	rrBytes, err := os.ReadFile(rrFilePath)
@@ -225,7 +581,7 @@ func updateExampleResource(crd *apiextensionsv1.CustomResourceDefinition) error
 	if err = yaml.Unmarshal(rrBytes, &rr); err != nil {
 		return err
 	}
-	rr.Object["apiVersion"] = fmt.Sprintf("%s/%s", crd.Spec.Group, crd.Spec.Versions[0].Name)
+	rr.Object["apiVersion"] = fmt.Sprintf("%s/%s", crd.Spec.Group, targetVersion(crd).Name)
 	rr.Object["kind"] = crd.Spec.Names.Kind
 	updatedRR, err := yaml.Marshal(rr.Object)
 	if err != nil {
@@ -0,0 +1,76 @@
+package cmd_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/syntasso/kratix-cli/cmd"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("UpdateAPI", func() {
+	Describe("ParseProperty", func() {
+		It("parses a plain property", func() {
+			property, err := ParseProperty("service.port:integer")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(property.Path).To(Equal([]string{"service", "port"}))
+			Expect(property.Schema).To(Equal(apiextensionsv1.JSONSchemaProps{Type: "integer"}))
+			Expect(property.Required).To(BeFalse())
+		})
+
+		It("parses arrays and maps", func() {
+			property, err := ParseProperty("tags:[]map[string]string")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(property.Schema.Type).To(Equal("array"))
+			Expect(property.Schema.Items.Schema.Type).To(Equal("object"))
+			Expect(property.Schema.Items.Schema.AdditionalProperties.Schema.Type).To(Equal("string"))
+		})
+
+		It("parses the options", func() {
+			property, err := ParseProperty(`size:string,enum=small|large,default=small,required,min=1,max=5,description=the size\, in words`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(property.Required).To(BeTrue())
+			Expect(property.Schema).To(Equal(apiextensionsv1.JSONSchemaProps{
+				Type:        "string",
+				Enum:        []apiextensionsv1.JSON{{Raw: []byte(`"small"`)}, {Raw: []byte(`"large"`)}},
+				Default:     &apiextensionsv1.JSON{Raw: []byte(`"small"`)},
+				MinLength:   ptr.To[int64](1),
+				MaxLength:   ptr.To[int64](5),
+				Description: "the size, in words",
+			}))
+		})
+
+		It("applies enum and pattern to the items of arrays, and limits to the array", func() {
+			property, err := ParseProperty("zones:[]string,enum=a|b,pattern=^[a-z]$,max=2,default=[\"a\"]")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(property.Schema.MaxItems).To(Equal(ptr.To[int64](2)))
+			Expect(property.Schema.Default.Raw).To(MatchJSON(`["a"]`))
+			Expect(property.Schema.Items.Schema.Enum).To(HaveLen(2))
+			Expect(property.Schema.Items.Schema.Pattern).To(Equal("^[a-z]$"))
+		})
+
+		It("converts values to the type of the property", func() {
+			property, err := ParseProperty("replicas:integer,default=3,min=1,enum=1|3|5")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(property.Schema.Default.Raw).To(MatchJSON(`3`))
+			Expect(property.Schema.Minimum).To(Equal(ptr.To(1.0)))
+			Expect(property.Schema.Enum[2].Raw).To(MatchJSON(`5`))
+		})
+
+		DescribeTable("invalid definitions",
+			func(definition, expectedErr string) {
+				_, err := ParseProperty(definition)
+				Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			},
+			Entry("unsupported type", "size:array", "unsupported property type: array"),
+			Entry("unsupported nested type", "size:[]list", "unsupported property type: list"),
+			Entry("empty name", ":string", "invalid property format"),
+			Entry("unknown option", "size:string,colour=red", "unknown option colour"),
+			Entry("option without a value", "size:string,optional", `invalid option "optional"`),
+			Entry("default of the wrong type", "size:integer,default=big", `invalid integer value "big"`),
+			Entry("limit on a boolean", "enabled:boolean,max=1", "max is not supported for type boolean"),
+			Entry("pattern on a number", "size:number,pattern=^1$", "pattern is only supported for strings"),
+			Entry("invalid pattern", "size:string,pattern=[", "missing closing ]"),
+		)
+	})
+})
@@ -72,7 +72,18 @@ func promiseFileMode() (mode string, fileToUpdate string) {
 	return "split", dependenciesFileName
 }
 
+// buildDependencies reads the dependencies in the file or directory and sets
+// the namespace of the namespaced ones that do not set one to default
 func buildDependencies(dependenciesDir string) ([]v1alpha1.Dependency, error) {
+	dependencies, err := readDependencies(dependenciesDir)
+	if err != nil {
+		return nil, err
+	}
+	defaultDependencyNamespaces(dependencies, "default")
+	return dependencies, nil
+}
+
+func readDependencies(dependenciesDir string) ([]v1alpha1.Dependency, error) {
 	dependenciesDirInfo, err := os.Stat(dependenciesDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat dependency: %s", dependenciesDir)
@@ -102,7 +113,7 @@ func buildDependencies(dependenciesDir string) ([]v1alpha1.Dependency, error) {
 	for _, fileInfo := range files {
 		fileName := filepath.Join(dependenciesDir, fileInfo.Name())
 		if fileInfo.IsDir() {
-			subDirDependencies, err := buildDependencies(fileName)
+			subDirDependencies, err := readDependencies(fileName)
 			if err != nil {
 				return nil, err
 			}
@@ -127,28 +138,29 @@ func buildDependencies(dependenciesDir string) ([]v1alpha1.Dependency, error) {
 }
 
 func extractDepFromFile(fileName string) ([]v1alpha1.Dependency, error) {
-	var dependencies []v1alpha1.Dependency
 	file, err := os.Open(fileName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open dependency file %s: %s", fileName, err)
 	}
+	defer file.Close()
+	return decodeDependencies(file, fileName)
+}
 
-	decoder := yaml.NewYAMLOrJSONDecoder(file, 2048)
+func decodeDependencies(reader io.Reader, source string) ([]v1alpha1.Dependency, error) {
+	var dependencies []v1alpha1.Dependency
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 2048)
 	for {
 		var obj *unstructured.Unstructured
-		err = decoder.Decode(&obj)
+		err := decoder.Decode(&obj)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode dependency file %s: %s", fileName, err)
+			return nil, fmt.Errorf("failed to decode dependency file %s: %s", source, err)
 		}
 		if obj == nil {
 			continue
 		}
-		if obj.GetNamespace() == "" {
-			obj.SetNamespace("default")
-		}
 		dependencies = append(dependencies, v1alpha1.Dependency{Unstructured: *obj})
 	}
 	return dependencies, nil
@@ -2,62 +2,129 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/spf13/cobra"
-	"github.com/syntasso/kratix/api/v1alpha1"
 	"os"
 	"path/filepath"
-	"sigs.k8s.io/yaml"
 	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/syntasso/kratix/api/v1alpha1"
+	"sigs.k8s.io/yaml"
 )
 
 var updateDestinationSelector = &cobra.Command{
 	Use:   "destination-selector KEY=VALUE",
 	Short: "Command to update destination selectors",
-	Long:  "Command to update destination selectors",
+	Long: `Command to update destination selectors.
+
+Destination selectors are stored in promise.yaml, or in destination-selectors.yaml
+for Promises initialised with --split, which 'kratix build promise' merges into
+the Promise.
+
+A Promise can have multiple destination selector entries; use --index to choose
+the entry to update. Using the index after the last entry adds a new one, and
+entries left without labels are removed. Kratix merges the matchLabels of all
+entries when scheduling, and does not support matchExpressions in Promise
+destination selectors.`,
 	Example: `  # adds and updates a destination selector
   kratix update destination-selector env=dev
   # removes an existing destination selector
   kratix update destination-selector zone-
+  # adds a label to the second destination selector entry
+  kratix update destination-selector zone=eu --index 1
 `,
 	RunE: UpdateSelector,
 	Args: cobra.ExactArgs(1),
 }
 
+var selectorIndex int
+
 func init() {
 	updateCmd.AddCommand(updateDestinationSelector)
 	updateDestinationSelector.Flags().StringVarP(&dir, "dir", "d", ".", "Directory to read Promise from")
+	updateDestinationSelector.Flags().IntVarP(&selectorIndex, "index", "i", 0, "Index of the destination selector entry to update")
 }
 
 func UpdateSelector(cmd *cobra.Command, args []string) error {
-	promise, err := getPromise(filepath.Join(dir, "promise.yaml"))
-	if err != nil {
-		return fmt.Errorf("failed to find promise.yaml in directory: %v", err)
+	mode, _ := promiseFileMode()
+	if mode == "split" && !fileExists(filepath.Join(dir, apiFileName)) && !fileExists(filepath.Join(dir, dependenciesFileName)) {
+		return fmt.Errorf("failed to find promise.yaml in directory, or api.yaml and dependencies.yaml for Promises initialised with --split")
 	}
 
-	if parsed := strings.Split(args[0], "="); len(parsed) == 2 {
-		if len(promise.Spec.DestinationSelectors) == 0 {
-			promise.Spec.DestinationSelectors = []v1alpha1.PromiseScheduling{{MatchLabels: map[string]string{}}}
+	var promise v1alpha1.Promise
+	var selectors []v1alpha1.PromiseScheduling
+	var err error
+	switch mode {
+	case "flat":
+		if promise, err = getPromise(filepath.Join(dir, promiseFileName)); err != nil {
+			return fmt.Errorf("failed to find promise.yaml in directory: %v", err)
+		}
+		selectors = promise.Spec.DestinationSelectors
+	case "split":
+		if selectors, err = getDestinationSelectors(filepath.Join(dir, destinationSelectorsFileName)); err != nil {
+			return err
 		}
+	}
+
+	if selectorIndex < 0 || selectorIndex > len(selectors) {
+		return fmt.Errorf("invalid destination selector index %d: the Promise has %d destination selector(s)", selectorIndex, len(selectors))
+	}
+	if selectorIndex == len(selectors) {
+		selectors = append(selectors, v1alpha1.PromiseScheduling{})
+	}
+	if selectors[selectorIndex].MatchLabels == nil {
+		selectors[selectorIndex].MatchLabels = map[string]string{}
+	}
+
+	if parsed := strings.Split(args[0], "="); len(parsed) == 2 {
 		key, value := parsed[0], parsed[1]
-		promise.Spec.DestinationSelectors[0].MatchLabels[key] = value
+		selectors[selectorIndex].MatchLabels[key] = value
 	} else {
 		if args[0][len(args[0])-1:] != "-" {
 			return fmt.Errorf("invalid destination key: %s", args[0])
 		}
 		key := strings.TrimRight(args[0], "-")
-		if len(promise.Spec.DestinationSelectors) > 0 {
-			delete(promise.Spec.DestinationSelectors[0].MatchLabels, key)
-		}
+		delete(selectors[selectorIndex].MatchLabels, key)
 	}
 
-	var promiseBytes []byte
-	if promiseBytes, err = yaml.Marshal(promise); err != nil {
-		return err
+	if len(selectors[selectorIndex].MatchLabels) == 0 {
+		selectors = append(selectors[:selectorIndex], selectors[selectorIndex+1:]...)
+	}
+
+	switch mode {
+	case "flat":
+		promise.Spec.DestinationSelectors = selectors
+		err = writeYAML(filepath.Join(dir, promiseFileName), promise)
+	case "split":
+		err = writeYAML(filepath.Join(dir, destinationSelectorsFileName), selectors)
 	}
-	if err = os.WriteFile(filepath.Join(dir, "promise.yaml"), promiseBytes, filePerm); err != nil {
+	if err != nil {
 		return err
 	}
 
 	fmt.Println("Promise destination selector updated")
 	return nil
 }
+
+func getDestinationSelectors(filePath string) ([]v1alpha1.PromiseScheduling, error) {
+	var selectors []v1alpha1.PromiseScheduling
+	if !fileExists(filePath) {
+		return selectors, nil
+	}
+
+	selectorBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(selectorBytes, &selectors); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+	return selectors, nil
+}
+
+func writeYAML(filePath string, data any) error {
+	fileBytes, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, fileBytes, filePerm)
+}
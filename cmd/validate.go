@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Command to validate kratix resources",
+	Long:  "Command to validate kratix resources",
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
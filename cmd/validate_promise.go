@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/syntasso/kratix/api/v1alpha1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	crdvalidation "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	apiservervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+)
+
+var validatePromiseCmd = &cobra.Command{
+	Use:   "promise",
+	Short: "Command to validate a Kratix Promise",
+	Long: `Command to validate a Kratix Promise without access to a cluster.
+
+It loads the Promise from promise.yaml or, if the Promise was initialised with
+--split, from api.yaml, dependencies.yaml and the workflows directory. The
+Promise API must be a valid structural CRD, every workflow must contain valid
+Pipelines, and example-resource.yaml must conform to the Promise API schema.
+
+All problems found are reported and the command exits with a non-zero code if
+the Promise is invalid.`,
+	Example: `  # validate the promise in the current directory
+  kratix validate promise
+
+  # validate the promise in a given directory
+  kratix validate promise --dir ~/path/to/promise-bundle/`,
+	Args: cobra.NoArgs,
+	RunE: ValidatePromise,
+}
+
+func init() {
+	validateCmd.AddCommand(validatePromiseCmd)
+	validatePromiseCmd.Flags().StringVarP(&dir, "dir", "d", ".", "Directory to read the Promise from")
+}
+
+// promiseValidationError is a single problem found in a file of the Promise
+type promiseValidationError struct {
+	File string
+	Err  *field.Error
+}
+
+func (e promiseValidationError) String() string {
+	if e.Err.Field == "<nil>" {
+		return fmt.Sprintf("%s: %s", e.File, e.Err.ErrorBody())
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Err.Error())
+}
+
+type promiseValidator struct {
+	dir    string
+	errors []promiseValidationError
+}
+
+func ValidatePromise(cmd *cobra.Command, args []string) error {
+	v := &promiseValidator{dir: dir}
+	if err := v.validate(); err != nil {
+		return err
+	}
+
+	if len(v.errors) > 0 {
+		for _, e := range v.errors {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		return fmt.Errorf("promise validation failed: %d error(s) found", len(v.errors))
+	}
+
+	fmt.Println("Promise is valid")
+	return nil
+}
+
+func (v *promiseValidator) add(file string, errs ...*field.Error) {
+	for _, err := range errs {
+		v.errors = append(v.errors, promiseValidationError{File: file, Err: err})
+	}
+}
+
+// invalidField reports a problem that is not tied to a specific field value
+func invalidField(fldPath *field.Path, detail string) *field.Error {
+	return field.Invalid(fldPath, field.OmitValueType{}, detail)
+}
+
+func (v *promiseValidator) validate() error {
+	if fileExists(filepath.Join(v.dir, promiseFileName)) {
+		return v.validateFlat()
+	}
+
+	if !fileExists(filepath.Join(v.dir, apiFileName)) && !fileExists(filepath.Join(v.dir, dependenciesFileName)) {
+		return fmt.Errorf("failed to find %s or %s in directory %s", promiseFileName, apiFileName, v.dir)
+	}
+	return v.validateSplit()
+}
+
+func (v *promiseValidator) validateFlat() error {
+	promiseBytes, err := os.ReadFile(filepath.Join(v.dir, promiseFileName))
+	if err != nil {
+		return err
+	}
+
+	var promise v1alpha1.Promise
+	if err := yaml.Unmarshal(promiseBytes, &promise); err != nil {
+		v.add(promiseFileName, invalidField(nil, fmt.Sprintf("failed to parse Promise: %s", err)))
+		return nil
+	}
+
+	if promise.Kind != "Promise" || promise.APIVersion != v1alpha1.GroupVersion.String() {
+		v.add(promiseFileName, field.Invalid(field.NewPath("kind"), promise.Kind, fmt.Sprintf("expected a Promise of apiVersion %s", v1alpha1.GroupVersion.String())))
+	}
+	if promise.Name == "" {
+		v.add(promiseFileName, field.Required(field.NewPath("metadata", "name"), ""))
+	}
+
+	if promise.ContainsAPI() {
+		crd, err := promise.GetAPIAsCRD()
+		if err != nil {
+			v.add(promiseFileName, invalidField(field.NewPath("spec", "api"), err.Error()))
+		} else {
+			v.validateAPI(promiseFileName, field.NewPath("spec", "api"), crd)
+		}
+	}
+
+	v.validateDependencies(promiseFileName, field.NewPath("spec", "dependencies"), promise.Spec.Dependencies)
+	v.validateWorkflows(&promise, false)
+	return nil
+}
+
+func (v *promiseValidator) validateSplit() error {
+	apiPath := filepath.Join(v.dir, apiFileName)
+	if fileExists(apiPath) {
+		apiBytes, err := os.ReadFile(apiPath)
+		if err != nil {
+			return err
+		}
+
+		var crd apiextensionsv1.CustomResourceDefinition
+		if err := yaml.Unmarshal(apiBytes, &crd); err != nil {
+			v.add(apiFileName, invalidField(nil, fmt.Sprintf("failed to parse CRD: %s", err)))
+		} else if len(apiBytes) > 0 {
+			v.validateAPI(apiFileName, nil, &crd)
+		}
+	}
+
+	dependenciesPath := filepath.Join(v.dir, dependenciesFileName)
+	if fileExists(dependenciesPath) {
+		dependencyBytes, err := os.ReadFile(dependenciesPath)
+		if err != nil {
+			return err
+		}
+
+		var dependencies v1alpha1.Dependencies
+		if err := yaml.Unmarshal(dependencyBytes, &dependencies); err != nil {
+			v.add(dependenciesFileName, invalidField(nil, fmt.Sprintf("failed to parse dependencies: %s", err)))
+		} else {
+			v.validateDependencies(dependenciesFileName, nil, dependencies)
+		}
+	}
+
+	promise, err := LoadPromiseWithWorkflows(v.dir)
+	if err != nil {
+		v.add("workflows", invalidField(nil, fmt.Sprintf("failed to load workflows: %s", err)))
+		return nil
+	}
+	v.validateWorkflows(promise, true)
+	return nil
+}
+
+func (v *promiseValidator) validateAPI(file string, fldPath *field.Path, crd *apiextensionsv1.CustomResourceDefinition) {
+	if crd.APIVersion != apiextensionsv1.SchemeGroupVersion.String() || crd.Kind != "CustomResourceDefinition" {
+		v.add(file, field.Invalid(fldPath.Child("kind"), crd.Kind, fmt.Sprintf("expected a CustomResourceDefinition of apiVersion %s", apiextensionsv1.SchemeGroupVersion.String())))
+	}
+
+	defaultedCRD := crd.DeepCopy()
+	apiextensionsv1.SetObjectDefaults_CustomResourceDefinition(defaultedCRD)
+
+	var internalCRD apiextensions.CustomResourceDefinition
+	if err := apiextensionsv1.Convert_v1_CustomResourceDefinition_To_apiextensions_CustomResourceDefinition(defaultedCRD, &internalCRD, nil); err != nil {
+		v.add(file, invalidField(fldPath, fmt.Sprintf("failed to convert CRD: %s", err)))
+		return
+	}
+	for _, crdVersion := range internalCRD.Spec.Versions {
+		if crdVersion.Storage {
+			internalCRD.Status.StoredVersions = append(internalCRD.Status.StoredVersions, crdVersion.Name)
+		}
+	}
+
+	crdErrs := crdvalidation.ValidateCustomResourceDefinition(context.Background(), &internalCRD)
+	for _, err := range crdErrs {
+		if strings.HasPrefix(err.Field, "status.") {
+			continue
+		}
+		err.Field = prefixFieldPath(fldPath, versionedCRDFieldPath(err.Field, len(crd.Spec.Versions)))
+		v.add(file, err)
+	}
+
+	if len(crdErrs) == 0 {
+		v.validateExampleResource(crd)
+	}
+}
+
+// versionedCRDFieldPath maps the top-level fields of the internal CRD
+// representation back to the per-version fields of the v1 CRD on disk
+func versionedCRDFieldPath(path string, versions int) string {
+	if versions != 1 {
+		return path
+	}
+	for internalField, versionedField := range map[string]string{
+		"spec.validation":               "spec.versions[0].schema",
+		"spec.subresources":             "spec.versions[0].subresources",
+		"spec.additionalPrinterColumns": "spec.versions[0].additionalPrinterColumns",
+		"spec.selectableFields":         "spec.versions[0].selectableFields",
+	} {
+		if path == internalField || strings.HasPrefix(path, internalField+".") || strings.HasPrefix(path, internalField+"[") {
+			return versionedField + strings.TrimPrefix(path, internalField)
+		}
+	}
+	return path
+}
+
+func prefixFieldPath(fldPath *field.Path, path string) string {
+	if fldPath == nil {
+		return path
+	}
+	if path == "" {
+		return fldPath.String()
+	}
+	return fldPath.String() + "." + path
+}
+
+func (v *promiseValidator) validateExampleResource(crd *apiextensionsv1.CustomResourceDefinition) {
+	rrBytes, err := os.ReadFile(filepath.Join(v.dir, resourceFileName))
+	if err != nil {
+		v.add(resourceFileName, invalidField(nil, fmt.Sprintf("failed to read example resource: %s", err)))
+		return
+	}
+
+	var rr unstructured.Unstructured
+	if err := yaml.Unmarshal(rrBytes, &rr); err != nil {
+		v.add(resourceFileName, invalidField(nil, fmt.Sprintf("failed to parse example resource: %s", err)))
+		return
+	}
+
+	if rr.GetKind() != crd.Spec.Names.Kind {
+		v.add(resourceFileName, field.Invalid(field.NewPath("kind"), rr.GetKind(), fmt.Sprintf("must match the Promise API kind %s", crd.Spec.Names.Kind)))
+	}
+	if rr.GetName() == "" {
+		v.add(resourceFileName, field.Required(field.NewPath("metadata", "name"), ""))
+	}
+
+	gv, err := schema.ParseGroupVersion(rr.GetAPIVersion())
+	if err != nil || gv.Group != crd.Spec.Group {
+		v.add(resourceFileName, field.Invalid(field.NewPath("apiVersion"), rr.GetAPIVersion(), fmt.Sprintf("must be in the Promise API group %s", crd.Spec.Group)))
+		return
+	}
+
+	var crdVersion *apiextensionsv1.CustomResourceDefinitionVersion
+	for i := range crd.Spec.Versions {
+		if crd.Spec.Versions[i].Name == gv.Version && crd.Spec.Versions[i].Served {
+			crdVersion = &crd.Spec.Versions[i]
+			break
+		}
+	}
+	if crdVersion == nil {
+		v.add(resourceFileName, field.Invalid(field.NewPath("apiVersion"), rr.GetAPIVersion(), "must be a version served by the Promise API"))
+		return
+	}
+	if crdVersion.Schema == nil || crdVersion.Schema.OpenAPIV3Schema == nil {
+		return
+	}
+
+	var internalSchema apiextensions.JSONSchemaProps
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(crdVersion.Schema.OpenAPIV3Schema, &internalSchema, nil); err != nil {
+		v.add(resourceFileName, invalidField(nil, fmt.Sprintf("failed to convert Promise API schema: %s", err)))
+		return
+	}
+
+	validator, _, err := apiservervalidation.NewSchemaValidator(&internalSchema)
+	if err != nil {
+		v.add(resourceFileName, invalidField(nil, fmt.Sprintf("failed to build Promise API schema validator: %s", err)))
+		return
+	}
+	v.add(resourceFileName, apiservervalidation.ValidateCustomResource(nil, rr.Object, validator)...)
+
+	structural, err := structuralschema.NewStructural(&internalSchema)
+	if err != nil {
+		return
+	}
+	unknownFields := pruning.PruneWithOptions(rr.DeepCopy().Object, structural, true, structuralschema.UnknownFieldPathOptions{TrackUnknownFieldPaths: true})
+	for _, unknownField := range unknownFields {
+		v.add(resourceFileName, &field.Error{
+			Type:   field.ErrorTypeForbidden,
+			Field:  unknownField,
+			Detail: "unknown field, not defined in the Promise API schema",
+		})
+	}
+}
+
+func (v *promiseValidator) validateDependencies(file string, fldPath *field.Path, dependencies v1alpha1.Dependencies) {
+	for i, dep := range dependencies {
+		depPath := fldPath.Index(i)
+		if dep.GetAPIVersion() == "" {
+			v.add(file, field.Required(depPath.Child("apiVersion"), ""))
+		}
+		if dep.GetKind() == "" {
+			v.add(file, field.Required(depPath.Child("kind"), ""))
+		}
+		if dep.GetName() == "" {
+			v.add(file, field.Required(depPath.Child("metadata", "name"), ""))
+		}
+	}
+}
+
+func (v *promiseValidator) validateWorkflows(promise *v1alpha1.Promise, splitFiles bool) {
+	allPipelines, err := v1alpha1.NewPipelinesMap(promise, ctrl.LoggerFrom(context.Background()))
+	if err != nil {
+		file, fldPath := promiseFileName, field.NewPath("spec", "workflows")
+		if splitFiles {
+			file, fldPath = "workflows", nil
+		}
+		v.add(file, invalidField(fldPath, err.Error()))
+		return
+	}
+
+	for _, lifecycle := range []v1alpha1.Type{v1alpha1.WorkflowTypePromise, v1alpha1.WorkflowTypeResource} {
+		for _, action := range []v1alpha1.Action{v1alpha1.WorkflowActionConfigure, v1alpha1.WorkflowActionDelete} {
+			file := promiseFileName
+			fldPath := field.NewPath("spec", "workflows", string(lifecycle), string(action))
+			if splitFiles {
+				file = filepath.Join("workflows", string(lifecycle), string(action), "workflow.yaml")
+				fldPath = nil
+			}
+			v.validatePipelines(file, fldPath, allPipelines[lifecycle][action])
+		}
+	}
+}
+
+func (v *promiseValidator) validatePipelines(file string, fldPath *field.Path, pipelines []v1alpha1.Pipeline) {
+	pipelineNames := map[string]bool{}
+	for i, pipeline := range pipelines {
+		pipelinePath := fldPath.Index(i)
+		if pipeline.GetName() == "" {
+			v.add(file, field.Required(pipelinePath.Child("metadata", "name"), ""))
+		} else if pipelineNames[pipeline.GetName()] {
+			v.add(file, field.Duplicate(pipelinePath.Child("metadata", "name"), pipeline.GetName()))
+		}
+		pipelineNames[pipeline.GetName()] = true
+
+		if len(pipeline.Spec.Containers) == 0 {
+			v.add(file, field.Required(pipelinePath.Child("spec", "containers"), "must have at least one container"))
+		}
+
+		containerNames := map[string]bool{}
+		for j, container := range pipeline.Spec.Containers {
+			containerPath := pipelinePath.Child("spec", "containers").Index(j)
+			if container.Name == "" {
+				v.add(file, field.Required(containerPath.Child("name"), ""))
+			} else if containerNames[container.Name] {
+				v.add(file, field.Duplicate(containerPath.Child("name"), container.Name))
+			}
+			containerNames[container.Name] = true
+
+			if container.Image == "" {
+				v.add(file, field.Required(containerPath.Child("image"), ""))
+			}
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package internal
 
-import "github.com/hashicorp/go-getter"
+import (
+	"net/http"
+
+	"github.com/hashicorp/go-getter"
+)
 
 func SetGetModuleFunc(f func(dst, src string, opts ...getter.ClientOption) error) {
 	getModule = f
@@ -9,3 +13,7 @@ func SetGetModuleFunc(f func(dst, src string, opts ...getter.ClientOption) error
 func SetMkdirTempFunc(f func(dir, pattern string) (string, error)) {
 	mkdirTemp = f
 }
+
+func SetRegistryClient(client *http.Client) {
+	registryClient = client
+}
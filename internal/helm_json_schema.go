@@ -0,0 +1,379 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/utils/pointer"
+)
+
+// HelmJSONSchemaToSchema converts the values.schema.json of a Helm chart into
+// a structural schema. Local $refs are resolved, and keys of the values that
+// the JSON schema does not document are inferred as in HelmValuesToSchema.
+func HelmJSONSchemaToSchema(jsonSchema []byte, values map[string]any) (*apiextensionsv1.JSONSchemaProps, error) {
+	var root map[string]any
+	if err := json.Unmarshal(jsonSchema, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse values.schema.json: %w", err)
+	}
+
+	c := &jsonSchemaConverter{root: root}
+	schema, err := c.convert(root, values, nil)
+	if err != nil {
+		return nil, err
+	}
+	schema.Type = "object"
+	schema.XPreserveUnknownFields = nil
+	if schema.Properties == nil {
+		schema.Properties = map[string]apiextensionsv1.JSONSchemaProps{}
+	}
+	return schema, nil
+}
+
+type jsonSchemaConverter struct {
+	root map[string]any
+}
+
+func (c *jsonSchemaConverter) convert(node map[string]any, value any, refs []string) (*apiextensionsv1.JSONSchemaProps, error) {
+	node, refs, err := c.resolve(node, refs)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		// cyclic or external $ref, the shape can only be inferred from the values
+		return c.infer(value)
+	}
+
+	schema := &apiextensionsv1.JSONSchemaProps{}
+	schema.Type, schema.Nullable, schema.XIntOrString = schemaType(node)
+
+	if description, ok := node["description"].(string); ok {
+		schema.Description = description
+	}
+	if pattern, ok := node["pattern"].(string); ok {
+		schema.Pattern = pattern
+	}
+	if enum, ok := node["enum"].([]any); ok {
+		for _, e := range enum {
+			if e == nil {
+				schema.Nullable = true
+				continue
+			}
+			raw, err := json.Marshal(e)
+			if err != nil {
+				return nil, err
+			}
+			schema.Enum = append(schema.Enum, apiextensionsv1.JSON{Raw: raw})
+		}
+	}
+	if constant, ok := node["const"]; ok && constant != nil {
+		raw, err := json.Marshal(constant)
+		if err != nil {
+			return nil, err
+		}
+		schema.Enum = []apiextensionsv1.JSON{{Raw: raw}}
+	}
+	setLimits(schema, node)
+
+	if schema.Type == "" && !schema.XIntOrString {
+		schema.Type = inferType(node, value)
+	}
+
+	switch schema.Type {
+	case "object":
+		if err := c.convertObject(schema, node, value, refs); err != nil {
+			return nil, err
+		}
+	case "array":
+		var items map[string]any
+		switch i := node["items"].(type) {
+		case map[string]any:
+			items = i
+		case []any:
+			if len(i) > 0 {
+				items, _ = i[0].(map[string]any)
+			}
+		}
+
+		var itemValue any
+		if values, ok := value.([]any); ok && len(values) > 0 {
+			itemValue = values[0]
+		}
+
+		var itemSchema *apiextensionsv1.JSONSchemaProps
+		if items != nil {
+			itemSchema, err = c.convert(items, itemValue, refs)
+		} else {
+			itemSchema, err = c.infer(itemValue)
+		}
+		if err != nil {
+			return nil, err
+		}
+		schema.Items = &apiextensionsv1.JSONSchemaPropsOrArray{Schema: itemSchema}
+	case "":
+		if !schema.XIntOrString {
+			schema.XPreserveUnknownFields = pointer.Bool(true)
+		}
+	}
+
+	return schema, nil
+}
+
+func (c *jsonSchemaConverter) convertObject(schema *apiextensionsv1.JSONSchemaProps, node map[string]any, value any, refs []string) error {
+	values, _ := value.(map[string]any)
+	properties, _ := node["properties"].(map[string]any)
+
+	if len(properties) > 0 || len(values) > 0 {
+		schema.Properties = map[string]apiextensionsv1.JSONSchemaProps{}
+	}
+	for name, property := range properties {
+		propertyNode, ok := property.(map[string]any)
+		if !ok {
+			continue
+		}
+		propertySchema, err := c.convert(propertyNode, values[name], refs)
+		if err != nil {
+			return err
+		}
+		schema.Properties[name] = *propertySchema
+	}
+
+	for name, v := range values {
+		if _, ok := schema.Properties[name]; ok {
+			continue
+		}
+		propertySchema, err := getJSONSchema(v)
+		if err != nil {
+			return err
+		}
+		schema.Properties[name] = *propertySchema
+	}
+
+	// Helm checks the required values against the chart values merged with
+	// the request, so the ones the chart values set are optional in requests
+	if required, ok := node["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok && values[name] == nil {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+	}
+
+	switch additional := node["additionalProperties"].(type) {
+	case bool:
+		if additional {
+			schema.XPreserveUnknownFields = pointer.Bool(true)
+		}
+	case map[string]any:
+		// structural schemas cannot set both properties and additionalProperties
+		if len(schema.Properties) > 0 {
+			schema.XPreserveUnknownFields = pointer.Bool(true)
+			break
+		}
+		additionalSchema, err := c.convert(additional, nil, refs)
+		if err != nil {
+			return err
+		}
+		schema.AdditionalProperties = &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: additionalSchema}
+	default:
+		schema.XPreserveUnknownFields = pointer.Bool(true)
+	}
+	return nil
+}
+
+// resolve follows the $ref and merges the allOf schemas of the node. It
+// returns a nil node when the $ref is cyclic or cannot be resolved locally.
+func (c *jsonSchemaConverter) resolve(node map[string]any, refs []string) (map[string]any, []string, error) {
+	resolved := map[string]any{}
+
+	if ref, ok := node["$ref"].(string); ok {
+		if slices.Contains(refs, ref) {
+			return nil, refs, nil
+		}
+		target, ok := c.lookup(ref)
+		if !ok {
+			return nil, refs, nil
+		}
+		refs = append(slices.Clone(refs), ref)
+
+		target, refs, err := c.resolve(target, refs)
+		if err != nil || target == nil {
+			return target, refs, err
+		}
+		for k, v := range target {
+			resolved[k] = v
+		}
+	}
+
+	if allOf, ok := node["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			subNode, ok := sub.(map[string]any)
+			if !ok {
+				continue
+			}
+			subNode, _, err := c.resolve(subNode, refs)
+			if err != nil {
+				return nil, refs, err
+			}
+			mergeJSONSchemaNodes(resolved, subNode)
+		}
+	}
+
+	own := map[string]any{}
+	for k, v := range node {
+		if k != "$ref" && k != "allOf" {
+			own[k] = v
+		}
+	}
+	mergeJSONSchemaNodes(resolved, own)
+	return resolved, refs, nil
+}
+
+// lookup returns the node the local JSON pointer ref points to
+func (c *jsonSchemaConverter) lookup(ref string) (map[string]any, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+
+	var current any = c.root
+	for _, token := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[token]; !ok {
+			return nil, false
+		}
+	}
+
+	node, ok := current.(map[string]any)
+	return node, ok
+}
+
+func (c *jsonSchemaConverter) infer(value any) (*apiextensionsv1.JSONSchemaProps, error) {
+	if value == nil {
+		return &apiextensionsv1.JSONSchemaProps{XPreserveUnknownFields: pointer.Bool(true)}, nil
+	}
+	return getJSONSchema(value)
+}
+
+func mergeJSONSchemaNodes(dst, src map[string]any) {
+	for k, v := range src {
+		switch k {
+		case "properties":
+			properties, _ := dst[k].(map[string]any)
+			merged := map[string]any{}
+			for name, p := range properties {
+				merged[name] = p
+			}
+			if srcProperties, ok := v.(map[string]any); ok {
+				for name, p := range srcProperties {
+					merged[name] = p
+				}
+			}
+			dst[k] = merged
+		case "required":
+			required, _ := dst[k].([]any)
+			if srcRequired, ok := v.([]any); ok {
+				dst[k] = append(slices.Clone(required), srcRequired...)
+			}
+		default:
+			dst[k] = v
+		}
+	}
+}
+
+// schemaType returns the structural type of the node. Nullable types are
+// supported, and a string or integer type becomes x-kubernetes-int-or-string.
+func schemaType(node map[string]any) (schemaType string, nullable bool, intOrString bool) {
+	var types []string
+	switch t := node["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+
+	if slices.Contains(types, "null") {
+		nullable = true
+		types = slices.DeleteFunc(types, func(t string) bool { return t == "null" })
+	}
+
+	switch {
+	case len(types) == 1:
+		return types[0], nullable, false
+	case len(types) == 2 && slices.Contains(types, "string") && (slices.Contains(types, "integer") || slices.Contains(types, "number")):
+		return "", nullable, true
+	case len(types) == 2 && slices.Contains(types, "integer") && slices.Contains(types, "number"):
+		return "number", nullable, false
+	}
+	return "", nullable, false
+}
+
+// inferType returns the type of a node without a single type, from its
+// keywords or from the value in the chart values
+func inferType(node map[string]any, value any) string {
+	switch {
+	case node["properties"] != nil || node["additionalProperties"] != nil:
+		return "object"
+	case node["items"] != nil:
+		return "array"
+	}
+
+	if value != nil {
+		if inferred, err := getJSONSchema(value); err == nil {
+			return inferred.Type
+		}
+	}
+	return ""
+}
+
+func setLimits(schema *apiextensionsv1.JSONSchemaProps, node map[string]any) {
+	number := func(key string) *float64 {
+		if v, ok := node[key].(float64); ok {
+			return &v
+		}
+		return nil
+	}
+	integer := func(key string) *int64 {
+		if v, ok := node[key].(float64); ok {
+			i := int64(v)
+			return &i
+		}
+		return nil
+	}
+
+	schema.Minimum = number("minimum")
+	schema.Maximum = number("maximum")
+	schema.MultipleOf = number("multipleOf")
+	schema.MinLength = integer("minLength")
+	schema.MaxLength = integer("maxLength")
+	schema.MinItems = integer("minItems")
+	schema.MaxItems = integer("maxItems")
+	schema.MinProperties = integer("minProperties")
+	schema.MaxProperties = integer("maxProperties")
+
+	// draft-04 uses booleans for exclusive limits, later drafts use numbers
+	switch v := node["exclusiveMinimum"].(type) {
+	case bool:
+		schema.ExclusiveMinimum = v
+	case float64:
+		schema.Minimum, schema.ExclusiveMinimum = &v, true
+	}
+	switch v := node["exclusiveMaximum"].(type) {
+	case bool:
+		schema.ExclusiveMaximum = v
+	case float64:
+		schema.Maximum, schema.ExclusiveMaximum = &v, true
+	}
+}
@@ -0,0 +1,161 @@
+package internal_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/syntasso/kratix-cli/internal"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+)
+
+var _ = Describe("HelmJSONSchemaToSchema()", func() {
+	It("keeps enums, required fields, descriptions, patterns and limits", func() {
+		jsonSchema := []byte(`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"type": "object",
+			"required": ["size"],
+			"properties": {
+				"size": {"type": "string", "enum": ["small", "large"], "description": "the size"},
+				"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 10},
+				"replicas": {"type": "integer", "minimum": 1, "exclusiveMaximum": 10},
+				"tags": {"type": "array", "items": {"type": "string"}}
+			}
+		}`)
+		schema, err := internal.HelmJSONSchemaToSchema(jsonSchema, map[string]any{"tags": []any{}})
+		Expect(err).NotTo(HaveOccurred())
+		expectStructural(schema)
+
+		Expect(schema.Type).To(Equal("object"))
+		Expect(schema.Required).To(ConsistOf("size"))
+		Expect(schema.Properties["size"].Description).To(Equal("the size"))
+		Expect(schema.Properties["size"].Enum).To(Equal([]apiextensionsv1.JSON{{Raw: []byte(`"small"`)}, {Raw: []byte(`"large"`)}}))
+		Expect(schema.Properties["name"].Pattern).To(Equal("^[a-z]+$"))
+		Expect(*schema.Properties["name"].MaxLength).To(Equal(int64(10)))
+		Expect(*schema.Properties["replicas"].Minimum).To(Equal(1.0))
+		Expect(*schema.Properties["replicas"].Maximum).To(Equal(10.0))
+		Expect(schema.Properties["replicas"].ExclusiveMaximum).To(BeTrue())
+		Expect(schema.Properties["tags"].Items.Schema.Type).To(Equal("string"))
+	})
+
+	It("resolves $refs to definitions and $defs, and merges allOf", func() {
+		jsonSchema := []byte(`{
+			"type": "object",
+			"properties": {
+				"image": {"$ref": "#/definitions/image", "description": "the main image"},
+				"sidecar": {"allOf": [{"$ref": "#/$defs/sidecar"}, {"required": ["image"]}]}
+			},
+			"definitions": {
+				"image": {"type": "object", "properties": {"repository": {"type": "string"}, "tag": {"type": "string"}}}
+			},
+			"$defs": {
+				"sidecar": {"type": "object", "properties": {"image": {"$ref": "#/definitions/image"}}}
+			}
+		}`)
+		schema, err := internal.HelmJSONSchemaToSchema(jsonSchema, nil)
+		Expect(err).NotTo(HaveOccurred())
+		expectStructural(schema)
+
+		Expect(schema.Properties["image"].Description).To(Equal("the main image"))
+		Expect(schema.Properties["image"].Properties).To(SatisfyAll(HaveKey("repository"), HaveKey("tag")))
+		Expect(schema.Properties["sidecar"].Required).To(ConsistOf("image"))
+		Expect(schema.Properties["sidecar"].Properties["image"].Properties["tag"].Type).To(Equal("string"))
+	})
+
+	It("stops at cyclic $refs", func() {
+		jsonSchema := []byte(`{
+			"type": "object",
+			"properties": {"node": {"$ref": "#/definitions/node"}},
+			"definitions": {"node": {"type": "object", "properties": {"child": {"$ref": "#/definitions/node"}}}}
+		}`)
+		schema, err := internal.HelmJSONSchemaToSchema(jsonSchema, nil)
+		Expect(err).NotTo(HaveOccurred())
+		expectStructural(schema)
+		Expect(*schema.Properties["node"].Properties["child"].XPreserveUnknownFields).To(BeTrue())
+	})
+
+	It("converts types that are not structural", func() {
+		jsonSchema := []byte(`{
+			"type": "object",
+			"properties": {
+				"port": {"type": ["string", "integer"]},
+				"optional": {"type": ["string", "null"]},
+				"anything": {"description": "no type"},
+				"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+				"closed": {"type": "object", "additionalProperties": false, "properties": {"a": {"type": "string"}}}
+			}
+		}`)
+		schema, err := internal.HelmJSONSchemaToSchema(jsonSchema, nil)
+		Expect(err).NotTo(HaveOccurred())
+		expectStructural(schema)
+
+		Expect(schema.Properties["port"].XIntOrString).To(BeTrue())
+		Expect(schema.Properties["optional"].Type).To(Equal("string"))
+		Expect(schema.Properties["optional"].Nullable).To(BeTrue())
+		Expect(*schema.Properties["anything"].XPreserveUnknownFields).To(BeTrue())
+		Expect(schema.Properties["labels"].AdditionalProperties.Schema.Type).To(Equal("string"))
+		Expect(schema.Properties["closed"].XPreserveUnknownFields).To(BeNil())
+	})
+
+	It("infers the schema of values the JSON schema does not document", func() {
+		jsonSchema := []byte(`{
+			"type": "object",
+			"properties": {
+				"service": {"type": "object", "properties": {"port": {"type": "integer"}}},
+				"untyped": {}
+			}
+		}`)
+		values := map[string]any{
+			"service":  map[string]any{"port": 80, "type": "ClusterIP"},
+			"untyped":  []any{"a"},
+			"replicas": 1,
+		}
+		schema, err := internal.HelmJSONSchemaToSchema(jsonSchema, values)
+		Expect(err).NotTo(HaveOccurred())
+		expectStructural(schema)
+
+		Expect(schema.Properties["replicas"].Type).To(Equal("integer"))
+		Expect(schema.Properties["service"].Properties["type"].Type).To(Equal("string"))
+		Expect(schema.Properties["untyped"].Type).To(Equal("array"))
+		Expect(schema.Properties["untyped"].Items.Schema.Type).To(Equal("string"))
+	})
+
+	It("only requires the values the chart values do not set", func() {
+		jsonSchema := []byte(`{
+			"type": "object",
+			"required": ["image", "service", "name"],
+			"properties": {
+				"name": {"type": "string"},
+				"image": {
+					"type": "object",
+					"required": ["repository", "tag", "digest"],
+					"properties": {"repository": {"type": "string"}, "tag": {"type": "string"}, "digest": {"type": "string"}}
+				},
+				"service": {"type": "object", "properties": {"port": {"type": "integer"}}}
+			}
+		}`)
+		values := map[string]any{
+			"image":   map[string]any{"repository": "nginx", "tag": "", "digest": nil},
+			"service": map[string]any{"port": 80},
+		}
+		schema, err := internal.HelmJSONSchemaToSchema(jsonSchema, values)
+		Expect(err).NotTo(HaveOccurred())
+		expectStructural(schema)
+
+		Expect(schema.Required).To(ConsistOf("name"))
+		Expect(schema.Properties["image"].Required).To(ConsistOf("digest"))
+	})
+
+	It("errors when the JSON schema is invalid", func() {
+		_, err := internal.HelmJSONSchemaToSchema([]byte(`{`), nil)
+		Expect(err).To(MatchError(ContainSubstring("failed to parse values.schema.json")))
+	})
+})
+
+func expectStructural(schema *apiextensionsv1.JSONSchemaProps) {
+	var internalSchema apiextensions.JSONSchemaProps
+	ExpectWithOffset(1, apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(schema, &internalSchema, nil)).To(Succeed())
+	structural, err := structuralschema.NewStructural(&internalSchema)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ExpectWithOffset(1, structuralschema.ValidateStructural(nil, structural)).To(BeEmpty())
+}
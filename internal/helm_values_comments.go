@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// bitnami readme-generator annotations, e.g. "## @param image.tag [string] Image tag"
+var paramAnnotation = regexp.MustCompile(`^@param\s+(\S+)\s*(?:\[[^\]]*\]\s*)?(.*)$`)
+
+// HelmValuesDescriptions returns the descriptions of the keys of a Helm
+// values.yaml file, indexed by their dotted path. Descriptions come from
+// bitnami-style @param annotations, helm-docs style "# --" comments, and
+// the plain comments above or next to each key, in that order of precedence.
+func HelmValuesDescriptions(valuesYAML []byte) (map[string]string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(valuesYAML, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+	}
+
+	descriptions := map[string]string{}
+	params := map[string]string{}
+	walkValuesComments(&document, "", true, descriptions, params)
+
+	for path, description := range params {
+		descriptions[path] = description
+	}
+	return descriptions, nil
+}
+
+// AddDescriptions sets the description of the properties of the schema that
+// have none from the descriptions indexed by their dotted path
+func AddDescriptions(schema *apiextensionsv1.JSONSchemaProps, descriptions map[string]string) {
+	addDescriptions(schema, "", descriptions)
+}
+
+func addDescriptions(schema *apiextensionsv1.JSONSchemaProps, prefix string, descriptions map[string]string) {
+	for name, property := range schema.Properties {
+		path := joinValuesPath(prefix, name)
+		if property.Description == "" {
+			property.Description = descriptions[path]
+		}
+		addDescriptions(&property, path, descriptions)
+		schema.Properties[name] = property
+	}
+}
+
+func walkValuesComments(node *yaml.Node, prefix string, describe bool, descriptions, params map[string]string) {
+	for _, comment := range []string{node.HeadComment, node.LineComment, node.FootComment} {
+		collectParams(comment, params)
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkValuesComments(child, prefix, describe, descriptions, params)
+		}
+	case yaml.SequenceNode:
+		// the keys of sequence items have no path in the schema, only their
+		// annotations are collected
+		for _, child := range node.Content {
+			walkValuesComments(child, prefix, false, descriptions, params)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			path := joinValuesPath(prefix, key.Value)
+
+			for _, comment := range []string{key.HeadComment, key.LineComment, key.FootComment} {
+				collectParams(comment, params)
+			}
+
+			if describe {
+				description := commentDescription(key.HeadComment)
+				if description == "" {
+					description = commentDescription(key.LineComment)
+				}
+				if description == "" {
+					description = commentDescription(value.LineComment)
+				}
+				if description != "" {
+					descriptions[path] = description
+				}
+			}
+
+			walkValuesComments(value, path, describe, descriptions, params)
+		}
+	}
+}
+
+func collectParams(comment string, params map[string]string) {
+	for _, line := range commentLines(comment) {
+		if match := paramAnnotation.FindStringSubmatch(line); match != nil && match[2] != "" {
+			params[match[1]] = match[2]
+		}
+	}
+}
+
+// commentDescription returns the description in the last paragraph of the
+// comment, ignoring annotations and section banners
+func commentDescription(comment string) string {
+	paragraphs := strings.Split(strings.TrimSpace(comment), "\n\n")
+	lines := commentLines(paragraphs[len(paragraphs)-1])
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, "-- ") {
+			lines = lines[i:]
+			lines[0] = strings.TrimPrefix(line, "-- ")
+			break
+		}
+	}
+
+	var description []string
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "@") {
+			continue
+		}
+		description = append(description, line)
+	}
+	return strings.Join(description, " ")
+}
+
+func commentLines(comment string) []string {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		lines = append(lines, strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#")))
+	}
+	return lines
+}
+
+func joinValuesPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,73 @@
+package internal_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/syntasso/kratix-cli/internal"
+)
+
+var _ = Describe("HelmValuesDescriptions()", func() {
+	It("extracts descriptions from @param annotations, helm-docs and plain comments", func() {
+		values := []byte(`## @section Global parameters
+## @param global.imageRegistry Global Docker image registry
+##
+global:
+  imageRegistry: ""
+
+## @param image.registry [default: REGISTRY_NAME] Image registry
+## @param image.tag Image tag
+image:
+  registry: docker.io
+  # overridden by the @param annotation
+  tag: "16"
+  # Plain comment for the pull policy
+  # over two lines
+  pullPolicy: IfNotPresent
+
+# -- Number of replicas
+replicaCount: 1
+
+service:
+  port: 80 # the service port
+
+extraEnv:
+  # not a key of the schema
+  - name: FOO
+`)
+		descriptions, err := internal.HelmValuesDescriptions(values)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(descriptions).To(Equal(map[string]string{
+			"global.imageRegistry": "Global Docker image registry",
+			"image.registry":       "Image registry",
+			"image.tag":            "Image tag",
+			"image.pullPolicy":     "Plain comment for the pull policy over two lines",
+			"replicaCount":         "Number of replicas",
+			"service.port":         "the service port",
+		}))
+	})
+
+	It("errors when the values are not valid YAML", func() {
+		_, err := internal.HelmValuesDescriptions([]byte("key: ["))
+		Expect(err).To(MatchError(ContainSubstring("failed to parse values.yaml")))
+	})
+})
+
+var _ = Describe("AddDescriptions()", func() {
+	It("sets the descriptions of nested properties without overriding existing ones", func() {
+		schema, err := internal.HelmValuesToSchema(map[string]any{
+			"replicaCount": 1,
+			"image":        map[string]any{"tag": "16"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		replicas := schema.Properties["replicaCount"]
+		replicas.Description = "from values.schema.json"
+		schema.Properties["replicaCount"] = replicas
+
+		internal.AddDescriptions(schema, map[string]string{
+			"replicaCount": "Number of replicas",
+			"image.tag":    "Image tag",
+		})
+		Expect(schema.Properties["replicaCount"].Description).To(Equal("from values.schema.json"))
+		Expect(schema.Properties["image"].Properties["tag"].Description).To(Equal("Image tag"))
+	})
+})
@@ -1,58 +1,199 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
-	"strings"
-
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/syntasso/kratix-cli/aspects/terraform-module-promise/lib"
 )
 
 var (
-	getModule func(dst, src string, opts ...getter.ClientOption) error = getter.Get
-	mkdirTemp func(dir, pattern string) (string, error)                = os.MkdirTemp
+	getModule      func(dst, src string, opts ...getter.ClientOption) error = getter.Get
+	mkdirTemp      func(dir, pattern string) (string, error)                = os.MkdirTemp
+	registryClient                                                          = http.DefaultClient
 )
 
-func GetVariablesFromModule(moduleSource string) ([]TerraformVariable, error) {
-	tempDir, err := mkdirTemp("", "terraform-module")
+// ResolveModuleSource returns the go-getter source to download the module
+// from. Registry addresses are resolved through the module registry protocol,
+// local paths are made absolute, and git sources with a version are checked out
+// at that ref. Other sources cannot be versioned.
+func ResolveModuleSource(moduleSource, moduleVersion string) (string, error) {
+	if module, ok := lib.ParseRegistryModule(moduleSource); ok {
+		return resolveRegistryModule(module, moduleVersion)
+	}
+
+	if isLocalModuleSource(moduleSource) {
+		if moduleVersion != "" {
+			return "", fmt.Errorf("a module version cannot be set for the local module %s", moduleSource)
+		}
+		return filepath.Abs(moduleSource)
+	}
+
+	return lib.VersionedModuleSource(moduleSource, moduleVersion)
+}
+
+func isLocalModuleSource(moduleSource string) bool {
+	return filepath.IsAbs(moduleSource) || moduleSource == "." || moduleSource == ".." ||
+		strings.HasPrefix(moduleSource, "./") || strings.HasPrefix(moduleSource, "../")
+}
+
+// resolveRegistryModule returns the download location of the module version,
+// or of its latest version when no version is set
+func resolveRegistryModule(module lib.RegistryModule, moduleVersion string) (string, error) {
+	modulesURL, err := discoverModulesService(module.Host)
+	if err != nil {
+		return "", err
+	}
+
+	modulePath := path.Join(module.Namespace, module.Name, module.Provider, moduleVersion, "download")
+	downloadURL, err := modulesURL.Parse(modulePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+		return "", fmt.Errorf("invalid registry module %s: %w", modulePath, err)
 	}
-	defer os.RemoveAll(tempDir)
 
-	err = getModule(tempDir, moduleSource)
+	resp, err := registryClient.Get(downloadURL.String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to download module: %w", err)
+		return "", fmt.Errorf("failed to query module registry %s: %w", module.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("module %s/%s/%s version %q not found in registry %s", module.Namespace, module.Name, module.Provider, moduleVersion, module.Host)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return "", fmt.Errorf("unexpected status %s from module registry %s", resp.Status, module.Host)
+	}
+
+	location := resp.Header.Get("X-Terraform-Get")
+	if location == "" {
+		return "", fmt.Errorf("module registry %s did not return a download location for %s", module.Host, downloadURL.Path)
+	}
+	if strings.HasPrefix(location, "/") || strings.HasPrefix(location, "./") || strings.HasPrefix(location, "../") {
+		locationURL, err := resp.Request.URL.Parse(location)
+		if err != nil {
+			return "", fmt.Errorf("invalid download location %s: %w", location, err)
+		}
+		location = locationURL.String()
 	}
 
-	absPath := filepath.Join(tempDir, "variables.tf")
+	if module.Subdir == "" {
+		return location, nil
+	}
+	location, subdir := getter.SourceDirSubdir(location)
+	subdir = path.Join(subdir, module.Subdir)
+	if idx := strings.Index(location, "?"); idx > -1 {
+		return location[:idx] + "//" + subdir + location[idx:], nil
+	}
+	return location + "//" + subdir, nil
+}
 
-	variables, err := extractVariablesFromVarsFile(absPath)
+// discoverModulesService returns the base URL of the modules.v1 service of the
+// registry host, as advertised in its service discovery document
+func discoverModulesService(host string) (*url.URL, error) {
+	discoveryURL := &url.URL{Scheme: "https", Host: host, Path: "/.well-known/terraform.json"}
+	resp, err := registryClient.Get(discoveryURL.String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse variables: %w", err)
+		return nil, fmt.Errorf("failed to discover module registry %s: %w", host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover module registry %s: unexpected status %s", host, resp.Status)
+	}
+
+	var services map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&services); err != nil {
+		return nil, fmt.Errorf("failed to parse service discovery document of %s: %w", host, err)
+	}
+	modulesPath, ok := services["modules.v1"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a module registry", host)
+	}
+	if !strings.HasSuffix(modulesPath, "/") {
+		modulesPath += "/"
 	}
+	return discoveryURL.Parse(modulesPath)
+}
+
+// TerraformOutput represents a Terraform module output
+type TerraformOutput struct {
+	Name        string
+	Description string
+	Sensitive   bool
+}
 
-	return variables, nil
+func GetVariablesFromModule(moduleSource string) ([]TerraformVariable, error) {
+	variables, _, err := GetVariablesAndOutputsFromModule(moduleSource)
+	return variables, err
 }
 
-func extractVariablesFromVarsFile(filePath string) ([]TerraformVariable, error) {
+// GetVariablesAndOutputsFromModule returns the variables and the outputs
+// declared in the .tf files at the root of the module
+func GetVariablesAndOutputsFromModule(moduleSource string) ([]TerraformVariable, []TerraformOutput, error) {
+	moduleDir := moduleSource
+	if info, err := os.Stat(moduleSource); err != nil || !info.IsDir() {
+		tempDir, err := mkdirTemp("", "terraform-module")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		err = getModule(tempDir, moduleSource)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to download module: %w", err)
+		}
+		moduleDir = tempDir
+	}
+
+	tfFiles, err := filepath.Glob(filepath.Join(moduleDir, "*.tf"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list terraform files: %w", err)
+	}
+	if len(tfFiles) == 0 {
+		return nil, nil, fmt.Errorf("failed to parse variables: no .tf files found in module")
+	}
+	sort.Strings(tfFiles)
+
+	var variables []TerraformVariable
+	var outputs []TerraformOutput
+	for _, tfFile := range tfFiles {
+		fileVariables, fileOutputs, err := extractFromModuleFile(tfFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse variables in %s: %w", filepath.Base(tfFile), err)
+		}
+		variables = append(variables, fileVariables...)
+		outputs = append(outputs, fileOutputs...)
+	}
+
+	return variables, outputs, nil
+}
+
+func extractFromModuleFile(filePath string) ([]TerraformVariable, []TerraformOutput, error) {
 	fileContent, err := readFileContent(filePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	blocks, err := parseHCLVariables(filePath)
+	blocks, err := parseHCLBlocks(filePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return extractVariables(blocks, fileContent), nil
+	return extractVariables(blocks, fileContent), extractOutputs(blocks, fileContent), nil
 }
 
 func readFileContent(filePath string) (string, error) {
@@ -63,16 +204,17 @@ func readFileContent(filePath string) (string, error) {
 	return string(fileBytes), nil
 }
 
-func parseHCLVariables(filePath string) ([]*hcl.Block, error) {
+func parseHCLBlocks(filePath string) ([]*hcl.Block, error) {
 	parser := hclparse.NewParser()
 	file, diags := parser.ParseHCLFile(filePath)
 	if diags.HasErrors() {
 		return nil, fmt.Errorf("failed to parse HCL file: %s", diags.Error())
 	}
 
-	content, diags := file.Body.Content(&hcl.BodySchema{
+	content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
 		Blocks: []hcl.BlockHeaderSchema{
 			{Type: "variable", LabelNames: []string{"name"}},
+			{Type: "output", LabelNames: []string{"name"}},
 		},
 	})
 	if diags.HasErrors() {
@@ -90,22 +232,136 @@ func extractVariables(blocks []*hcl.Block, fileContent string) []TerraformVariab
 			continue
 		}
 		variable := TerraformVariable{Name: block.Labels[0]}
-		varContent, _ := block.Body.Content(&hcl.BodySchema{
+		varContent, _, _ := block.Body.PartialContent(&hcl.BodySchema{
 			Attributes: []hcl.AttributeSchema{
 				{Name: "type", Required: false},
 				{Name: "default", Required: false},
 				{Name: "description", Required: false},
+				{Name: "nullable", Required: false},
+				{Name: "sensitive", Required: false},
+			},
+			Blocks: []hcl.BlockHeaderSchema{
+				{Type: "validation"},
 			},
 		})
 
 		variable.Type = extractType(varContent, fileContent)
 		variable.Description = extractDescription(varContent, fileContent)
+		variable.Default, variable.HasDefault = extractDefault(varContent)
+		variable.Sensitive = extractBool(varContent, "sensitive")
+		if nullableAttr, ok := varContent.Attributes["nullable"]; ok {
+			if nullableVal, diags := nullableAttr.Expr.Value(nil); !diags.HasErrors() && nullableVal.Type() == cty.Bool && nullableVal.IsKnown() && !nullableVal.IsNull() {
+				nullable := nullableVal.True()
+				variable.Nullable = &nullable
+			}
+		}
+		for _, validation := range varContent.Blocks {
+			extractValidation(&variable, validation)
+		}
 		variables = append(variables, variable)
 	}
 
 	return variables
 }
 
+func extractOutputs(blocks []*hcl.Block, fileContent string) []TerraformOutput {
+	var outputs []TerraformOutput
+
+	for _, block := range blocks {
+		if block.Type != "output" || len(block.Labels) == 0 {
+			continue
+		}
+
+		outputContent, _, _ := block.Body.PartialContent(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{
+				{Name: "description", Required: false},
+				{Name: "sensitive", Required: false},
+			},
+		})
+		outputs = append(outputs, TerraformOutput{
+			Name:        block.Labels[0],
+			Description: extractDescription(outputContent, fileContent),
+			Sensitive:   extractBool(outputContent, "sensitive"),
+		})
+	}
+
+	return outputs
+}
+
+func extractDefault(varContent *hcl.BodyContent) (any, bool) {
+	defaultAttr, ok := varContent.Attributes["default"]
+	if !ok {
+		return nil, false
+	}
+	return ctyToGo(defaultAttr.Expr), true
+}
+
+func extractBool(varContent *hcl.BodyContent, name string) bool {
+	attr, ok := varContent.Attributes[name]
+	if !ok {
+		return false
+	}
+	val, diags := attr.Expr.Value(nil)
+	return !diags.HasErrors() && val.Type() == cty.Bool && val.IsKnown() && !val.IsNull() && val.True()
+}
+
+// ctyToGo evaluates a constant expression into its JSON-compatible Go value,
+// returning nil for null values and expressions that cannot be evaluated
+func ctyToGo(expr hcl.Expression) any {
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || val.IsNull() || !val.IsWhollyKnown() {
+		return nil
+	}
+
+	jsonBytes, err := ctyjson.SimpleJSONValue{Value: val}.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(jsonBytes, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+// extractValidation turns simple validation conditions into constraints:
+// contains([...], var.x) becomes an enum and can(regex("...", var.x)) a pattern
+func extractValidation(variable *TerraformVariable, validation *hcl.Block) {
+	attrs, _ := validation.Body.JustAttributes()
+	conditionAttr, ok := attrs["condition"]
+	if !ok {
+		return
+	}
+	condition, ok := conditionAttr.Expr.(*hclsyntax.FunctionCallExpr)
+	if !ok {
+		return
+	}
+
+	switch {
+	case condition.Name == "contains" && len(condition.Args) == 2 && isVariableReference(condition.Args[1], variable.Name):
+		if values, ok := ctyToGo(condition.Args[0]).([]any); ok {
+			variable.Enum = values
+		}
+	case condition.Name == "can" && len(condition.Args) == 1:
+		regex, ok := condition.Args[0].(*hclsyntax.FunctionCallExpr)
+		if !ok || regex.Name != "regex" || len(regex.Args) != 2 || !isVariableReference(regex.Args[1], variable.Name) {
+			return
+		}
+		if pattern, ok := ctyToGo(regex.Args[0]).(string); ok {
+			variable.Pattern = pattern
+		}
+	}
+}
+
+func isVariableReference(expr hclsyntax.Expression, name string) bool {
+	traversal, ok := expr.(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(traversal.Traversal) != 2 || traversal.Traversal.RootName() != "var" {
+		return false
+	}
+	attr, ok := traversal.Traversal[1].(hcl.TraverseAttr)
+	return ok && attr.Name == name
+}
+
 func extractType(varContent *hcl.BodyContent, fileContent string) string {
 	if typeAttr, ok := varContent.Attributes["type"]; ok {
 		rng := typeAttr.Expr.Range()
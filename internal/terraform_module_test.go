@@ -2,8 +2,11 @@ package internal_test
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -11,6 +14,7 @@ import (
 	"github.com/syntasso/kratix-cli/internal"
 
 	"github.com/hashicorp/go-getter"
+	"k8s.io/utils/ptr"
 )
 
 var _ = Describe("DownloadAndConvertTerraformToCRD", func() {
@@ -85,6 +89,107 @@ var dst, src, tempDir, variablesPath string
 		})
 	})
 
+	Context("when the module declares variables across several files", func() {
+		BeforeEach(func() {
+			internal.SetGetModuleFunc(func(givenDst, givenSrc string, opts ...getter.ClientOption) error {
+				if err := os.WriteFile(filepath.Join(tempDir, "main.tf"), []byte(`
+					variable "region" {
+					  type      = string
+					  default   = "eu-west-2"
+					  sensitive = false
+					}
+
+					resource "null_resource" "example" {}
+				`), 0644); err != nil {
+					return err
+				}
+				if err := os.WriteFile(filepath.Join(tempDir, "README.md"), []byte(`variable "ignored" {}`), 0644); err != nil {
+					return err
+				}
+				return os.WriteFile(variablesPath, []byte(`
+					variable "size" {
+					  type     = string
+					  default  = null
+					  nullable = true
+
+					  validation {
+					    condition     = contains(["small", "medium", "large"], var.size)
+					    error_message = "size must be small, medium or large"
+					  }
+					}
+
+					variable "password" {
+					  type      = string
+					  sensitive = true
+
+					  validation {
+					    condition     = can(regex("^[a-zA-Z0-9]+$", var.password))
+					    error_message = "password must be alphanumeric"
+					  }
+					}
+
+					variable "tags" {
+					  type    = map(string)
+					  default = { team = "platform" }
+					}
+				`), 0644)
+			})
+		})
+
+		It("returns the variables of every .tf file with their defaults and validations", func() {
+			variables, err := internal.GetVariablesFromModule("mock-source")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variables).To(HaveLen(4))
+
+			Expect(variables[0].Name).To(Equal("region"))
+			Expect(variables[0].HasDefault).To(BeTrue())
+			Expect(variables[0].Default).To(Equal("eu-west-2"))
+			Expect(variables[0].Sensitive).To(BeFalse())
+
+			Expect(variables[1].Name).To(Equal("size"))
+			Expect(variables[1].HasDefault).To(BeTrue())
+			Expect(variables[1].Default).To(BeNil())
+			Expect(variables[1].Nullable).To(Equal(ptr.To(true)))
+			Expect(variables[1].Enum).To(Equal([]any{"small", "medium", "large"}))
+
+			Expect(variables[2].Name).To(Equal("password"))
+			Expect(variables[2].HasDefault).To(BeFalse())
+			Expect(variables[2].Sensitive).To(BeTrue())
+			Expect(variables[2].Pattern).To(Equal("^[a-zA-Z0-9]+$"))
+
+			Expect(variables[3].Name).To(Equal("tags"))
+			Expect(variables[3].Default).To(Equal(map[string]any{"team": "platform"}))
+		})
+	})
+
+	Context("when the module declares outputs", func() {
+		BeforeEach(func() {
+			internal.SetGetModuleFunc(func(givenDst, givenSrc string, opts ...getter.ClientOption) error {
+				return os.WriteFile(filepath.Join(tempDir, "outputs.tf"), []byte(`
+					output "id" {
+					  description = "The id of the resource"
+					  value       = null_resource.example.id
+					}
+
+					output "password" {
+					  value     = random_password.example.result
+					  sensitive = true
+					}
+				`), 0644)
+			})
+		})
+
+		It("returns the outputs with their descriptions and sensitivity", func() {
+			variables, outputs, err := internal.GetVariablesAndOutputsFromModule("mock-source")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variables).To(BeEmpty())
+			Expect(outputs).To(Equal([]internal.TerraformOutput{
+				{Name: "id", Description: "The id of the resource"},
+				{Name: "password", Sensitive: true},
+			}))
+		})
+	})
+
 	Context("when the module download fails", func() {
 		It("errors", func() {
 			internal.SetGetModuleFunc(func(dst, src string, opts ...getter.ClientOption) error {
@@ -109,3 +214,119 @@ var dst, src, tempDir, variablesPath string
 		})
 	})
 })
+
+var _ = Describe("ResolveModuleSource", func() {
+	var (
+		server   *httptest.Server
+		requests []string
+	)
+
+	BeforeEach(func() {
+		requests = []string{}
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			switch r.URL.Path {
+			case "/.well-known/terraform.json":
+				w.Write([]byte(`{"modules.v1": "/api/modules/v1/"}`))
+			case "/api/modules/v1/syntasso/vpc/aws/1.2.0/download":
+				w.Header().Set("X-Terraform-Get", "git::https://example.com/vpc.git?ref=v1.2.0")
+				w.WriteHeader(http.StatusNoContent)
+			case "/api/modules/v1/syntasso/vpc/aws/download":
+				w.Header().Set("X-Terraform-Get", "/archives/vpc-latest.tar.gz")
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		internal.SetRegistryClient(server.Client())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		internal.SetRegistryClient(http.DefaultClient)
+	})
+
+	It("resolves registry modules through the registry protocol", func() {
+		host := strings.TrimPrefix(server.URL, "https://")
+
+		source, err := internal.ResolveModuleSource(host+"/syntasso/vpc/aws", "1.2.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal("git::https://example.com/vpc.git?ref=v1.2.0"))
+		Expect(requests).To(Equal([]string{"/.well-known/terraform.json", "/api/modules/v1/syntasso/vpc/aws/1.2.0/download"}))
+	})
+
+	It("resolves the latest version and relative download locations", func() {
+		host := strings.TrimPrefix(server.URL, "https://")
+
+		source, err := internal.ResolveModuleSource(host+"/syntasso/vpc/aws", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(server.URL + "/archives/vpc-latest.tar.gz"))
+	})
+
+	It("keeps the subdirectory of registry modules", func() {
+		host := strings.TrimPrefix(server.URL, "https://")
+
+		source, err := internal.ResolveModuleSource(host+"/syntasso/vpc/aws//modules/subnets", "1.2.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal("git::https://example.com/vpc.git//modules/subnets?ref=v1.2.0"))
+	})
+
+	It("errors when the registry does not have the module version", func() {
+		host := strings.TrimPrefix(server.URL, "https://")
+
+		_, err := internal.ResolveModuleSource(host+"/syntasso/vpc/aws", "9.9.9")
+		Expect(err).To(MatchError(ContainSubstring(`module syntasso/vpc/aws version "9.9.9" not found in registry`)))
+	})
+
+	It("checks out git sources at the module version", func() {
+		source, err := internal.ResolveModuleSource("https://github.com/syntasso/modules.git//vpc", "v1.0.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal("git::https://github.com/syntasso/modules.git//vpc?ref=v1.0.0"))
+
+		source, err = internal.ResolveModuleSource("github.com/syntasso/modules", "v1.0.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal("git::github.com/syntasso/modules?ref=v1.0.0"))
+	})
+
+	DescribeTable("git sources with a version",
+		func(moduleSource, expectedSource string) {
+			source, err := internal.ResolveModuleSource(moduleSource, "v1.0.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(source).To(Equal(expectedSource))
+		},
+		Entry("forced git source", "git::https://example.com/vpc", "git::https://example.com/vpc?ref=v1.0.0"),
+		Entry("git URL with a query", "https://example.com/vpc.git?depth=1", "git::https://example.com/vpc.git?depth=1&ref=v1.0.0"),
+		Entry("git SSH address", "git@github.com:syntasso/modules.git", "git::git@github.com:syntasso/modules.git?ref=v1.0.0"),
+		Entry("bitbucket shorthand", "bitbucket.org/syntasso/modules", "git::bitbucket.org/syntasso/modules?ref=v1.0.0"),
+		Entry("github URL", "https://github.com/syntasso/modules", "git::https://github.com/syntasso/modules?ref=v1.0.0"),
+	)
+
+	DescribeTable("other sources with a version",
+		func(moduleSource string) {
+			_, err := internal.ResolveModuleSource(moduleSource, "v1.0.0")
+			Expect(err).To(MatchError("a module version can only be set for registry and git modules, not " + moduleSource))
+		},
+		Entry("HTTP archive", "https://example.com/vpc.zip"),
+		Entry("forced HTTP archive", "http::https://example.com/vpc.tar.gz"),
+		Entry("S3 archive", "s3::https://s3.amazonaws.com/bucket/vpc.zip"),
+		Entry("S3 bucket URL", "bucket.s3.amazonaws.com/vpc.zip"),
+		Entry("GCS archive", "gcs::https://www.googleapis.com/storage/v1/bucket/vpc.zip"),
+	)
+
+	It("uses sources without a version as they are", func() {
+		source, err := internal.ResolveModuleSource("s3::https://s3.amazonaws.com/bucket/vpc.zip", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal("s3::https://s3.amazonaws.com/bucket/vpc.zip"))
+	})
+
+	It("makes local paths absolute", func() {
+		source, err := internal.ResolveModuleSource("./modules/vpc", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.IsAbs(source)).To(BeTrue())
+		Expect(source).To(HaveSuffix(filepath.Join("modules", "vpc")))
+
+		_, err = internal.ResolveModuleSource("./modules/vpc", "v1.0.0")
+		Expect(err).To(MatchError("a module version cannot be set for the local module ./modules/vpc"))
+	})
+})
+
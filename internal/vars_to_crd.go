@@ -1,9 +1,13 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 )
 
@@ -13,6 +17,11 @@ type TerraformVariable struct {
 	Type        string
 	Description string
 	Default     any
+	HasDefault  bool
+	Nullable    *bool
+	Sensitive   bool
+	Enum        []any
+	Pattern     string
 }
 
 // VariablesToCRDSpecSchema converts a list of Terraform variables to a CRD JSON schema and returns warnings for unsupported types
@@ -43,13 +52,41 @@ func VariablesToCRDSpecSchema(variables []TerraformVariable) (*v1.JSONSchemaProp
 		if v.Description != "" {
 			prop.Description = v.Description
 		}
+		if v.Sensitive {
+			prop.Description = strings.TrimSpace(prop.Description + " (sensitive)")
+		}
+		if v.Nullable != nil && *v.Nullable {
+			prop.Nullable = true
+		}
+		if v.Default != nil {
+			if defaultJSON, err := json.Marshal(v.Default); err == nil {
+				prop.Default = &v1.JSON{Raw: defaultJSON}
+			}
+		}
+		if isScalarSchema(prop) {
+			for _, e := range v.Enum {
+				if enumJSON, err := json.Marshal(e); err == nil {
+					prop.Enum = append(prop.Enum, v1.JSON{Raw: enumJSON})
+				}
+			}
+			if prop.Type == "string" {
+				prop.Pattern = v.Pattern
+			}
+		}
 
 		varSchema.Properties[v.Name] = prop
+		if !v.HasDefault && v.Default == nil {
+			varSchema.Required = append(varSchema.Required, v.Name)
+		}
 	}
 
 	return varSchema, warnings
 }
 
+func isScalarSchema(prop v1.JSONSchemaProps) bool {
+	return prop.Type == "string" || prop.Type == "number" || prop.Type == "boolean"
+}
+
 func inferTypeFromDefault(value any) string {
 	switch v := value.(type) {
 	case string:
@@ -72,62 +109,174 @@ func inferTypeFromDefault(value any) string {
 }
 
 func convertTerraformTypeToCRD(terraformType string) (v1.JSONSchemaProps, string) {
-	terraformType = strings.TrimSpace(terraformType)
-
-	switch {
-	case terraformType == "string":
-		return v1.JSONSchemaProps{Type: "string"}, ""
-	case terraformType == "number":
-		return v1.JSONSchemaProps{Type: "number"}, ""
-	case terraformType == "bool" || terraformType == "boolean":
-		return v1.JSONSchemaProps{Type: "boolean"}, ""
-
-	case strings.HasPrefix(terraformType, "list("):
-		innerType := extractInnerType(terraformType, "list")
-		prop, warn := convertTerraformTypeToCRD(innerType)
-		if warn != "" {
-			return v1.JSONSchemaProps{}, "unsupported list type"
-		}
-		return v1.JSONSchemaProps{
-			Type: "array",
-			Items: &v1.JSONSchemaPropsOrArray{
-				Schema: &prop,
-			},
-		}, ""
-
-	case strings.HasPrefix(terraformType, "map("):
-		innerType := extractInnerType(terraformType, "map")
-		prop, warn := convertTerraformTypeToCRD(innerType)
-		if warn != "" {
+	expr, diags := hclsyntax.ParseExpression([]byte(strings.TrimSpace(terraformType)), "type.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return v1.JSONSchemaProps{}, "unsupported type"
+	}
+	return convertTypeExprToCRD(expr)
+}
+
+// convertTypeExprToCRD converts a Terraform type constraint expression, such as
+// list(object({ name = string, port = optional(number, 80) })), into a schema
+func convertTypeExprToCRD(expr hclsyntax.Expression) (v1.JSONSchemaProps, string) {
+	switch e := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		if len(e.Traversal) != 1 {
+			return v1.JSONSchemaProps{}, "unsupported type"
+		}
+		switch e.Traversal.RootName() {
+		case "string":
+			return v1.JSONSchemaProps{Type: "string"}, ""
+		case "number":
+			return v1.JSONSchemaProps{Type: "number"}, ""
+		case "bool", "boolean":
+			return v1.JSONSchemaProps{Type: "boolean"}, ""
+		case "any":
+			return v1.JSONSchemaProps{XPreserveUnknownFields: boolPtr(true)}, ""
+		}
+
+	case *hclsyntax.FunctionCallExpr:
+		switch {
+		case e.Name == "list" && len(e.Args) == 1:
+			prop, warn := convertTypeExprToCRD(e.Args[0])
+			if warn != "" {
+				return v1.JSONSchemaProps{}, "unsupported list type"
+			}
 			return v1.JSONSchemaProps{
-				Type:                   "object",
-				XPreserveUnknownFields: boolPtr(true),
+				Type: "array",
+				Items: &v1.JSONSchemaPropsOrArray{
+					Schema: &prop,
+				},
 			}, ""
+
+		case e.Name == "set" && len(e.Args) == 1:
+			prop, warn := convertTypeExprToCRD(e.Args[0])
+			if warn != "" {
+				return v1.JSONSchemaProps{}, "unsupported set type"
+			}
+			// sets of objects or lists must be atomic to be compared as a whole
+			switch prop.Type {
+			case "object":
+				prop.XMapType = stringPtr("atomic")
+			case "array":
+				prop.XListType = stringPtr("atomic")
+			}
+			return v1.JSONSchemaProps{
+				Type:      "array",
+				XListType: stringPtr("set"),
+				Items: &v1.JSONSchemaPropsOrArray{
+					Schema: &prop,
+				},
+			}, ""
+
+		case e.Name == "map" && len(e.Args) == 1:
+			prop, warn := convertTypeExprToCRD(e.Args[0])
+			if warn != "" || prop.Type == "" {
+				return v1.JSONSchemaProps{
+					Type:                   "object",
+					XPreserveUnknownFields: boolPtr(true),
+				}, ""
+			}
+			return v1.JSONSchemaProps{
+				Type: "object",
+				AdditionalProperties: &v1.JSONSchemaPropsOrBool{
+					Schema: &prop,
+				},
+			}, ""
+
+		case e.Name == "object" && len(e.Args) == 1:
+			return convertObjectTypeToCRD(e.Args[0])
+
+		case e.Name == "tuple" && len(e.Args) == 1:
+			return convertTupleTypeToCRD(e.Args[0])
 		}
-		return v1.JSONSchemaProps{
-			Type: "object",
-			AdditionalProperties: &v1.JSONSchemaPropsOrBool{
-				Schema: &prop,
-			},
-		}, ""
+	}
 
-	case strings.HasPrefix(terraformType, "object("):
-		return v1.JSONSchemaProps{
-			Type:                   "object",
-			XPreserveUnknownFields: boolPtr(true),
-		}, ""
+	return v1.JSONSchemaProps{}, "unsupported type"
+}
 
-	default:
-		return v1.JSONSchemaProps{}, "unsupported type"
+func convertObjectTypeToCRD(expr hclsyntax.Expression) (v1.JSONSchemaProps, string) {
+	attributes, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return v1.JSONSchemaProps{}, "unsupported object type"
+	}
+
+	prop := v1.JSONSchemaProps{
+		Type:       "object",
+		Properties: map[string]v1.JSONSchemaProps{},
 	}
+	for _, item := range attributes.Items {
+		name := hcl.ExprAsKeyword(item.KeyExpr)
+		if name == "" {
+			return v1.JSONSchemaProps{}, "unsupported object type"
+		}
+
+		attrType := item.ValueExpr
+		optional, isOptional := attrType.(*hclsyntax.FunctionCallExpr)
+		isOptional = isOptional && optional.Name == "optional" && (len(optional.Args) == 1 || len(optional.Args) == 2)
+		if isOptional {
+			attrType = optional.Args[0]
+		}
+
+		attrProp, warn := convertTypeExprToCRD(attrType)
+		if warn != "" {
+			return v1.JSONSchemaProps{}, "unsupported object type"
+		}
+
+		if !isOptional {
+			prop.Required = append(prop.Required, name)
+		} else if len(optional.Args) == 2 {
+			if defaultValue := ctyToGo(optional.Args[1]); defaultValue != nil {
+				if defaultJSON, err := json.Marshal(defaultValue); err == nil {
+					attrProp.Default = &v1.JSON{Raw: defaultJSON}
+				}
+			}
+		}
+		prop.Properties[name] = attrProp
+	}
+
+	return prop, ""
 }
 
-func extractInnerType(terraformType, containerType string) string {
-	inner := strings.TrimPrefix(terraformType, containerType+"(")
-	inner = strings.TrimSuffix(inner, ")")
-	return strings.TrimSpace(inner)
+// convertTupleTypeToCRD converts a tuple into a fixed-length array. Structural
+// schemas have a single item schema, so tuples of mixed types accept any item.
+func convertTupleTypeToCRD(expr hclsyntax.Expression) (v1.JSONSchemaProps, string) {
+	elements, ok := expr.(*hclsyntax.TupleConsExpr)
+	if !ok {
+		return v1.JSONSchemaProps{}, "unsupported tuple type"
+	}
+
+	var itemProp *v1.JSONSchemaProps
+	for _, element := range elements.Exprs {
+		elementProp, warn := convertTypeExprToCRD(element)
+		if warn != "" {
+			return v1.JSONSchemaProps{}, "unsupported tuple type"
+		}
+		if itemProp != nil && !reflect.DeepEqual(*itemProp, elementProp) {
+			itemProp = &v1.JSONSchemaProps{XPreserveUnknownFields: boolPtr(true)}
+			break
+		}
+		itemProp = &elementProp
+	}
+	if itemProp == nil {
+		itemProp = &v1.JSONSchemaProps{XPreserveUnknownFields: boolPtr(true)}
+	}
+
+	length := int64(len(elements.Exprs))
+	return v1.JSONSchemaProps{
+		Type:     "array",
+		MinItems: &length,
+		MaxItems: &length,
+		Items: &v1.JSONSchemaPropsOrArray{
+			Schema: itemProp,
+		},
+	}, ""
 }
 
 func boolPtr(b bool) *bool {
 	return &b
 }
+
+func stringPtr(s string) *string {
+	return &s
+}
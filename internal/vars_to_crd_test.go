@@ -5,6 +5,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/syntasso/kratix-cli/internal"
+	"k8s.io/utils/ptr"
 )
 
 var _ = Describe("VariablesToCRDSpecSchema", func() {
@@ -64,4 +65,97 @@ var _ = Describe("VariablesToCRDSpecSchema", func() {
 			))
 		})
 	})
+
+	Context("when processing variables with defaults, validations and sensitivity", func() {
+		It("sets the defaults, enums, patterns and required variables", func() {
+			vars := []internal.TerraformVariable{
+				{Name: "size", Type: "string", Default: "small", HasDefault: true, Enum: []any{"small", "large"}},
+				{Name: "password", Type: "string", Description: "The admin password", Sensitive: true, Pattern: "^[a-z]+$"},
+				{Name: "replicas", Type: "number", HasDefault: true, Nullable: ptr.To(true)},
+				{Name: "tags", Type: "list(string)", Enum: []any{"a"}},
+			}
+
+			schema, warnings := internal.VariablesToCRDSpecSchema(vars)
+			Expect(warnings).To(BeEmpty())
+
+			Expect(schema.Required).To(Equal([]string{"password", "tags"}))
+
+			Expect(schema.Properties["size"].Default.Raw).To(MatchJSON(`"small"`))
+			Expect(schema.Properties["size"].Enum).To(HaveLen(2))
+			Expect(schema.Properties["size"].Enum[1].Raw).To(MatchJSON(`"large"`))
+
+			Expect(schema.Properties["password"].Description).To(Equal("The admin password (sensitive)"))
+			Expect(schema.Properties["password"].Pattern).To(Equal("^[a-z]+$"))
+			Expect(schema.Properties["password"].Default).To(BeNil())
+
+			Expect(schema.Properties["replicas"].Nullable).To(BeTrue())
+			Expect(schema.Properties["replicas"].Default).To(BeNil())
+
+			Expect(schema.Properties["tags"].Enum).To(BeEmpty())
+		})
+	})
+
+	Context("when processing object, set and tuple types", func() {
+		It("converts them into nested structural schemas", func() {
+			vars := []internal.TerraformVariable{
+				{Name: "service", Type: `object({ name = string, port = optional(number, 80), labels = optional(map(string)) })`},
+				{Name: "zones", Type: "set(string)"},
+				{Name: "rules", Type: "set(object({ cidr = string }))"},
+				{Name: "pair", Type: "tuple([string, string])"},
+				{Name: "mixed", Type: "tuple([string, number, bool])"},
+				{Name: "anything", Type: "list(any)"},
+			}
+
+			schema, warnings := internal.VariablesToCRDSpecSchema(vars)
+			Expect(warnings).To(BeEmpty())
+			expectStructural(schema)
+
+			service := schema.Properties["service"]
+			Expect(service.Type).To(Equal("object"))
+			Expect(service.XPreserveUnknownFields).To(BeNil())
+			Expect(service.Required).To(Equal([]string{"name"}))
+			Expect(service.Properties["name"].Type).To(Equal("string"))
+			Expect(service.Properties["port"].Type).To(Equal("number"))
+			Expect(service.Properties["port"].Default.Raw).To(MatchJSON(`80`))
+			Expect(service.Properties["labels"].Type).To(Equal("object"))
+			Expect(service.Properties["labels"].AdditionalProperties.Schema.Type).To(Equal("string"))
+			Expect(service.Properties["labels"].Default).To(BeNil())
+
+			zones := schema.Properties["zones"]
+			Expect(zones.Type).To(Equal("array"))
+			Expect(zones.XListType).To(Equal(ptr.To("set")))
+			Expect(zones.Items.Schema.Type).To(Equal("string"))
+
+			rules := schema.Properties["rules"]
+			Expect(rules.XListType).To(Equal(ptr.To("set")))
+			Expect(rules.Items.Schema.XMapType).To(Equal(ptr.To("atomic")))
+			Expect(rules.Items.Schema.Required).To(Equal([]string{"cidr"}))
+
+			pair := schema.Properties["pair"]
+			Expect(pair.Type).To(Equal("array"))
+			Expect(pair.MinItems).To(Equal(ptr.To(int64(2))))
+			Expect(pair.MaxItems).To(Equal(ptr.To(int64(2))))
+			Expect(pair.Items.Schema.Type).To(Equal("string"))
+
+			mixed := schema.Properties["mixed"]
+			Expect(mixed.MinItems).To(Equal(ptr.To(int64(3))))
+			Expect(mixed.Items.Schema.XPreserveUnknownFields).To(Equal(ptr.To(true)))
+
+			Expect(schema.Properties["anything"].Items.Schema.XPreserveUnknownFields).To(Equal(ptr.To(true)))
+		})
+
+		It("warns about invalid type constraints", func() {
+			vars := []internal.TerraformVariable{
+				{Name: "broken", Type: "object({ name = strin })"},
+				{Name: "unknown", Type: "list(whatever)"},
+			}
+
+			schema, warnings := internal.VariablesToCRDSpecSchema(vars)
+			Expect(schema.Properties).To(BeEmpty())
+			Expect(warnings).To(ConsistOf(
+				"warning: unable to automatically convert broken of type object({ name = strin }) into CRD, skipping",
+				"warning: unable to automatically convert unknown of type list(whatever) into CRD, skipping",
+			))
+		})
+	})
 })
@@ -0,0 +1,109 @@
+package integration_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/syntasso/kratix/api/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("kratix convert", func() {
+	var r *runner
+	var workingDir string
+
+	BeforeEach(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "kratix-test")
+		Expect(err).NotTo(HaveOccurred())
+		r = &runner{exitCode: 0, dir: workingDir}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	Describe("--help", func() {
+		It("shows the help message", func() {
+			sess := r.run("convert", "--help")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("Command to convert a Promise between the flat and the split layouts"),
+				gbytes.Say("kratix convert --to split|flat"),
+			))
+		})
+	})
+
+	It("requires --to", func() {
+		r.exitCode = 1
+		sess := r.run("convert")
+		Expect(sess.Err).To(gbytes.Say(`required flag\(s\) "to" not set`))
+	})
+
+	When("the promise uses the flat layout", func() {
+		var originalPromise v1alpha1.Promise
+
+		BeforeEach(func() {
+			r.run("init", "promise", "postgresql", "--group", "syntasso.io", "--kind", "Database")
+			r.run("update", "api", "-p", "size:string")
+			r.run("update", "destination-selector", "env=dev")
+			r.run("add", "container", "resource/configure/instance", "--image", "syntasso/first:v1.0.0")
+			r.run("add", "container", "promise/configure/promise", "--image", "syntasso/second:v1.0.0")
+			Expect(yaml.Unmarshal([]byte(cat(filepath.Join(workingDir, "promise.yaml"))), &originalPromise)).To(Succeed())
+		})
+
+		It("converts it to the split layout and back", func() {
+			sess := r.run("convert", "--to", "split")
+			Expect(sess.Out).To(gbytes.Say("Promise converted to the split layout"))
+			Expect(filepath.Join(workingDir, "promise.yaml")).NotTo(BeAnExistingFile())
+			for _, file := range []string{"api.yaml", "dependencies.yaml", "metadata.yaml", "destination-selectors.yaml", "workflows/resource/configure/workflow.yaml", "workflows/promise/configure/workflow.yaml"} {
+				Expect(filepath.Join(workingDir, file)).To(BeAnExistingFile())
+			}
+			Expect(cat(filepath.Join(workingDir, "metadata.yaml"))).To(SatisfyAll(
+				ContainSubstring("name: postgresql"),
+				ContainSubstring("kratix.io/promise-version: v0.0.1"),
+			))
+			Expect(getCRD(workingDir, true).Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties).To(HaveKey("size"))
+			Expect(r.run("validate", "promise").Out).To(gbytes.Say("Promise is valid"))
+
+			r.exitCode = 1
+			sess = r.run("convert", "--to", "split")
+			Expect(sess.Err).To(gbytes.Say("failed to find promise.yaml in directory; the Promise may already use the split layout"))
+
+			r.exitCode = 0
+			sess = r.run("convert", "--to", "flat")
+			Expect(sess.Out).To(gbytes.Say("Promise converted to the flat layout"))
+			for _, file := range []string{"api.yaml", "dependencies.yaml", "metadata.yaml", "destination-selectors.yaml", "workflows/resource/configure/workflow.yaml"} {
+				Expect(filepath.Join(workingDir, file)).NotTo(BeAnExistingFile())
+			}
+			Expect(filepath.Join(workingDir, "workflows/resource/configure/instance/syntasso-first/Dockerfile")).To(BeAnExistingFile())
+
+			var promise v1alpha1.Promise
+			Expect(yaml.Unmarshal([]byte(cat(filepath.Join(workingDir, "promise.yaml"))), &promise)).To(Succeed())
+			Expect(promise.GetName()).To(Equal("postgresql"))
+			Expect(promise.GetLabels()).To(Equal(originalPromise.GetLabels()))
+			Expect(promise.Spec.DestinationSelectors).To(Equal(originalPromise.Spec.DestinationSelectors))
+			Expect(promise.Spec.API.Raw).To(MatchJSON(originalPromise.Spec.API.Raw))
+			Expect(promise.Spec.Workflows.Resource.Configure).To(HaveLen(1))
+			Expect(promise.Spec.Workflows.Promise.Configure).To(HaveLen(1))
+		})
+	})
+
+	When("the promise was initialised with --split", func() {
+		BeforeEach(func() {
+			r.run("init", "promise", "postgresql", "--group", "syntasso.io", "--kind", "Database", "--split")
+		})
+
+		It("requires a name to convert it to the flat layout", func() {
+			r.exitCode = 1
+			sess := r.run("convert", "--to", "flat")
+			Expect(sess.Err).To(gbytes.Say("the Promise has no name: set --name or add it to metadata.yaml"))
+
+			r.exitCode = 0
+			r.run("convert", "--to", "flat", "--name", "postgresql")
+			matchPromise(workingDir, "postgresql", "syntasso.io", "v1alpha1", "Database", "database", "databases")
+		})
+	})
+})
@@ -3,11 +3,17 @@ package integration_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
+	"github.com/syntasso/kratix/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
 )
 
 var _ = Describe("InitCrossplanePromise", func() {
@@ -95,6 +101,7 @@ var _ = Describe("InitCrossplanePromise", func() {
 				Expect(generatedFiles).To(ConsistOf(files))
 				Expect(cat(filepath.Join(workingDir, "api.yaml"))).To(Equal(cat("assets/crossplane/expected-output-with-split/api.yaml")))
 				Expect(cat(filepath.Join(workingDir, "workflows/resource/configure/workflow.yaml"))).To(Equal(cat("assets/crossplane/expected-output-with-split/workflows/resource/configure/workflow.yaml")))
+				Expect(cat(filepath.Join(workingDir, "workflows/resource/delete/workflow.yaml"))).To(Equal(cat("assets/crossplane/expected-output-with-split/workflows/resource/delete/workflow.yaml")))
 				Expect(cat(filepath.Join(workingDir, "example-resource.yaml"))).To(Equal(cat("assets/crossplane/expected-output-with-split/example-resource.yaml")))
 				Expect(cat(filepath.Join(workingDir, "README.md"))).To(Equal(cat("assets/crossplane/expected-output-with-split/README.md")))
 				Expect(cat(filepath.Join(workingDir, "dependencies.yaml"))).To(Equal(cat("assets/crossplane/expected-output-with-split/dependencies.yaml")))
@@ -137,6 +144,202 @@ var _ = Describe("InitCrossplanePromise", func() {
 				))
 			})
 		})
+
+		Describe("the XRD version", func() {
+			var promise v1alpha1.Promise
+
+			BeforeEach(func() {
+				r.flags["--xrd"] = "assets/crossplane/xrd-with-versions.yaml"
+			})
+
+			readPromise := func() apiextensionsv1.CustomResourceDefinition {
+				promiseContent, err := os.ReadFile(filepath.Join(workingDir, "promise.yaml"))
+				ExpectWithOffset(1, err).NotTo(HaveOccurred())
+				promise = v1alpha1.Promise{}
+				ExpectWithOffset(1, yaml.Unmarshal(promiseContent, &promise)).To(Succeed())
+				var crd apiextensionsv1.CustomResourceDefinition
+				ExpectWithOffset(1, yaml.Unmarshal(promise.Spec.API.Raw, &crd)).To(Succeed())
+				return crd
+			}
+
+			It("defaults to the referenceable version", func() {
+				session = r.run(initPromiseCmd...)
+				crd := readPromise()
+				Expect(crd.Spec.Versions[0].Name).To(Equal("v1beta1"))
+				Expect(crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties).To(HaveKey("versioning"))
+			})
+
+			It("uses the version provided", func() {
+				session = r.run(append(initPromiseCmd, "--xrd-version", "v1alpha1")...)
+				crd := readPromise()
+				Expect(crd.Spec.Versions[0].Name).To(Equal("v1alpha1"))
+				Expect(crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties).NotTo(HaveKey("versioning"))
+				Expect(promise.Spec.Workflows.Resource.Configure[0].Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("containers", ContainElement(HaveKeyWithValue("env", ContainElement(map[string]any{"name": "XRD_VERSION", "value": "v1alpha1"}))))))
+			})
+
+			It("errors when the version is not in the XRD", func() {
+				r.exitCode = 1
+				session := r.run(append(initPromiseCmd, "--xrd-version", "v2")...)
+				Expect(session.Err).To(gbytes.Say(`version v2 not found in XRD xobjectstorages.awsblueprints.io; the XRD has versions: v1alpha0, v1alpha1, v1beta1`))
+			})
+
+			It("errors when the version is not served", func() {
+				r.exitCode = 1
+				session := r.run(append(initPromiseCmd, "--xrd-version", "v1alpha0")...)
+				Expect(session.Err).To(gbytes.Say(`version v1alpha0 of XRD xobjectstorages.awsblueprints.io is not served`))
+			})
+		})
+
+		Describe("validating the compositions", func() {
+			var compositionsDir, composition string
+
+			BeforeEach(func() {
+				compositionsDir = filepath.Join(workingDir, "compositions")
+				Expect(os.Mkdir(compositionsDir, 0755)).To(Succeed())
+				composition = cat("assets/crossplane/composition.yaml")
+				r.flags["--dir"] = filepath.Join(workingDir, "promise")
+				r.flags["--compositions"] = compositionsDir
+			})
+
+			It("reads the compositions and their functions from a directory", func() {
+				Expect(os.WriteFile(filepath.Join(compositionsDir, "composition.yaml"), []byte(composition), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(compositionsDir, "function.yaml"), []byte("apiVersion: pkg.crossplane.io/v1\nkind: Function\nmetadata:\n  name: function-patch-and-transform\n"), 0644)).To(Succeed())
+
+				session = r.run(initPromiseCmd...)
+				promiseContent, err := os.ReadFile(filepath.Join(workingDir, "promise", "promise.yaml"))
+				Expect(err).NotTo(HaveOccurred())
+				var promise v1alpha1.Promise
+				Expect(yaml.Unmarshal(promiseContent, &promise)).To(Succeed())
+
+				var kinds []string
+				for _, dep := range promise.Spec.Dependencies {
+					kinds = append(kinds, dep.GetKind())
+				}
+				Expect(kinds).To(ConsistOf("Composition", "Function", "CompositeResourceDefinition"))
+			})
+
+			It("errors when a composition does not compose the XRD composite resources", func() {
+				Expect(os.WriteFile(filepath.Join(compositionsDir, "composition.yaml"), []byte(strings.Replace(composition, "kind: XObjectStorage", "kind: XDatabase", 1)), 0644)).To(Succeed())
+
+				r.exitCode = 1
+				session := r.run(initPromiseCmd...)
+				Expect(session.Err).To(gbytes.Say(`Composition s3bucket.awsblueprints.io composes awsblueprints.io/v1alpha1 XDatabase, not the XObjectStorage composite resources of XRD xobjectstorages.awsblueprints.io`))
+			})
+
+			It("errors when there are no compositions", func() {
+				Expect(os.WriteFile(filepath.Join(compositionsDir, "function.yaml"), []byte("apiVersion: pkg.crossplane.io/v1\nkind: Function\nmetadata:\n  name: function-patch-and-transform\n"), 0644)).To(Succeed())
+
+				r.exitCode = 1
+				session := r.run(initPromiseCmd...)
+				Expect(session.Err).To(gbytes.Say(`no Compositions found in ` + compositionsDir))
+			})
+
+			It("returns an error when a file is not valid YAML", func() {
+				Expect(os.WriteFile(filepath.Join(compositionsDir, "composition.yaml"), []byte("apiVersion: [\n"), 0644)).To(Succeed())
+
+				r.exitCode = 1
+				session := r.run(initPromiseCmd...)
+				Expect(session.Err).To(gbytes.Say(`failed to generate dependencies from compositions: failed to decode dependency file`))
+			})
+		})
+
+		Describe("the object created for the requests", func() {
+			var promise v1alpha1.Promise
+
+			runInit := func(xrdPath string) {
+				r.flags["--xrd"] = xrdPath
+				session = r.run(initPromiseCmd...)
+				promiseContent, err := os.ReadFile(filepath.Join(workingDir, "promise.yaml"))
+				Expect(err).NotTo(HaveOccurred())
+				promise = v1alpha1.Promise{}
+				Expect(yaml.Unmarshal(promiseContent, &promise)).To(Succeed())
+			}
+
+			aspectEnv := func() []corev1.EnvVar {
+				pipelines := promise.Spec.Workflows.Resource.Configure
+				ExpectWithOffset(1, pipelines).To(HaveLen(1))
+				pipelineBytes, err := yaml.Marshal(pipelines[0].Object)
+				ExpectWithOffset(1, err).NotTo(HaveOccurred())
+				var pipeline v1alpha1.Pipeline
+				ExpectWithOffset(1, yaml.Unmarshal(pipelineBytes, &pipeline)).To(Succeed())
+				return pipeline.Spec.Containers[0].Env
+			}
+
+			apiSchema := func() apiextensionsv1.JSONSchemaProps {
+				var crd apiextensionsv1.CustomResourceDefinition
+				ExpectWithOffset(1, yaml.Unmarshal(promise.Spec.API.Raw, &crd)).To(Succeed())
+				return *crd.Spec.Versions[0].Schema.OpenAPIV3Schema
+			}
+
+			It("is the claim when the XRD has claimNames", func() {
+				runInit("assets/crossplane/xrd.yaml")
+				Expect(aspectEnv()).To(ContainElements(
+					corev1.EnvVar{Name: "XRD_KIND", Value: "ObjectStorage"},
+					corev1.EnvVar{Name: "XRD_SCOPE", Value: "Namespaced"},
+				))
+				Expect(apiSchema().Properties["spec"].Properties).To(HaveKey("compositeDeletePolicy"))
+			})
+
+			It("is the cluster-scoped composite resource when the XRD has no claimNames", func() {
+				runInit("assets/crossplane/xrd-without-claims.yaml")
+				Expect(aspectEnv()).To(ContainElements(
+					corev1.EnvVar{Name: "XRD_KIND", Value: "XObjectStorage"},
+					corev1.EnvVar{Name: "XRD_SCOPE", Value: "Cluster"},
+				))
+
+				schema := apiSchema()
+				spec := schema.Properties["spec"]
+				Expect(spec.Properties).To(SatisfyAll(
+					HaveKey("region"),
+					HaveKey("compositionRef"),
+					Not(HaveKey("compositeDeletePolicy")),
+					Not(HaveKey("resourceRef")),
+				))
+				Expect(spec.Properties["writeConnectionSecretToRef"].Required).To(ConsistOf("name", "namespace"))
+				Expect(schema.Properties["status"].Properties).To(HaveKey("connectionSecretRef"))
+			})
+
+			DescribeTable("is the Crossplane v2 composite resource",
+				func(xrdPath, scope string) {
+					runInit(xrdPath)
+					Expect(aspectEnv()).To(ContainElements(
+						corev1.EnvVar{Name: "XRD_KIND", Value: "ObjectStorage"},
+						corev1.EnvVar{Name: "XRD_SCOPE", Value: scope},
+					))
+
+					schema := apiSchema()
+					spec := schema.Properties["spec"]
+					Expect(spec.Properties).To(SatisfyAll(
+						HaveKey("region"),
+						HaveKey("crossplane"),
+						Not(HaveKey("compositionRef")),
+						Not(HaveKey("writeConnectionSecretToRef")),
+					))
+					Expect(spec.Properties["crossplane"].Properties).To(HaveKey("compositionSelector"))
+					Expect(schema.Properties["status"].Properties).NotTo(HaveKey("connectionSecretRef"))
+
+					Expect(promise.Spec.Dependencies).To(HaveLen(1))
+					Expect(promise.Spec.Dependencies[0].GetAPIVersion()).To(Equal("apiextensions.crossplane.io/v2"))
+					xrdScope, _, _ := unstructured.NestedString(promise.Spec.Dependencies[0].Object, "spec", "scope")
+					Expect(xrdScope).To(Equal(scope))
+				},
+				Entry("when it is namespaced", "assets/crossplane/xrd-v2.yaml", "Namespaced"),
+				Entry("when it is cluster-scoped", "assets/crossplane/xrd-v2-cluster.yaml", "Cluster"),
+			)
+
+			It("errors when a Crossplane v2 XRD that is not LegacyCluster has claimNames", func() {
+				xrd, err := os.ReadFile("assets/crossplane/xrd-v2.yaml")
+				Expect(err).NotTo(HaveOccurred())
+				xrdPath := filepath.Join(workingDir, "xrd.yaml")
+				xrdWithClaims := strings.Replace(string(xrd), "  scope: Namespaced\n", "  scope: Namespaced\n  claimNames:\n    kind: Claim\n    plural: claims\n", 1)
+				Expect(os.WriteFile(xrdPath, []byte(xrdWithClaims), 0644)).To(Succeed())
+
+				r.flags["--xrd"] = xrdPath
+				r.exitCode = 1
+				session := r.run(initPromiseCmd...)
+				Expect(session.Err).To(gbytes.Say(`claimNames are only supported by LegacyCluster XRDs, the XRD is Namespaced`))
+			})
+		})
 	})
 })
 
@@ -46,7 +46,7 @@ var _ = Describe("init helm-promise", func() {
 		It("raises an error", func() {
 			r.exitCode = 1
 			Expect(r.run("init", "helm-promise", "postgresql", "--group", "syntasso.io", "--kind", "Database").Err).To(SatisfyAll(
-				gbytes.Say(`required flag\(s\) "chart-url" not set`),
+				gbytes.Say(`at least one of the flags in the group \[chart-url chart-path\] is required`),
 			))
 		})
 	})
@@ -84,6 +84,13 @@ var _ = Describe("init helm-promise", func() {
 					{Name: "CHART_NAME", Value: "hello-world"}})
 			})
 
+			By("generating a workflow file with helm resource delete workflow", func() {
+				pipelines := getWorkflowsFromSplitFile(workingDir, "resource", "delete")
+				Expect(pipelines).To(HaveLen(1))
+				Expect(pipelines[0].GetName()).To(Equal("instance-delete"))
+				Expect(pipelines[0].Spec.Containers[0].Image).To(Equal("ghcr.io/syntasso/kratix-cli/helm-resource-configure:v0.2.0"))
+			})
+
 			By("including correct gvk and CRD schema in a api.yaml", func() {
 				apiYAML, err := os.ReadFile(filepath.Join(workingDir, "api.yaml"))
 				Expect(err).NotTo(HaveOccurred())
@@ -133,6 +140,13 @@ var _ = Describe("init helm-promise", func() {
 					{Name: "CHART_VERSION", Value: "0.1.0"},
 				})
 			})
+
+			By("including helm resource delete workflow in promise.yaml", func() {
+				pipelines := getWorkflows(workingDir)["resource"]["delete"]
+				Expect(pipelines).To(HaveLen(1))
+				Expect(pipelines[0].GetName()).To(Equal("instance-delete"))
+				Expect(pipelines[0].Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "CHART_VERSION", Value: "0.1.0"}))
+			})
 		})
 	})
 
@@ -184,6 +198,303 @@ var _ = Describe("init helm-promise", func() {
 			session := withExitCode(1).run("init", "helm-promise", "--chart-url", "oci://registry-1.docker.io/bitnamicharts/vault", "--chart-version", "200", "redis", "--group", "syntasso.io", "--kind", "Database")
 			Expect(session.Err).To(gbytes.Say("failed to fetch helm chart"))
 		})
+
+		It("errors when it cannot read the CA bundle of the registry", func() {
+			session := withExitCode(1).run("init", "helm-promise", "--chart-url", "oci://harbor.example.com/charts/redis", "--ca-file", filepath.Join(workingDir, "ca.crt"), "redis", "--group", "syntasso.io", "--kind", "Database")
+			Expect(session.Err).To(gbytes.Say("failed to read CA bundle"))
+		})
+	})
+
+	Context("local helm charts", func() {
+		var chartDir string
+
+		BeforeEach(func() {
+			var err error
+			chartDir, err = filepath.Abs("assets/operator-chart")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("vendors the chart into the pipeline image", func() {
+			session := r.run("init", "helm-promise", "redis", "--chart-path", chartDir, "--image", "myorg/redis-helm:v0.1.0", "--group", "syntasso.io", "--kind", "Redis")
+			Expect(session.Out).To(SatisfyAll(
+				gbytes.Say("redis promise bootstrapped in the current directory"),
+				gbytes.Say(`docker build -t myorg/redis-helm:v0.1.0 workflows/resource/configure/instance-configure/instance-configure`),
+			))
+
+			By("rendering the vendored chart in the pipelines", func() {
+				workflows := getWorkflows(workingDir)["resource"]
+				for _, action := range []v1alpha1.Action{"configure", "delete"} {
+					Expect(workflows[action]).To(HaveLen(1))
+					Expect(workflows[action][0].Spec.Containers[0].Image).To(Equal("myorg/redis-helm:v0.1.0"))
+					Expect(workflows[action][0].Spec.Containers[0].Env).To(ConsistOf(corev1.EnvVar{Name: "CHART_URL", Value: "/resources/redis-operator-0.1.0.tgz"}))
+				}
+			})
+
+			By("packaging the chart in the image resources", func() {
+				imageDir := filepath.Join(workingDir, "workflows", "resource", "configure", "instance-configure", "instance-configure")
+				Expect(filepath.Join(imageDir, "resources", "redis-operator-0.1.0.tgz")).To(BeAnExistingFile())
+				Expect(cat(filepath.Join(imageDir, "Dockerfile"))).To(Equal("FROM \"ghcr.io/syntasso/kratix-cli/helm-resource-configure:v0.2.0\"\n\nADD resources /resources\n"))
+			})
+
+			By("including CRD schema from chart values in promise.yaml", func() {
+				Expect(getCRDProperties(workingDir, false)).To(SatisfyAll(HaveKey("image"), HaveKey("replicas")))
+			})
+
+			By("reading packaged charts", func() {
+				packagedChart := filepath.Join(workingDir, "workflows", "resource", "configure", "instance-configure", "instance-configure", "resources", "redis-operator-0.1.0.tgz")
+				promiseDir := filepath.Join(workingDir, "packaged")
+				r.run("init", "helm-promise", "redis", "--chart-path", packagedChart, "--image", "myorg/redis-helm:v0.1.0", "--group", "syntasso.io", "--kind", "Redis", "--dir", promiseDir)
+				Expect(getCRDProperties(promiseDir, false)).To(SatisfyAll(HaveKey("image"), HaveKey("replicas")))
+			})
+		})
+
+		It("references the published chart when --chart-url is set", func() {
+			r.run("init", "helm-promise", "redis", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/redis-operator", "--chart-version", "0.1.0", "--group", "syntasso.io", "--kind", "Redis")
+
+			pipelines := getWorkflows(workingDir)["resource"]["configure"]
+			Expect(pipelines).To(HaveLen(1))
+			matchHelmResourceConfigurePipeline(pipelines[0], []corev1.EnvVar{
+				{Name: "CHART_URL", Value: "oci://registry.example.com/charts/redis-operator"},
+				{Name: "CHART_VERSION", Value: "0.1.0"},
+			})
+			Expect(filepath.Join(workingDir, "workflows")).NotTo(BeADirectory())
+			Expect(getCRDProperties(workingDir, false)).To(HaveKey("image"))
+		})
+
+		It("pins the published chart to the version of the local chart", func() {
+			r.run("init", "helm-promise", "redis", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/redis-operator", "--group", "syntasso.io", "--kind", "Redis")
+
+			pipelines := getWorkflows(workingDir)["resource"]["configure"]
+			Expect(pipelines).To(HaveLen(1))
+			matchHelmResourceConfigurePipeline(pipelines[0], []corev1.EnvVar{
+				{Name: "CHART_URL", Value: "oci://registry.example.com/charts/redis-operator"},
+				{Name: "CHART_VERSION", Value: "0.1.0"},
+			})
+			Expect(cat(filepath.Join(workingDir, "README.md"))).To(ContainSubstring("--chart-version 0.1.0"))
+		})
+
+		It("requires an image to vendor the chart", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "redis", "--chart-path", chartDir, "--group", "syntasso.io", "--kind", "Redis")
+			Expect(session.Err).To(gbytes.Say("--image is required to vendor the --chart-path chart; set --chart-url to use a published chart instead"))
+		})
+
+		It("authenticates the pipelines with the credentials secret", func() {
+			r.run("init", "helm-promise", "redis", "--chart-path", chartDir, "--chart-url", "oci://harbor.example.com/charts/redis-operator", "--credentials-secret", "harbor-credentials", "--insecure-skip-tls-verify", "--group", "syntasso.io", "--kind", "Redis")
+
+			secretEnvVar := func(name, key string) corev1.EnvVar {
+				optional := true
+				return corev1.EnvVar{Name: name, ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "harbor-credentials"},
+						Key:                  key,
+						Optional:             &optional,
+					},
+				}}
+			}
+
+			workflows := getWorkflows(workingDir)["resource"]
+			for _, action := range []v1alpha1.Action{"configure", "delete"} {
+				Expect(workflows[action]).To(HaveLen(1))
+				Expect(workflows[action][0].Spec.Containers[0].Env).To(ConsistOf(
+					corev1.EnvVar{Name: "CHART_URL", Value: "oci://harbor.example.com/charts/redis-operator"},
+					corev1.EnvVar{Name: "CHART_VERSION", Value: "0.1.0"},
+					secretEnvVar("HELM_USERNAME", "username"),
+					secretEnvVar("HELM_PASSWORD", "password"),
+					secretEnvVar("HELM_REGISTRY_CONFIG_JSON", ".dockerconfigjson"),
+					secretEnvVar("HELM_CA_BUNDLE", "ca.crt"),
+					corev1.EnvVar{Name: "HELM_INSECURE_SKIP_TLS_VERIFY", Value: "true"},
+				))
+			}
+			Expect(cat(filepath.Join(workingDir, "README.md"))).To(ContainSubstring("--credentials-secret harbor-credentials --insecure-skip-tls-verify"))
+		})
+
+		It("does not use the credentials secret for vendored charts", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "redis", "--chart-path", chartDir, "--image", "myorg/redis-helm:v0.1.0", "--credentials-secret", "harbor-credentials", "--group", "syntasso.io", "--kind", "Redis")
+			Expect(session.Err).To(gbytes.Say("--credentials-secret is only used to fetch the --chart-url chart"))
+		})
+
+		It("errors when the chart cannot be loaded", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "redis", "--chart-path", filepath.Join(workingDir, "does-not-exist"), "--image", "myorg/redis-helm:v0.1.0", "--group", "syntasso.io", "--kind", "Redis")
+			Expect(session.Err).To(gbytes.Say("failed to load helm chart"))
+		})
+	})
+
+	Context("charts with a values.schema.json", func() {
+		It("only requires the values the chart does not default", func() {
+			chartDir, err := filepath.Abs("assets/helm-chart-with-schema")
+			Expect(err).NotTo(HaveOccurred())
+			r.run("init", "helm-promise", "site", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/nginx", "--group", "syntasso.io", "--kind", "Site")
+
+			spec := getCRD(workingDir, false).Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+			Expect(spec.Required).To(ConsistOf("siteName"))
+			Expect(spec.Properties["image"].Required).To(BeEmpty())
+			Expect(spec.Properties["service"].Required).To(BeEmpty())
+			Expect(*spec.Properties["service"].Properties["port"].Minimum).To(Equal(1.0))
+		})
+	})
+
+	Context("exposed and platform values", func() {
+		var chartDir, platformValuesFile string
+
+		BeforeEach(func() {
+			var err error
+			chartDir, err = filepath.Abs("assets/helm-chart")
+			Expect(err).NotTo(HaveOccurred())
+
+			platformValuesFile = filepath.Join(workingDir, "platform-values.yaml")
+			Expect(os.WriteFile(platformValuesFile, []byte("image:\n  registry: registry.example.com\nsecurityContext:\n  runAsNonRoot: true\n  runAsUser: 1001\npodAnnotations:\n  team: platform\n"), 0o644)).To(Succeed())
+		})
+
+		It("only exposes the --expose values in the Promise API", func() {
+			r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--expose", "replicas", "--expose", "auth.database", "--group", "syntasso.io", "--kind", "WebApp")
+
+			props := getCRDProperties(workingDir, false)
+			Expect(props).To(SatisfyAll(HaveLen(2), HaveKey("replicas"), HaveKey("auth")))
+			Expect(props["auth"].Properties).To(SatisfyAll(HaveLen(1), HaveKey("database")))
+			Expect(cat(filepath.Join(workingDir, "README.md"))).To(ContainSubstring("--expose replicas --expose auth.database"))
+		})
+
+		It("errors when an exposed value is not in the chart", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--expose", "auth.password", "--group", "syntasso.io", "--kind", "WebApp")
+			Expect(session.Err).To(gbytes.Say("field spec.auth.password not found in the CRD schema"))
+		})
+
+		It("bakes the --platform-values into the pipelines and removes them from the Promise API", func() {
+			r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--platform-values", platformValuesFile, "--group", "syntasso.io", "--kind", "WebApp")
+
+			By("passing the platform values to the helm aspect", func() {
+				workflows := getWorkflows(workingDir)["resource"]
+				for _, action := range []v1alpha1.Action{"configure", "delete"} {
+					Expect(workflows[action]).To(HaveLen(1))
+					Expect(workflows[action][0].Spec.Containers[0].Env).To(ConsistOf(
+						corev1.EnvVar{Name: "CHART_URL", Value: "oci://registry.example.com/charts/webapp"},
+						corev1.EnvVar{Name: "CHART_VERSION", Value: "1.0.0"},
+						corev1.EnvVar{Name: "PLATFORM_VALUES", Value: `{"image":{"registry":"registry.example.com"},"podAnnotations":{"team":"platform"},"securityContext":{"runAsNonRoot":true,"runAsUser":1001}}`},
+					))
+				}
+			})
+
+			By("leaving the platform values out of the Promise API", func() {
+				props := getCRDProperties(workingDir, false)
+				Expect(props).To(SatisfyAll(
+					HaveKey("replicas"),
+					HaveKey("auth"),
+					HaveKey("podAnnotations"),
+					Not(HaveKey("securityContext")),
+				))
+				Expect(props["image"].Properties).To(SatisfyAll(HaveKey("repository"), HaveKey("tag"), Not(HaveKey("registry"))))
+			})
+		})
+
+		It("errors when the platform values cannot be read", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--platform-values", filepath.Join(workingDir, "missing.yaml"), "--group", "syntasso.io", "--kind", "WebApp")
+			Expect(session.Err).To(gbytes.Say("failed to read values file"))
+		})
+	})
+
+	Context("rendering flags", func() {
+		var chartDir string
+
+		BeforeEach(func() {
+			var err error
+			chartDir, err = filepath.Abs("assets/helm-chart")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("configures the rendering of the chart in the pipelines", func() {
+			r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--include-crds", "--api-versions", "monitoring.coreos.com/v1", "--api-versions", "cert-manager.io/v1", "--kube-version", "1.31.0", "--group", "syntasso.io", "--kind", "WebApp")
+
+			pipelines := getWorkflows(workingDir)["resource"]["configure"]
+			Expect(pipelines).To(HaveLen(1))
+			Expect(pipelines[0].Spec.Containers[0].Env).To(ConsistOf(
+				corev1.EnvVar{Name: "CHART_URL", Value: "oci://registry.example.com/charts/webapp"},
+				corev1.EnvVar{Name: "CHART_VERSION", Value: "1.0.0"},
+				corev1.EnvVar{Name: "INCLUDE_CRDS", Value: "true"},
+				corev1.EnvVar{Name: "API_VERSIONS", Value: "monitoring.coreos.com/v1,cert-manager.io/v1"},
+				corev1.EnvVar{Name: "KUBE_VERSION", Value: "1.31.0"},
+			))
+			Expect(cat(filepath.Join(workingDir, "README.md"))).To(ContainSubstring("--include-crds --api-versions monitoring.coreos.com/v1 --api-versions cert-manager.io/v1 --kube-version 1.31.0"))
+		})
+
+		It("errors when the kube version is invalid", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--kube-version", "latest", "--group", "syntasso.io", "--kind", "WebApp")
+			Expect(session.Err).To(gbytes.Say("invalid --kube-version latest"))
+		})
+
+		It("errors when the chart is rendered by a GitOps controller", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--include-crds", "--delivery", "flux", "--group", "syntasso.io", "--kind", "WebApp")
+			Expect(session.Err).To(gbytes.Say("--include-crds, --api-versions and --kube-version configure the rendering of --delivery rendered; the flux controller renders the chart"))
+		})
+	})
+
+	Context("gitops delivery", func() {
+		var chartDir string
+
+		BeforeEach(func() {
+			var err error
+			chartDir, err = filepath.Abs("assets/helm-chart")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("configures the pipelines to deliver a Flux HelmRelease", func() {
+			r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--delivery", "flux", "--credentials-secret", "registry-credentials", "--group", "syntasso.io", "--kind", "WebApp")
+
+			workflows := getWorkflows(workingDir)["resource"]
+			for _, action := range []v1alpha1.Action{"configure", "delete"} {
+				Expect(workflows[action]).To(HaveLen(1))
+				Expect(workflows[action][0].Spec.Containers[0].Env).To(SatisfyAll(
+					ContainElement(corev1.EnvVar{Name: "DELIVERY", Value: "flux"}),
+					ContainElement(corev1.EnvVar{Name: "HELM_CREDENTIALS_SECRET", Value: "registry-credentials"}),
+				))
+			}
+			Expect(cat(filepath.Join(workingDir, "README.md"))).To(ContainSubstring("--delivery flux"))
+		})
+
+		It("configures the pipelines to deliver an Argo CD Application", func() {
+			r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "https://charts.example.com", "--chart-name", "webapp", "--delivery", "argocd", "--group", "syntasso.io", "--kind", "WebApp")
+
+			pipelines := getWorkflows(workingDir)["resource"]["configure"]
+			Expect(pipelines).To(HaveLen(1))
+			Expect(pipelines[0].Spec.Containers[0].Env).To(ConsistOf(
+				corev1.EnvVar{Name: "CHART_URL", Value: "https://charts.example.com"},
+				corev1.EnvVar{Name: "CHART_NAME", Value: "webapp"},
+				corev1.EnvVar{Name: "CHART_VERSION", Value: "1.0.0"},
+				corev1.EnvVar{Name: "DELIVERY", Value: "argocd"},
+			))
+		})
+
+		It("renders the release by default", func() {
+			r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--group", "syntasso.io", "--kind", "WebApp")
+
+			pipelines := getWorkflows(workingDir)["resource"]["configure"]
+			Expect(pipelines).To(HaveLen(1))
+			Expect(pipelines[0].Spec.Containers[0].Env).NotTo(ContainElement(HaveField("Name", "DELIVERY")))
+		})
+
+		It("errors when the delivery is not supported", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "oci://registry.example.com/charts/webapp", "--delivery", "kustomize", "--group", "syntasso.io", "--kind", "WebApp")
+			Expect(session.Err).To(gbytes.Say("unsupported --delivery kustomize: expected one of rendered, flux, argocd"))
+		})
+
+		It("errors when the chart is vendored", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--image", "myorg/webapp-helm:v0.1.0", "--delivery", "flux", "--group", "syntasso.io", "--kind", "WebApp")
+			Expect(session.Err).To(gbytes.Say("--delivery flux needs the chart published at --chart-url"))
+		})
+
+		It("errors when the chart is a tarball", func() {
+			r.exitCode = 1
+			session := r.run("init", "helm-promise", "webapp", "--chart-path", chartDir, "--chart-url", "https://example.com/webapp-1.0.0.tgz", "--delivery", "argocd", "--group", "syntasso.io", "--kind", "WebApp")
+			Expect(session.Err).To(gbytes.Say("--delivery argocd needs an OCI --chart-url or a chart repository with --chart-name"))
+		})
 	})
 })
 
@@ -198,7 +509,7 @@ func getPipelines(dir string) []v1alpha1.Pipeline {
 func matchHelmResourceConfigurePipeline(pipeline v1alpha1.Pipeline, vars []corev1.EnvVar) {
 	ExpectWithOffset(1, pipeline.Spec.Containers).To(HaveLen(1))
 	ExpectWithOffset(1, pipeline.Spec.Containers[0].Name).To(Equal("instance-configure"))
-	ExpectWithOffset(1, pipeline.Spec.Containers[0].Image).To(Equal("ghcr.io/syntasso/kratix-cli/helm-resource-configure:v0.1.0"))
+	ExpectWithOffset(1, pipeline.Spec.Containers[0].Image).To(Equal("ghcr.io/syntasso/kratix-cli/helm-resource-configure:v0.2.0"))
 	ExpectWithOffset(1, pipeline.Spec.Containers[0].Env).To(ConsistOf(vars))
 }
 
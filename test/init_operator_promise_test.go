@@ -48,7 +48,7 @@ var _ = Describe("InitOperatorPromise", func() {
 			r.exitCode = 1
 			r.flags = map[string]string{}
 			session := r.run(initPromiseCmd...)
-			Expect(session.Err).To(gbytes.Say(`Error: required flag\(s\) "api-schema-from", "group", "kind", "operator-manifests" not set`))
+			Expect(session.Err).To(gbytes.Say(`Error: required flag\(s\) "group", "kind", "operator-manifests" not set`))
 		})
 	})
 
@@ -108,6 +108,17 @@ var _ = Describe("InitOperatorPromise", func() {
 				expectPipelinesToMatchOperatorPipelines(pipelines)
 			})
 
+			It("includes a delete workflow", func() {
+				workflowContent, err := os.ReadFile(filepath.Join(workingDir, "workflows", "resource", "delete", "workflow.yaml"))
+				Expect(err).ToNot(HaveOccurred())
+
+				var pipelines []v1alpha1.Pipeline
+				Expect(yaml.Unmarshal(workflowContent, &pipelines)).To(Succeed())
+
+				expectPipelinesToMatchOperatorPipelines(pipelines)
+				Expect(pipelines[0].GetName()).To(Equal("instance-delete"))
+			})
+
 			It("includes an example resource request", func() {
 				Expect(generatedFiles).To(ContainElement("example-resource.yaml"))
 				expectExampleResourceToMatchOperatorResource(workingDir)
@@ -141,6 +152,240 @@ var _ = Describe("InitOperatorPromise", func() {
 			})
 		})
 
+		When("a namespace is provided", func() {
+			BeforeEach(func() {
+				r.flags["--namespace"] = "operators"
+			})
+
+			It("moves the namespaced manifests to the namespace", func() {
+				session = r.run(initPromiseCmd...)
+				dependencies := getSplitDependencies(workingDir)
+
+				namespaces := map[string]string{}
+				for _, dep := range dependencies {
+					namespaces[dep.GetKind()+"/"+dep.GetName()] = dep.GetNamespace()
+				}
+				Expect(namespaces).To(Equal(map[string]string{
+					"Namespace/operators":                                           "",
+					"ServiceAccount/operator-sa":                                    "operators",
+					"ServiceAccount/subdir-sa":                                      "operators",
+					"Deployment/operator-deployment":                                "operators",
+					"ClusterRole/pod-reader":                                        "",
+					"CustomResourceDefinition/postgresteams.acid.zalan.do":          "",
+					"CustomResourceDefinition/postgresqls.acid.zalan.do":            "",
+					"CustomResourceDefinition/operatorconfigurations.acid.zalan.do": "",
+				}))
+
+				readmeContents, err := os.ReadFile(filepath.Join(workingDir, "README.md"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(readmeContents)).To(ContainSubstring("--namespace operators"))
+			})
+
+			It("moves the namespace references of the manifests", func() {
+				r.flags["--operator-manifests"] = "assets/e2e-cnpg/manifests"
+				r.flags["--api-schema-from"] = "clusters.postgresql.cnpg.io"
+				session = r.run(initPromiseCmd...)
+
+				var kinds []string
+				for _, dep := range getSplitDependencies(workingDir) {
+					kinds = append(kinds, dep.GetKind())
+					switch dep.GetKind() {
+					case "Namespace":
+						Expect(dep.GetName()).To(Equal("operators"))
+					case "ClusterRoleBinding":
+						subjects, _, _ := unstructured.NestedSlice(dep.Object, "subjects")
+						Expect(subjects).To(ConsistOf(HaveKeyWithValue("namespace", "operators")))
+					case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+						webhooks, _, _ := unstructured.NestedSlice(dep.Object, "webhooks")
+						for _, webhook := range webhooks {
+							ns, _, _ := unstructured.NestedString(webhook.(map[string]any), "clientConfig", "service", "namespace")
+							Expect(ns).To(Equal("operators"))
+						}
+					}
+				}
+				Expect(kinds).To(HaveLen(15))
+				Expect(kinds[0]).To(Equal("Namespace"))
+			})
+		})
+
+		When("filters are provided", func() {
+			It("only includes the manifests matching the filters", func() {
+				session = r.run(append(initPromiseCmd, "--include", "ClusterRole", "--include", "app=operator-deployment", "--include", "ServiceAccount", "--exclude", "ServiceAccount")...)
+
+				var names []string
+				for _, dep := range getSplitDependencies(workingDir) {
+					names = append(names, dep.GetName())
+				}
+				Expect(names).To(ConsistOf("pod-reader", "operator-deployment"))
+
+				apiContent, err := os.ReadFile(filepath.Join(workingDir, "api.yaml"))
+				Expect(err).ToNot(HaveOccurred())
+				var apiCRD apiextensionsv1.CustomResourceDefinition
+				Expect(yaml.Unmarshal(apiContent, &apiCRD)).To(Succeed())
+				expectCRDToMatchOperatorCRD(apiCRD)
+			})
+
+			It("errors when a label selector is invalid", func() {
+				r.exitCode = 1
+				session := r.run(append(initPromiseCmd, "--exclude", "app=(")...)
+				Expect(session.Err).To(gbytes.Say(`invalid label selector "app=\("`))
+			})
+		})
+
+		When("the operator is an OLM bundle", func() {
+			BeforeEach(func() {
+				r.flags["--operator-manifests"] = "assets/operator-bundle"
+				delete(r.flags, "--api-schema-from")
+			})
+
+			It("includes the objects OLM installs for the ClusterServiceVersion", func() {
+				session = r.run(initPromiseCmd...)
+				Expect(session.Out).To(gbytes.Say(`Generating the Promise API from redis.cache.example.com, the CRD owned by the operator`))
+
+				namespaces := map[string]string{}
+				for _, dep := range getSplitDependencies(workingDir) {
+					Expect(dep.GetKind()).NotTo(Equal("ClusterServiceVersion"))
+					namespaces[dep.GetKind()+"/"+dep.GetName()] = dep.GetNamespace()
+				}
+				Expect(namespaces).To(Equal(map[string]string{
+					"CustomResourceDefinition/redis.cache.example.com":                    "",
+					"Service/redis-operator-metrics":                                      "default",
+					"ServiceAccount/redis-operator-controller-manager":                    "default",
+					"ClusterRole/redis-operator-redis-operator-controller-manager":        "",
+					"ClusterRoleBinding/redis-operator-redis-operator-controller-manager": "",
+					"Role/redis-operator-redis-operator-controller-manager":               "default",
+					"RoleBinding/redis-operator-redis-operator-controller-manager":        "default",
+					"Deployment/redis-operator-controller-manager":                        "default",
+				}))
+
+				apiContent, err := os.ReadFile(filepath.Join(workingDir, "api.yaml"))
+				Expect(err).ToNot(HaveOccurred())
+				var apiCRD apiextensionsv1.CustomResourceDefinition
+				Expect(yaml.Unmarshal(apiContent, &apiCRD)).To(Succeed())
+				Expect(apiCRD.Spec.Versions[0].Name).To(Equal("v1alpha1"))
+				Expect(apiCRD.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties).To(HaveKey("size"))
+			})
+
+			It("binds the roles to the service accounts in the namespace", func() {
+				session = r.run(append(initPromiseCmd, "--namespace", "redis-system")...)
+
+				for _, dep := range getSplitDependencies(workingDir) {
+					if dep.GetKind() == "ClusterRoleBinding" || dep.GetKind() == "RoleBinding" {
+						subjects, _, _ := unstructured.NestedSlice(dep.Object, "subjects")
+						Expect(subjects).To(ConsistOf(HaveKeyWithValue("namespace", "redis-system")))
+					}
+				}
+			})
+		})
+
+		When("the operator is a Helm chart", func() {
+			BeforeEach(func() {
+				r.flags["--operator-manifests"] = "assets/operator-chart"
+				r.flags["--namespace"] = "redis-system"
+				delete(r.flags, "--api-schema-from")
+			})
+
+			It("includes the rendered chart and its CRDs", func() {
+				session = r.run(initPromiseCmd...)
+				Expect(session.Out).To(gbytes.Say(`Generating the Promise API from redis.cache.example.com, the CRD owned by the operator`))
+
+				namespaces := map[string]string{}
+				for _, dep := range getSplitDependencies(workingDir) {
+					namespaces[dep.GetKind()+"/"+dep.GetName()] = dep.GetNamespace()
+				}
+				Expect(namespaces).To(Equal(map[string]string{
+					"Namespace/redis-system":                           "",
+					"CustomResourceDefinition/redis.cache.example.com": "",
+					"ServiceAccount/redis-operator":                    "redis-system",
+					"ClusterRole/redis-operator":                       "",
+					"Deployment/redis-operator":                        "redis-system",
+				}))
+			})
+		})
+
+		When("--api-schema-from is not provided and the operator owns several CRDs", func() {
+			It("returns an error", func() {
+				r.exitCode = 1
+				delete(r.flags, "--api-schema-from")
+				session := r.run(initPromiseCmd...)
+				Expect(session.Err).To(gbytes.Say(`--api-schema-from is required when the operator does not own exactly one CRD`))
+			})
+		})
+
+		When("a CRD version is provided", func() {
+			It("generates the API from that version", func() {
+				session = r.run(append(initPromiseCmd, "--api-schema-version", "v1NotStored")...)
+
+				apiCRD := getSplitAPI(workingDir)
+				Expect(apiCRD.Spec.Versions).To(HaveLen(1))
+				Expect(apiCRD.Spec.Versions[0].Name).To(Equal("v1NotStored"))
+
+				pipelines := getWorkflowsFromSplitFile(workingDir, "resource", "configure")
+				Expect(pipelines[0].Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "OPERATOR_VERSION", Value: "v1NotStored"}))
+			})
+
+			It("errors when the CRD does not have the version", func() {
+				r.exitCode = 1
+				session := r.run(append(initPromiseCmd, "--api-schema-version", "v2")...)
+				Expect(session.Err).To(gbytes.Say(`version v2 not found in CRD postgresqls.acid.zalan.do; the CRD has versions: v1NotStored, v1Stored`))
+			})
+		})
+
+		When("spec fields are included or excluded", func() {
+			var fieldFilters []string
+
+			BeforeEach(func() {
+				fieldFilters = []string{
+					"--include", "spec.teamId",
+					"--include", "spec.postgresql.version",
+					"--include", "spec.volume",
+					"--exclude", "spec.volume.storageClass",
+				}
+			})
+
+			It("prunes the API and drops the operator printer columns and status", func() {
+				session = r.run(append(initPromiseCmd, fieldFilters...)...)
+				Expect(session.Out).To(gbytes.Say(`warning: spec.numberOfInstances is required by the operator but left out of the Promise API; set it in --values-file`))
+
+				apiCRD := getSplitAPI(workingDir)
+				apiVersion := apiCRD.Spec.Versions[0]
+				Expect(apiVersion.AdditionalPrinterColumns).To(BeEmpty())
+				Expect(apiVersion.Subresources.Scale).To(BeNil())
+				Expect(apiVersion.Subresources.Status).NotTo(BeNil())
+				Expect(apiVersion.Schema.OpenAPIV3Schema.Properties["status"].Properties).To(SatisfyAll(HaveLen(2), HaveKey("message"), HaveKey("resourceRef")))
+
+				spec := apiVersion.Schema.OpenAPIV3Schema.Properties["spec"]
+				Expect(spec.Properties).To(SatisfyAll(HaveLen(3), HaveKey("teamId"), HaveKey("postgresql"), HaveKey("volume")))
+				Expect(spec.Required).To(ConsistOf("teamId", "postgresql", "volume"))
+				Expect(spec.Properties["postgresql"].Properties).To(SatisfyAll(HaveLen(1), HaveKey("version")))
+				Expect(spec.Properties["volume"].Properties).To(SatisfyAll(HaveKey("size"), Not(HaveKey("storageClass"))))
+
+				Expect(getSplitDependencies(workingDir)).To(HaveLen(7))
+			})
+
+			It("passes the values file to the aspect as the spec defaults", func() {
+				valuesFile := filepath.Join(workingDir, "values.yaml")
+				Expect(os.WriteFile(valuesFile, []byte("numberOfInstances: 2\nvolume:\n  storageClass: fast\n"), 0644)).To(Succeed())
+
+				session = r.run(append(initPromiseCmd, append(fieldFilters, "--values-file", valuesFile)...)...)
+				Expect(session.Out).NotTo(gbytes.Say(`warning`))
+
+				for _, action := range []string{"configure", "delete"} {
+					pipelines := getWorkflowsFromSplitFile(workingDir, "resource", action)
+					Expect(pipelines[0].Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+						Name:  "OPERATOR_SPEC_DEFAULTS",
+						Value: `{"numberOfInstances":2,"volume":{"storageClass":"fast"}}`,
+					}))
+				}
+			})
+
+			It("errors when a field is not in the CRD", func() {
+				r.exitCode = 1
+				session := r.run(append(initPromiseCmd, "--exclude", "spec.volume.doesNotExist")...)
+				Expect(session.Err).To(gbytes.Say(`field spec.volume.doesNotExist not found in the CRD schema`))
+			})
+		})
+
 		When("there is no matching CRD in the manifests directory", func() {
 			BeforeEach(func() {
 				r.flags["--api-schema-from"] = "does-not-exist"
@@ -194,6 +439,11 @@ var _ = Describe("InitOperatorPromise", func() {
 				pipelines, err := v1alpha1.PipelinesFromUnstructured(promise.Spec.Workflows.Resource.Configure, logr.Discard())
 				Expect(err).ToNot(HaveOccurred())
 				expectPipelinesToMatchOperatorPipelines(pipelines)
+
+				deletePipelines, err := v1alpha1.PipelinesFromUnstructured(promise.Spec.Workflows.Resource.Delete, logr.Discard())
+				Expect(err).ToNot(HaveOccurred())
+				expectPipelinesToMatchOperatorPipelines(deletePipelines)
+				Expect(deletePipelines[0].GetName()).To(Equal("instance-delete"))
 			})
 		})
 
@@ -273,6 +523,24 @@ func expectCRDToMatchOperatorCRD(apiCRD apiextensionsv1.CustomResourceDefinition
 	Expect(apiCRD.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["apiVersion"].Enum[0].Raw).To(BeEquivalentTo(`"myorg.com/v1Stored"`))
 }
 
+func getSplitAPI(dir string) apiextensionsv1.CustomResourceDefinition {
+	apiContent, err := os.ReadFile(filepath.Join(dir, "api.yaml"))
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	var apiCRD apiextensionsv1.CustomResourceDefinition
+	ExpectWithOffset(1, yaml.Unmarshal(apiContent, &apiCRD)).To(Succeed())
+	return apiCRD
+}
+
+func getSplitDependencies(dir string) []v1alpha1.Dependency {
+	dependenciesContent, err := os.ReadFile(filepath.Join(dir, "dependencies.yaml"))
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	var dependencies []v1alpha1.Dependency
+	ExpectWithOffset(1, yaml.Unmarshal(dependenciesContent, &dependencies)).To(Succeed())
+	return dependencies
+}
+
 func expectDependenciesToMatchOperatorManifests(dependencies v1alpha1.Dependencies) {
 	Expect(dependencies).To(HaveLen(7))
 
@@ -296,11 +564,11 @@ func expectDependenciesToMatchOperatorManifests(dependencies v1alpha1.Dependenci
 	Expect(objectNamespaces).To(ConsistOf(
 		"default",
 		"default",
+		"",
 		"defined-namespace",
-		"default",
-		"default",
-		"default",
-		"default",
+		"",
+		"",
+		"",
 	))
 }
 
@@ -309,7 +577,7 @@ func expectPipelinesToMatchOperatorPipelines(pipelines []v1alpha1.Pipeline) {
 	pipeline := pipelines[0]
 	ExpectWithOffset(1, pipeline.Spec.Containers).To(HaveLen(1))
 	ExpectWithOffset(1, pipeline.Spec.Containers[0].Name).To(Equal("from-api-to-operator"))
-	ExpectWithOffset(1, pipeline.Spec.Containers[0].Image).To(Equal("ghcr.io/syntasso/kratix-cli/from-api-to-operator:v0.1.0"))
+	ExpectWithOffset(1, pipeline.Spec.Containers[0].Image).To(Equal("ghcr.io/syntasso/kratix-cli/from-api-to-operator:v0.2.0"))
 
 	ExpectWithOffset(1, pipeline.Spec.Containers[0].Env).To(HaveLen(3))
 	ExpectWithOffset(1, pipeline.Spec.Containers[0].Env).To(ConsistOf([]corev1.EnvVar{
@@ -43,7 +43,7 @@ var _ = Describe("InitterraformPromise", func() {
 			r.exitCode = 1
 			r.flags = map[string]string{}
 			session := r.run(initPromiseCmd...)
-			Expect(session.Err).To(gbytes.Say(`Error: required flag\(s\) "group", "kind", "module-source", "module-version" not set`))
+			Expect(session.Err).To(gbytes.Say(`Error: required flag\(s\) "group", "kind", "module-source" not set`))
 		})
 	})
 
@@ -81,6 +81,119 @@ var _ = Describe("InitterraformPromise", func() {
 			})
 		})
 
+		Describe("from a local module", func() {
+			var moduleDir string
+
+			BeforeEach(func() {
+				var err error
+				moduleDir, err = os.MkdirTemp("", "kratix-tf-module")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(moduleDir, "variables.tf"), []byte(`
+variable "name" {
+  type = string
+}
+
+variable "replicas" {
+  type    = number
+  default = 2
+}
+`), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte(`
+variable "tier" {
+  type    = string
+  default = "standard"
+}
+`), 0644)).To(Succeed())
+
+				r.flags["--module-source"] = moduleDir
+				delete(r.flags, "--module-version")
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(moduleDir)).To(Succeed())
+			})
+
+			It("generates the API from the variables of the module", func() {
+				session = r.run(initPromiseCmd...)
+				Expect(session.Out).To(gbytes.Say(`Promise generated successfully.`))
+
+				promise := cat(filepath.Join(workingDir, "promise.yaml"))
+				Expect(promise).To(SatisfyAll(
+					MatchRegexp(`replicas:\s+default: 2`),
+					MatchRegexp(`tier:\s+default: standard`),
+					MatchRegexp(`required:\s+- name\s`),
+					MatchRegexp(`- name: MODULE_SOURCE\s+value: `+moduleDir),
+					Not(ContainSubstring("MODULE_VERSION")),
+					MatchRegexp(`status:\s+properties:\s+message:\s+type: string\s+outputs:`),
+					MatchRegexp(`subresources:\s+status: \{\}`),
+					MatchRegexp(`delete:\s+- apiVersion: platform.kratix.io/v1alpha1\s+kind: Pipeline\s+metadata:\s+name: instance-delete`),
+				))
+
+				r.flags = map[string]string{"--dir": workingDir}
+				Expect(r.run("validate", "promise").Out).To(gbytes.Say("Promise is valid"))
+				Expect(cat(filepath.Join(workingDir, "README.md"))).To(ContainSubstring("--module-source " + moduleDir))
+			})
+
+			It("wires the backend, the providers and the module outputs into the aspect", func() {
+				Expect(os.WriteFile(filepath.Join(moduleDir, "outputs.tf"), []byte(`
+output "url" {
+  value = "https://example.com"
+}
+
+output "token" {
+  value     = "secret"
+  sensitive = true
+}
+`), 0644)).To(Succeed())
+				r.flags["--backend"] = "s3"
+				r.flags["--backend-config"] = "bucket=tf-state,region=eu-west-2"
+				r.flags["--provider"] = "aws:region=eu-west-2"
+				session = r.run(initPromiseCmd...)
+				Expect(session.Out).To(gbytes.Say(`Promise generated successfully.`))
+
+				Expect(cat(filepath.Join(workingDir, "promise.yaml"))).To(SatisfyAll(
+					MatchRegexp(`- name: TERRAFORM_BACKEND\s+value: s3`),
+					MatchRegexp(`- name: TERRAFORM_BACKEND_CONFIG\s+value: '\{"bucket":"tf-state","region":"eu-west-2"\}'`),
+					MatchRegexp(`- name: TERRAFORM_PROVIDERS\s+value: '\{"aws":\{"region":"eu-west-2"\}\}'`),
+					MatchRegexp(`- name: MODULE_OUTPUTS\s+value: url,token`),
+					MatchRegexp(`- name: MODULE_SENSITIVE_OUTPUTS\s+value: token`),
+				))
+
+				r.flags = map[string]string{"--dir": workingDir}
+				Expect(os.WriteFile(filepath.Join(workingDir, "example-resource.yaml"), []byte(`apiVersion: gcp.com/v2
+kind: GoogleCloudRun
+metadata:
+  name: example
+  namespace: default
+spec:
+  name: example
+`), 0644)).To(Succeed())
+				session = r.run("render")
+				Expect(session.Out).To(SatisfyAll(
+					gbytes.Say(`"output": {`),
+					gbytes.Say(`"token": {`),
+					gbytes.Say(`"sensitive": true`),
+					gbytes.Say(`"provider": {`),
+					gbytes.Say(`"terraform": {`),
+					gbytes.Say(`"key": "googlecloudrun_default_example.tfstate"`),
+				))
+			})
+
+			It("errors when a provider is invalid", func() {
+				r.flags["--provider"] = "aws:region"
+				r.exitCode = 1
+				session = r.run(initPromiseCmd...)
+				Expect(session.Err).To(gbytes.Say(`invalid provider "aws:region": expected NAME\[:KEY=VALUE,...\]`))
+			})
+
+			It("errors when a module version is set", func() {
+				r.flags["--module-version"] = "v1.0.0"
+				r.exitCode = 1
+				session = r.run(initPromiseCmd...)
+				Expect(session.Err).To(gbytes.Say("a module version cannot be set for the local module"))
+			})
+		})
+
 		Describe("with the --split flag", func() {
 			BeforeEach(func() {
 				r.flags["--split"] = ""
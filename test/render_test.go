@@ -0,0 +1,200 @@
+package integration_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("kratix render", func() {
+	var r *runner
+	var workingDir string
+
+	BeforeEach(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "kratix-test")
+		Expect(err).NotTo(HaveOccurred())
+		r = &runner{exitCode: 0, dir: workingDir}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	Describe("--help", func() {
+		It("shows the help message", func() {
+			sess := r.run("render", "--help")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("Command to render the output of the Kratix CLI aspects in a Promise's pipelines"),
+				gbytes.Say(`kratix render \[LIFECYCLE/ACTION/PIPELINE-NAME\]`),
+			))
+		})
+	})
+
+	When("the promise was generated from an operator", func() {
+		BeforeEach(func() {
+			manifests, err := filepath.Abs("assets/operator")
+			Expect(err).NotTo(HaveOccurred())
+			r.run("init", "operator-promise", "postgresql", "--group", "syntasso.io", "--kind", "Database",
+				"--operator-manifests", manifests, "--api-schema-from", "postgresqls.acid.zalan.do")
+			Expect(os.WriteFile(filepath.Join(workingDir, "request.yaml"), []byte(`apiVersion: syntasso.io/v1Stored
+kind: Database
+metadata:
+  name: my-db
+spec:
+  teamId: acid
+`), 0644)).To(Succeed())
+		})
+
+		It("renders the operator object without running any container", func() {
+			sess := r.run("render", "--input", "request.yaml")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("# Source: instance-configure/from-api-to-operator/object.yaml"),
+				gbytes.Say("apiVersion: acid.zalan.do/v1Stored"),
+				gbytes.Say("kind: postgresql"),
+				gbytes.Say("name: my-db"),
+				gbytes.Say("namespace: default"),
+				gbytes.Say("teamId: acid"),
+			))
+			Expect(sess.Out).NotTo(gbytes.Say("fake-docker"))
+		})
+
+		It("sets the spec defaults of the values file", func() {
+			manifests, err := filepath.Abs("assets/operator")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(workingDir, "values.yaml"), []byte("numberOfInstances: 2\nteamId: default-team\n"), 0644)).To(Succeed())
+			r.run("init", "operator-promise", "postgresql", "--group", "syntasso.io", "--kind", "Database",
+				"--operator-manifests", manifests, "--api-schema-from", "postgresqls.acid.zalan.do",
+				"--exclude", "spec.numberOfInstances", "--values-file", "values.yaml")
+
+			sess := r.run("render", "--input", "request.yaml")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("numberOfInstances: 2"),
+				gbytes.Say("teamId: acid"),
+			))
+		})
+
+		It("skips containers with unknown images", func() {
+			r.run("add", "container", "resource/configure/instance-configure", "--image", "syntasso/custom:v1.0.0", "--name", "custom")
+			sess := r.run("render", "resource/configure/instance-configure", "--input", "request.yaml")
+			Expect(sess.Err).To(gbytes.Say("skipping container custom: image syntasso/custom:v1.0.0 is not a known aspect"))
+			Expect(sess.Out).To(gbytes.Say("# Source: instance-configure/from-api-to-operator/object.yaml"))
+		})
+	})
+
+	When("the promise was generated from a crossplane XRD", func() {
+		BeforeEach(func() {
+			xrd, err := filepath.Abs("assets/crossplane/xrd.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			r.run("init", "crossplane-promise", "s3buckets", "--group", "syntasso.io", "--kind", "S3Bucket", "--xrd", xrd)
+		})
+
+		It("renders the crossplane claim for example-resource.yaml", func() {
+			sess := r.run("render")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("# Source: instance-configure/from-api-to-crossplane-claim/object.yaml"),
+				gbytes.Say("apiVersion: awsblueprints.io/v1alpha1"),
+				gbytes.Say("kind: ObjectStorage"),
+			))
+		})
+	})
+
+	When("the promise was generated from a helm chart", func() {
+		BeforeEach(func() {
+			chart, err := filepath.Abs("assets/helm-chart")
+			Expect(err).NotTo(HaveOccurred())
+			r.run("init", "helm-promise", "webapp", "--group", "syntasso.io", "--kind", "WebApp",
+				"--chart-path", chart, "--chart-url", chart)
+			Expect(os.WriteFile(filepath.Join(workingDir, "request.yaml"), []byte(`apiVersion: syntasso.io/v1alpha1
+kind: WebApp
+metadata:
+  name: shop
+  namespace: team-a
+spec:
+  replicas: 2
+`), 0644)).To(Succeed())
+		})
+
+		It("renders the chart in-process", func() {
+			sess := r.run("render", "--input", "request.yaml")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("# Source: instance-configure/instance-configure/deployment-shop.yaml"),
+				gbytes.Say("kind: Deployment"),
+				gbytes.Say("kratix.io/resource-name: shop"),
+				gbytes.Say("replicas: 2"),
+			))
+		})
+	})
+
+	When("the promise uses the terraform-generate aspect", func() {
+		BeforeEach(func() {
+			r.run("init", "promise", "vpc", "--group", "syntasso.io", "--kind", "VPC")
+			Expect(os.WriteFile(filepath.Join(workingDir, "promise.yaml"), []byte(`apiVersion: platform.kratix.io/v1alpha1
+kind: Promise
+metadata:
+  name: vpc
+spec:
+  workflows:
+    resource:
+      configure:
+      - apiVersion: platform.kratix.io/v1alpha1
+        kind: Pipeline
+        metadata:
+          name: instance-configure
+        spec:
+          containers:
+          - name: terraform-generate
+            image: ghcr.io/syntasso/kratix-cli/terraform-generate:v0.2.0
+            env:
+            - name: MODULE_SOURCE
+              value: https://github.com/terraform-aws-modules/terraform-aws-vpc.git
+            - name: MODULE_VERSION
+              value: v5.19.0
+`), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "example-resource.yaml"), []byte(`apiVersion: syntasso.io/v1alpha1
+kind: VPC
+metadata:
+  name: my-vpc
+  namespace: team-a
+spec:
+  cidr: 10.0.0.0/16
+  azs: []
+`), 0644)).To(Succeed())
+		})
+
+		It("renders the terraform module", func() {
+			sess := r.run("render", "resource/configure/instance-configure")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("# Source: instance-configure/terraform-generate/vpc_team-a_my-vpc.tf.json"),
+				gbytes.Say(`"vpc_team-a_my-vpc": {`),
+				gbytes.Say(`"cidr": "10.0.0.0/16"`),
+				gbytes.Say(`"source": "git::https://github.com/terraform-aws-modules/terraform-aws-vpc.git\?ref=v5.19.0"`),
+			))
+			Expect(string(sess.Out.Contents())).NotTo(ContainSubstring("azs"))
+		})
+
+		It("errors when rendering a delete pipeline", func() {
+			r.exitCode = 1
+			sess := r.run("render", "resource/delete/instance-delete")
+			Expect(sess.Err).To(gbytes.Say("cannot render resource/delete/instance-delete: the output of delete pipelines is not written to destinations"))
+		})
+
+		It("errors when the aspect environment is incomplete", func() {
+			replaceInFile(filepath.Join(workingDir, "promise.yaml"), "MODULE_SOURCE", "OTHER")
+			r.exitCode = 1
+			sess := r.run("render")
+			Expect(sess.Err).To(gbytes.Say("failed to render container terraform-generate in pipeline instance-configure: expected MODULE_SOURCE to be set"))
+		})
+	})
+
+	It("errors when no pipeline uses a known aspect", func() {
+		r.run("init", "promise", "postgresql", "--group", "syntasso.io", "--kind", "Database")
+		r.run("add", "container", "resource/configure/instance", "--image", "syntasso/custom:v1.0.0")
+		r.exitCode = 1
+		sess := r.run("render")
+		Expect(sess.Err).To(gbytes.Say("no containers with a known aspect image found in the pipelines"))
+	})
+})
@@ -0,0 +1,79 @@
+package integration_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("kratix test workflow", func() {
+	var r *runner
+	var workingDir string
+
+	BeforeEach(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "kratix-test")
+		Expect(err).NotTo(HaveOccurred())
+		r = &runner{exitCode: 0, dir: workingDir}
+
+		r.run("init", "promise", "postgresql", "--group", "syntasso.io", "--kind", "Database")
+		r.run("add", "container", "resource/configure/instance", "--image", "syntasso/first:v1.0.0", "--name", "first")
+		r.run("add", "container", "resource/configure/instance", "--image", "syntasso/second:v1.0.0", "--name", "second")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	Describe("--help", func() {
+		It("shows the help message", func() {
+			sess := r.run("test", "workflow", "--help")
+			Expect(sess.Out).To(SatisfyAll(
+				gbytes.Say("Command to run a Promise workflow pipeline locally"),
+				gbytes.Say("kratix test workflow LIFECYCLE/ACTION/PIPELINE-NAME"),
+			))
+		})
+	})
+
+	It("runs every container of the pipeline in order with shared volumes", func() {
+		outputDir := filepath.Join(workingDir, "test-output/resource/configure/instance")
+		sess := r.run("test", "workflow", "resource/configure/instance")
+		Expect(sess.Out).To(SatisfyAll(
+			gbytes.Say("Running container first with image syntasso/first:v1.0.0..."),
+			gbytes.Say(`fake-docker run --rm --volume %[1]s/input:/kratix/input:ro --volume %[1]s/output:/kratix/output --volume %[1]s/metadata:/kratix/metadata --env KRATIX_WORKFLOW_TYPE=resource --env KRATIX_WORKFLOW_ACTION=configure --env KRATIX_PROMISE_NAME=postgresql syntasso/first:v1.0.0`, outputDir),
+			gbytes.Say("Running container second with image syntasso/second:v1.0.0..."),
+			gbytes.Say(`fake-docker run --rm --volume %[1]s/input:/kratix/input:ro --volume %[1]s/output:/kratix/output`, outputDir),
+			gbytes.Say("Workflow output written to %s", outputDir),
+		))
+
+		Expect(cat(filepath.Join(outputDir, "input/object.yaml"))).To(Equal(cat(filepath.Join(workingDir, "example-resource.yaml"))))
+		Expect(filepath.Join(outputDir, "output")).To(BeADirectory())
+		Expect(filepath.Join(outputDir, "metadata")).To(BeADirectory())
+	})
+
+	It("can use podman, a custom input and a custom output directory", func() {
+		outputDir, err := os.MkdirTemp("", "kratix-test-output")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(outputDir)
+
+		Expect(os.WriteFile(filepath.Join(workingDir, "request.yaml"), []byte("kind: Database\n"), 0644)).To(Succeed())
+		sess := r.run("test", "workflow", "resource/configure/instance", "--engine", "podman", "--input", "request.yaml", "--output-dir", outputDir)
+		Expect(sess.Out).To(gbytes.Say("fake-podman run --rm --volume %s/input:/kratix/input:ro", outputDir))
+		Expect(cat(filepath.Join(outputDir, "input/object.yaml"))).To(Equal("kind: Database\n"))
+	})
+
+	It("errors when the pipeline does not exist", func() {
+		r.exitCode = 1
+		sess := r.run("test", "workflow", "resource/configure/missing")
+		Expect(sess.Err).To(gbytes.Say("pipeline missing not found in the resource/configure workflow"))
+	})
+
+	It("errors when the engine is not supported", func() {
+		r.exitCode = 1
+		sess := r.run("test", "workflow", "resource/configure/instance", "--engine", "containerd")
+		Expect(sess.Err).To(gbytes.Say("unsupported container engine: containerd"))
+	})
+})
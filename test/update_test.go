@@ -166,6 +166,46 @@ var _ = Describe("update", func() {
 						Expect(props["nested"].Properties["secondField"].Type).To(Equal("integer"))
 					})
 
+					It("can define arrays, maps, constraints and required properties", func() {
+						sess := r.run("update", "api",
+							"-p", "size:string,enum=small|large,default=small,required",
+							"-p", "tags:[]string,max=3",
+							"-p", "labels:map[string]string",
+							"-p", "service.port:integer,min=1,max=65535,required,description=the service port",
+							"--dir", dir)
+						Expect(sess.Out).To(gbytes.Say("Promise api updated"))
+
+						crd := getCRD(dir, false)
+						spec := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+						Expect(spec.Required).To(ConsistOf("size"))
+						Expect(spec.Properties["size"].Enum).To(HaveLen(2))
+						Expect(spec.Properties["size"].Default.Raw).To(MatchJSON(`"small"`))
+						Expect(spec.Properties["tags"].Type).To(Equal("array"))
+						Expect(spec.Properties["tags"].Items.Schema.Type).To(Equal("string"))
+						Expect(*spec.Properties["tags"].MaxItems).To(Equal(int64(3)))
+						Expect(spec.Properties["labels"].AdditionalProperties.Schema.Type).To(Equal("string"))
+						Expect(spec.Properties["service"].Required).To(ConsistOf("port"))
+						Expect(spec.Properties["service"].Properties["port"].Description).To(Equal("the service port"))
+						Expect(*spec.Properties["service"].Properties["port"].Maximum).To(Equal(65535.0))
+
+						By("updating the required lists when properties are redefined or removed")
+						r.run("update", "api", "-p", "size:string", "-p", "service.port-", "--dir", dir)
+						crd = getCRD(dir, false)
+						spec = crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+						Expect(spec.Required).To(BeEmpty())
+						Expect(spec.Properties["service"].Required).To(BeEmpty())
+
+						By("only updating the required list of the object holding the property")
+						r.run("update", "api", "-p", "database.auth.username:string,required", "--dir", dir)
+						crd = getCRD(dir, false)
+						spec = crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+						Expect(spec.Required).To(BeEmpty())
+						Expect(spec.Properties["database"].Required).To(BeEmpty())
+						Expect(spec.Properties["database"].Properties["auth"].Required).To(ConsistOf("username"))
+
+						Expect(r.run("validate", "promise", "--dir", dir).Out).To(gbytes.Say("Promise is valid"))
+					})
+
 					It("errors when property format is invalid", func() {
 						r.exitCode = 1
 						sess := r.run("update", "api", "--property", "invalid%", "--dir", dir)
@@ -176,6 +216,92 @@ var _ = Describe("update", func() {
 						Expect(sess.Err).To(gbytes.Say("invalid"))
 					})
 				})
+
+				Context("api versions", func() {
+					BeforeEach(func() {
+						r.run("update", "api", "-p", "name:string", "--dir", dir)
+					})
+
+					It("adds a new storage version copied from the current one and deprecates the old one", func() {
+						sess := r.run("update", "api", "--new-version", "v1beta1", "-p", "tier:string", "--dir", dir)
+						Expect(sess.Out).To(SatisfyAll(
+							gbytes.Say("Version v1alpha1 marked as deprecated"),
+							gbytes.Say("Example resource updated"),
+							gbytes.Say("Promise api updated"),
+						))
+
+						crd := getCRD(dir, false)
+						Expect(crd.Spec.Versions).To(HaveLen(2))
+						oldVersion, newVersion := crd.Spec.Versions[0], crd.Spec.Versions[1]
+
+						Expect(oldVersion.Name).To(Equal("v1alpha1"))
+						Expect(oldVersion.Served).To(BeTrue())
+						Expect(oldVersion.Storage).To(BeFalse())
+						Expect(oldVersion.Deprecated).To(BeTrue())
+						Expect(*oldVersion.DeprecationWarning).To(Equal("syntasso.io/v1alpha1 Database is deprecated; use syntasso.io/v1beta1 Database"))
+						Expect(oldVersion.Schema.OpenAPIV3Schema.Properties["spec"].Properties).To(SatisfyAll(HaveKey("name"), Not(HaveKey("tier"))))
+
+						Expect(newVersion.Name).To(Equal("v1beta1"))
+						Expect(newVersion.Served).To(BeTrue())
+						Expect(newVersion.Storage).To(BeTrue())
+						Expect(newVersion.Deprecated).To(BeFalse())
+						Expect(newVersion.Schema.OpenAPIV3Schema.Properties["spec"].Properties).To(SatisfyAll(HaveKey("name"), HaveKey("tier")))
+
+						matchExampleResource(dir, "example-postgresql", "syntasso.io", "v1beta1", "Database")
+					})
+
+					It("can keep an existing version as the storage version and set the deprecation warning", func() {
+						r.run("update", "api", "--new-version", "v1beta1", "--storage-version", "v1alpha1", "--deprecation-warning", "migrate to v1beta1", "--dir", dir)
+
+						crd := getCRD(dir, false)
+						Expect(crd.Spec.Versions).To(HaveLen(2))
+						Expect(crd.Spec.Versions[0].Storage).To(BeTrue())
+						Expect(*crd.Spec.Versions[0].DeprecationWarning).To(Equal("migrate to v1beta1"))
+						Expect(crd.Spec.Versions[1].Storage).To(BeFalse())
+
+						By("updating properties of the storage version when --new-version is not set")
+						r.run("update", "api", "-p", "region:string", "--dir", dir)
+						crd = getCRD(dir, false)
+						Expect(crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties).To(HaveKey("region"))
+						Expect(crd.Spec.Versions[1].Schema.OpenAPIV3Schema.Properties["spec"].Properties).NotTo(HaveKey("region"))
+
+						By("switching the storage version")
+						r.run("update", "api", "--storage-version", "v1beta1", "--dir", dir)
+						crd = getCRD(dir, false)
+						Expect(crd.Spec.Versions[0].Storage).To(BeFalse())
+						Expect(crd.Spec.Versions[1].Storage).To(BeTrue())
+					})
+
+					It("adds the properties to the storage version when it is not the new version", func() {
+						r.run("update", "api", "--new-version", "v1beta1", "--storage-version", "v1alpha1", "-p", "tier:string,required", "-p", "name-", "--dir", dir)
+
+						crd := getCRD(dir, false)
+						Expect(crd.Spec.Versions).To(HaveLen(2))
+						for _, version := range crd.Spec.Versions {
+							spec := version.Schema.OpenAPIV3Schema.Properties["spec"]
+							Expect(spec.Properties).To(SatisfyAll(HaveKey("tier"), Not(HaveKey("name"))))
+							Expect(spec.Required).To(ConsistOf("tier"))
+						}
+					})
+
+					It("errors when the new version already exists", func() {
+						r.exitCode = 1
+						sess := r.run("update", "api", "--new-version", "v1alpha1", "--dir", dir)
+						Expect(sess.Err).To(gbytes.Say("version v1alpha1 already exists in the API"))
+					})
+
+					It("errors when the storage version does not exist", func() {
+						r.exitCode = 1
+						sess := r.run("update", "api", "--storage-version", "v2", "--dir", dir)
+						Expect(sess.Err).To(gbytes.Say("version v2 not found in the API"))
+					})
+
+					It("errors when --version and --new-version are both set", func() {
+						r.exitCode = 1
+						sess := r.run("update", "api", "--version", "v2", "--new-version", "v3", "--dir", dir)
+						Expect(sess.Err).To(gbytes.Say(`if any flags in the group \[version new-version\] are set none of the others can be`))
+					})
+				})
 			})
 
 			When("working with promise generated with --split flag", func() {
@@ -624,9 +750,71 @@ var _ = Describe("update", func() {
 			Expect(sess.Err).To(gbytes.Say("invalid"))
 		})
 
+		It("can update multiple destination selector entries by index", func() {
+			r.run("update", "destination-selector", "env=prod")
+			r.run("update", "destination-selector", "zone=eu", "--index", "1")
+			r.run("update", "destination-selector", "tier=gold", "-i", "1")
+
+			selectors := getPromiseSchedulings(filepath.Join(workingDir, "promise.yaml"), false)
+			Expect(selectors).To(Equal([]v1alpha1.PromiseScheduling{
+				{MatchLabels: map[string]string{"env": "prod"}},
+				{MatchLabels: map[string]string{"zone": "eu", "tier": "gold"}},
+			}))
+
+			By("removing entries left without labels")
+			r.run("update", "destination-selector", "env-")
+			selectors = getPromiseSchedulings(filepath.Join(workingDir, "promise.yaml"), false)
+			Expect(selectors).To(Equal([]v1alpha1.PromiseScheduling{
+				{MatchLabels: map[string]string{"zone": "eu", "tier": "gold"}},
+			}))
+		})
+
+		It("errors when the index is out of range", func() {
+			r.exitCode = 1
+			sess := r.run("update", "destination-selector", "zone=eu", "--index", "2")
+			Expect(sess.Err).To(gbytes.Say("invalid destination selector index 2: the Promise has 0 destination selector"))
+		})
+
+		When("the promise was generated with --split", func() {
+			BeforeEach(func() {
+				Expect(os.Remove(filepath.Join(workingDir, "promise.yaml"))).To(Succeed())
+				r.run("init", "promise", "postgresql", "--group", "syntasso.io", "--kind", "Database", "--split")
+			})
+
+			It("stores the selectors in destination-selectors.yaml and builds them into the promise", func() {
+				r.run("update", "destination-selector", "env=prod")
+				r.run("update", "destination-selector", "zone=eu", "--index", "1")
+
+				selectorsFile := filepath.Join(workingDir, "destination-selectors.yaml")
+				Expect(getPromiseSchedulings(selectorsFile, true)).To(Equal([]v1alpha1.PromiseScheduling{
+					{MatchLabels: map[string]string{"env": "prod"}},
+					{MatchLabels: map[string]string{"zone": "eu"}},
+				}))
+				Expect(filepath.Join(workingDir, "promise.yaml")).NotTo(BeAnExistingFile())
+
+				outputPath := filepath.Join(workingDir, "built-promise.yaml")
+				r.run("build", "promise", "postgresql", "--output", outputPath)
+				Expect(getPromiseSchedulings(outputPath, false)).To(HaveLen(2))
+			})
+		})
 	})
 })
 
+func getPromiseSchedulings(filePath string, split bool) []v1alpha1.PromiseScheduling {
+	fileBytes, err := os.ReadFile(filePath)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+	if split {
+		var selectors []v1alpha1.PromiseScheduling
+		ExpectWithOffset(1, yamlsig.Unmarshal(fileBytes, &selectors)).To(Succeed())
+		return selectors
+	}
+
+	var promise v1alpha1.Promise
+	ExpectWithOffset(1, yamlsig.Unmarshal(fileBytes, &promise)).To(Succeed())
+	return promise.Spec.DestinationSelectors
+}
+
 func getDependencies(dir string, split bool) v1alpha1.Dependencies {
 	var deps v1alpha1.Dependencies
 	if split {
@@ -652,6 +840,10 @@ func matchGvkInAPIFile(dir, group, version, kind, singular, plural string) {
 }
 
 func getCRDProperties(dir string, split bool) map[string]apiextensionsv1.JSONSchemaProps {
+	return getCRD(dir, split).Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties
+}
+
+func getCRD(dir string, split bool) *apiextensionsv1.CustomResourceDefinition {
 	var crd *apiextensionsv1.CustomResourceDefinition
 	if split {
 		apiYAML, err := os.ReadFile(filepath.Join(dir, "api.yaml"))
@@ -666,7 +858,7 @@ func getCRDProperties(dir string, split bool) map[string]apiextensionsv1.JSONSch
 		crd, err = promise.GetAPIAsCRD()
 		ExpectWithOffset(1, err).NotTo(HaveOccurred())
 	}
-	return crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties
+	return crd
 }
 
 func getDestinationSelectors(dir string) map[string]string {
@@ -0,0 +1,152 @@
+package integration_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("validate", func() {
+	var r *runner
+	var workingDir string
+
+	BeforeEach(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "kratix-validate-test")
+		Expect(err).NotTo(HaveOccurred())
+		r = &runner{exitCode: 0, dir: workingDir}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	When("called without a subcommand", func() {
+		It("prints the help", func() {
+			session := r.run("validate")
+			Expect(session.Out).To(SatisfyAll(
+				gbytes.Say("Command to validate kratix resources"),
+				gbytes.Say(`Use "kratix validate \[command\] --help" for more information about a command.`),
+			))
+		})
+	})
+
+	Context("promise", func() {
+		When("there is no promise in the directory", func() {
+			It("errors with a helpful message", func() {
+				r.exitCode = 1
+				sess := r.run("validate", "promise")
+				Expect(sess.Err).To(gbytes.Say("failed to find promise.yaml or api.yaml in directory"))
+			})
+		})
+
+		When("working with promise.yaml", func() {
+			BeforeEach(func() {
+				r.run("init", "promise", "postgresql", "--group", "syntasso.io", "--kind", "Database")
+				r.run("update", "api", "--property", "size:integer")
+				r.run("add", "container", "resource/configure/instance", "--image", "syntasso/postgres-resource:v1.0.0")
+			})
+
+			It("succeeds for a valid promise", func() {
+				sess := r.run("validate", "promise")
+				Expect(sess.Out).To(gbytes.Say("Promise is valid"))
+			})
+
+			It("reports an invalid API with the field path", func() {
+				replaceInFile(filepath.Join(workingDir, "promise.yaml"), "plural: databases", "plural: Databases")
+
+				r.exitCode = 1
+				sess := r.run("validate", "promise")
+				Expect(sess.Err).To(SatisfyAll(
+					gbytes.Say(`promise.yaml: spec.api.metadata.name: Invalid value: "databases.syntasso.io"`),
+					gbytes.Say(`promise.yaml: spec.api.spec.names.plural: Invalid value: "Databases"`),
+					gbytes.Say(`promise validation failed: 2 error\(s\) found`),
+				))
+			})
+
+			It("reports an example resource that does not conform to the API", func() {
+				appendToFile(filepath.Join(workingDir, "example-resource.yaml"), "spec:\n  size: large\n  region: eu\n")
+
+				r.exitCode = 1
+				sess := r.run("validate", "promise")
+				Expect(sess.Err).To(SatisfyAll(
+					gbytes.Say(`example-resource.yaml: spec.size: Invalid value: "string": spec.size in body must be of type integer`),
+					gbytes.Say(`example-resource.yaml: spec.region: Forbidden: unknown field`),
+				))
+			})
+
+			It("reports an example resource of the wrong kind", func() {
+				replaceInFile(filepath.Join(workingDir, "example-resource.yaml"), "kind: Database", "kind: Cache")
+
+				r.exitCode = 1
+				sess := r.run("validate", "promise")
+				Expect(sess.Err).To(gbytes.Say(`example-resource.yaml: kind: Invalid value: "Cache": must match the Promise API kind Database`))
+			})
+
+			It("reports invalid pipelines", func() {
+				replaceInFile(filepath.Join(workingDir, "promise.yaml"), "image: syntasso/postgres-resource:v1.0.0", `image: ""`)
+
+				r.exitCode = 1
+				sess := r.run("validate", "promise")
+				Expect(sess.Err).To(gbytes.Say(`promise.yaml: spec.workflows.resource.configure\[0\].spec.containers\[0\].image: Required value`))
+			})
+		})
+
+		When("working with a promise generated with --split", func() {
+			BeforeEach(func() {
+				r.run("init", "promise", "postgresql", "--group", "syntasso.io", "--kind", "Database", "--split")
+				r.run("update", "api", "--property", "size:integer")
+				r.run("add", "container", "resource/configure/instance", "--image", "syntasso/postgres-resource:v1.0.0")
+			})
+
+			It("succeeds for a valid promise", func() {
+				sess := r.run("validate", "promise")
+				Expect(sess.Out).To(gbytes.Say("Promise is valid"))
+			})
+
+			It("reports every problem with the file it was found in", func() {
+				replaceInFile(filepath.Join(workingDir, "api.yaml"), "type: integer", "type: int")
+				replaceInFile(filepath.Join(workingDir, "workflows/resource/configure/workflow.yaml"), "name: instance", `name: ""`)
+
+				r.exitCode = 1
+				sess := r.run("validate", "promise")
+				Expect(sess.Err).To(SatisfyAll(
+					gbytes.Say(`api.yaml: spec.versions\[0\].schema.openAPIV3Schema.properties\[spec\].properties\[size\].type: Unsupported value: "int"`),
+					gbytes.Say(`workflows/resource/configure/workflow.yaml: \[0\].metadata.name: Required value`),
+				))
+			})
+
+			It("reports workflows that cannot be loaded with the other problems", func() {
+				replaceInFile(filepath.Join(workingDir, "api.yaml"), "type: integer", "type: int")
+				Expect(os.WriteFile(filepath.Join(workingDir, "workflows/resource/configure/workflow.yaml"), []byte("name: instance\n"), 0644)).To(Succeed())
+
+				r.exitCode = 1
+				sess := r.run("validate", "promise")
+				Expect(sess.Err).To(SatisfyAll(
+					gbytes.Say(`api.yaml: spec.versions\[0\].schema.openAPIV3Schema.properties\[spec\].properties\[size\].type: Unsupported value: "int"`),
+					gbytes.Say(`workflows: Invalid value: failed to load workflows: failed to get resource configure workflow`),
+					gbytes.Say(`promise validation failed: 2 error\(s\) found`),
+				))
+			})
+		})
+	})
+})
+
+func replaceInFile(path, old, new string) {
+	content, err := os.ReadFile(path)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ExpectWithOffset(1, string(content)).To(ContainSubstring(old))
+	ExpectWithOffset(1, os.WriteFile(path, []byte(strings.Replace(string(content), old, new, 1)), 0644)).To(Succeed())
+}
+
+func appendToFile(path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	defer f.Close()
+	_, err = f.WriteString(content)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+}